@@ -3,7 +3,30 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net/netip"
 	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultShutdownTimeout = 15 * time.Second
+	defaultBridgeTimeout   = 5 * time.Second
+	defaultIdempotencyTTL  = 10 * time.Minute
+
+	defaultLightCommandsPerSecond = 10
+	defaultGroupCommandsPerSecond = 1
+	defaultBridgeQueueSize        = 50
+
+	defaultBridgeRetryAttempts       = 3
+	defaultBridgeRetryInitialBackoff = 100 * time.Millisecond
+	defaultBridgeRetryMaxBackoff     = 2 * time.Second
+	defaultTLSCertFile               = "hueshelly-cert.pem"
+	defaultTLSKeyFile                = "hueshelly-key.pem"
+	defaultTimerStateFile            = "hueshelly-timers.json"
+	defaultFadeOff                   = time.Minute
+	defaultDimmingRamp               = 5 * time.Second
+	defaultDimmingMax                = 10 * time.Second
 )
 
 // Config stores all runtime settings loaded from config.json.
@@ -12,6 +35,86 @@ type Config struct {
 	HueUser                   string `json:"hueUser"`
 	ServerPort                int    `json:"serverPort"`
 	RestorePreviousLightState bool   `json:"restorePreviousLightState"`
+	// ShutdownTimeout bounds how long in-flight requests may take to finish on SIGINT/SIGTERM.
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+	// BridgeTimeout bounds every single request to the Hue bridge.
+	BridgeTimeout Duration `json:"bridgeTimeout"`
+	// ToggleDebounce collapses repeated toggles of the same target within the window. 0 disables it.
+	ToggleDebounce Duration `json:"toggleDebounce"`
+	// IdempotencyKeyTTL is how long an idempotency key sent with a toggle is remembered.
+	IdempotencyKeyTTL Duration        `json:"idempotencyKeyTtl"`
+	BridgeRateLimit   BridgeRateLimit `json:"bridgeRateLimit"`
+	BridgeRetry       BridgeRetry     `json:"bridgeRetry"`
+	Auth              Auth            `json:"auth"`
+	TLS               TLS             `json:"tls"`
+	// TimerStateFile keeps pending auto-off timers across restarts.
+	TimerStateFile string `json:"timerStateFile"`
+	// Routines are named step lists triggered by /routine/{name}.
+	Routines []Routine `json:"routines"`
+	// Timezone is the IANA time zone of schedules, e.g. "Europe/Berlin". It defaults to the system time zone.
+	Timezone  string     `json:"timezone"`
+	Schedules []Schedule `json:"schedules"`
+	// Coordinates are needed for sun-relative schedules and daylight brightness.
+	Coordinates *Coordinates `json:"coordinates"`
+	Daylight    Daylight     `json:"daylight"`
+	OnProfiles  OnProfiles   `json:"onProfiles"`
+	Transitions Transitions  `json:"transitions"`
+	Dimming     Dimming      `json:"dimming"`
+	// TogglePolicies decide when toggling a room switches it off.
+	TogglePolicies TogglePolicies `json:"togglePolicies"`
+	// Restore overrides restorePreviousLightState per room and light.
+	Restore Restore `json:"restore"`
+}
+
+// TLS configures the optional HTTPS listener. HTTPS is disabled when Port is 0.
+type TLS struct {
+	Port     int    `json:"port"`
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+	// SelfSigned generates a certificate into CertFile and KeyFile if they do not exist yet.
+	SelfSigned bool `json:"selfSigned"`
+	// DisableHTTP stops serving plain HTTP on serverPort.
+	DisableHTTP bool `json:"disableHttp"`
+	// AuthOnlyOverHTTPS rejects API tokens presented over plain HTTP. Requests
+	// without a token are still allowed for auth.plainHttpActions.
+	AuthOnlyOverHTTPS bool `json:"authOnlyOverHttps"`
+}
+
+// BridgeRateLimit paces state changes sent to the bridge.
+type BridgeRateLimit struct {
+	LightCommandsPerSecond float64 `json:"lightCommandsPerSecond"`
+	GroupCommandsPerSecond float64 `json:"groupCommandsPerSecond"`
+	// QueueSize is the number of commands that may wait; further commands are rejected.
+	QueueSize int `json:"queueSize"`
+}
+
+// BridgeRetry controls retries of bridge calls that failed with transient errors.
+type BridgeRetry struct {
+	// MaxAttempts includes the first attempt; 1 disables retries.
+	MaxAttempts    int      `json:"maxAttempts"`
+	InitialBackoff Duration `json:"initialBackoff"`
+	MaxBackoff     Duration `json:"maxBackoff"`
+}
+
+// Auth restricts access to the HTTP API. Authentication is disabled when no tokens are configured.
+type Auth struct {
+	Tokens []APIToken `json:"tokens"`
+	// AllowedNetworks lists IPs or CIDR ranges allowed to connect. Empty allows every client.
+	AllowedNetworks []string `json:"allowedNetworks"`
+	// PlainHTTPActions lists the actions clients in AllowedNetworks may perform over
+	// plain HTTP without a token while tls.authOnlyOverHttps is set, e.g. toggle for
+	// Shelly devices that cannot use HTTPS.
+	PlainHTTPActions []string `json:"plainHttpActions"`
+}
+
+// APIToken is a static token with the actions, rooms and lights it may use.
+// Empty Actions, Rooms or Lights lists allow everything.
+type APIToken struct {
+	Name    string   `json:"name"`
+	Token   string   `json:"token"`
+	Actions []string `json:"actions"`
+	Rooms   []string `json:"rooms"`
+	Lights  []int    `json:"lights"`
 }
 
 // Load reads and validates configuration from disk.
@@ -26,6 +129,7 @@ func Load(path string) (Config, error) {
 		return Config{}, fmt.Errorf("decode config file %q: %w", path, err)
 	}
 
+	cfg.applyDefaults()
 	if err := cfg.Validate(); err != nil {
 		return Config{}, fmt.Errorf("validate config file %q: %w", path, err)
 	}
@@ -33,6 +137,57 @@ func Load(path string) (Config, error) {
 	return cfg, nil
 }
 
+// applyDefaults fills in optional settings that were omitted from config.json.
+func (cfg *Config) applyDefaults() {
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = Duration(defaultShutdownTimeout)
+	}
+	if cfg.BridgeTimeout == 0 {
+		cfg.BridgeTimeout = Duration(defaultBridgeTimeout)
+	}
+	if cfg.IdempotencyKeyTTL == 0 {
+		cfg.IdempotencyKeyTTL = Duration(defaultIdempotencyTTL)
+	}
+	if cfg.BridgeRateLimit.LightCommandsPerSecond == 0 {
+		cfg.BridgeRateLimit.LightCommandsPerSecond = defaultLightCommandsPerSecond
+	}
+	if cfg.BridgeRateLimit.GroupCommandsPerSecond == 0 {
+		cfg.BridgeRateLimit.GroupCommandsPerSecond = defaultGroupCommandsPerSecond
+	}
+	if cfg.BridgeRateLimit.QueueSize == 0 {
+		cfg.BridgeRateLimit.QueueSize = defaultBridgeQueueSize
+	}
+	if cfg.BridgeRetry.MaxAttempts == 0 {
+		cfg.BridgeRetry.MaxAttempts = defaultBridgeRetryAttempts
+	}
+	if cfg.BridgeRetry.InitialBackoff == 0 {
+		cfg.BridgeRetry.InitialBackoff = Duration(defaultBridgeRetryInitialBackoff)
+	}
+	if cfg.BridgeRetry.MaxBackoff == 0 {
+		cfg.BridgeRetry.MaxBackoff = Duration(defaultBridgeRetryMaxBackoff)
+	}
+	if cfg.TimerStateFile == "" {
+		cfg.TimerStateFile = defaultTimerStateFile
+	}
+	if cfg.Transitions.FadeOff == 0 {
+		cfg.Transitions.FadeOff = Duration(defaultFadeOff)
+	}
+	if cfg.Dimming.RampDuration == 0 {
+		cfg.Dimming.RampDuration = Duration(defaultDimmingRamp)
+	}
+	if cfg.Dimming.MaxDuration == 0 {
+		cfg.Dimming.MaxDuration = Duration(defaultDimmingMax)
+	}
+	if cfg.TLS.SelfSigned {
+		if cfg.TLS.CertFile == "" {
+			cfg.TLS.CertFile = defaultTLSCertFile
+		}
+		if cfg.TLS.KeyFile == "" {
+			cfg.TLS.KeyFile = defaultTLSKeyFile
+		}
+	}
+}
+
 // Validate checks the required configuration fields.
 func (cfg Config) Validate() error {
 	if cfg.HueUser == "" {
@@ -41,5 +196,133 @@ func (cfg Config) Validate() error {
 	if cfg.ServerPort <= 0 || cfg.ServerPort > 65535 {
 		return fmt.Errorf("serverPort must be between 1 and 65535")
 	}
+	if cfg.ShutdownTimeout < 0 {
+		return fmt.Errorf("shutdownTimeout must not be negative")
+	}
+	if cfg.BridgeTimeout < 0 {
+		return fmt.Errorf("bridgeTimeout must not be negative")
+	}
+	if cfg.ToggleDebounce < 0 {
+		return fmt.Errorf("toggleDebounce must not be negative")
+	}
+	if cfg.IdempotencyKeyTTL < 0 {
+		return fmt.Errorf("idempotencyKeyTtl must not be negative")
+	}
+	if cfg.BridgeRateLimit.LightCommandsPerSecond < 0 || cfg.BridgeRateLimit.GroupCommandsPerSecond < 0 {
+		return fmt.Errorf("bridgeRateLimit rates must not be negative")
+	}
+	if cfg.BridgeRateLimit.QueueSize < 0 {
+		return fmt.Errorf("bridgeRateLimit.queueSize must not be negative")
+	}
+	if cfg.BridgeRetry.MaxAttempts < 0 {
+		return fmt.Errorf("bridgeRetry.maxAttempts must not be negative")
+	}
+	if cfg.BridgeRetry.InitialBackoff < 0 || cfg.BridgeRetry.MaxBackoff < 0 {
+		return fmt.Errorf("bridgeRetry backoff must not be negative")
+	}
+	if err := cfg.Auth.Validate(); err != nil {
+		return fmt.Errorf("auth: %w", err)
+	}
+	if err := cfg.TLS.Validate(cfg.ServerPort); err != nil {
+		return fmt.Errorf("tls: %w", err)
+	}
+	if err := validateRoutines(cfg.Routines); err != nil {
+		return fmt.Errorf("routines: %w", err)
+	}
+	if _, err := cfg.Location(); err != nil {
+		return err
+	}
+	if cfg.Coordinates != nil {
+		if err := cfg.Coordinates.Validate(); err != nil {
+			return fmt.Errorf("coordinates: %w", err)
+		}
+	}
+	if err := validateSchedules(cfg.Schedules, cfg.Routines, cfg.Coordinates); err != nil {
+		return fmt.Errorf("schedules: %w", err)
+	}
+	if !cfg.Daylight.empty() && cfg.Coordinates == nil {
+		return fmt.Errorf("daylight: needs coordinates")
+	}
+	if err := cfg.Daylight.Validate(); err != nil {
+		return fmt.Errorf("daylight: %w", err)
+	}
+	if err := cfg.OnProfiles.Validate(cfg.Coordinates); err != nil {
+		return fmt.Errorf("onProfiles: %w", err)
+	}
+	if err := cfg.Transitions.Validate(); err != nil {
+		return fmt.Errorf("transitions: %w", err)
+	}
+	if err := cfg.Dimming.Validate(); err != nil {
+		return fmt.Errorf("dimming: %w", err)
+	}
+	if err := cfg.TogglePolicies.Validate(); err != nil {
+		return fmt.Errorf("togglePolicies: %w", err)
+	}
+	if err := cfg.Restore.Validate(); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
 	return nil
 }
+
+// Validate checks the HTTPS listener settings against the plain HTTP port.
+func (tls TLS) Validate(serverPort int) error {
+	if tls.Port == 0 {
+		if tls.DisableHTTP {
+			return fmt.Errorf("disableHttp requires an HTTPS port")
+		}
+		return nil
+	}
+	if tls.Port < 0 || tls.Port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535")
+	}
+	if tls.Port == serverPort && !tls.DisableHTTP {
+		return fmt.Errorf("port must differ from serverPort")
+	}
+	if !tls.SelfSigned && (tls.CertFile == "" || tls.KeyFile == "") {
+		return fmt.Errorf("certFile and keyFile are required unless selfSigned is enabled")
+	}
+	return nil
+}
+
+// Validate checks that tokens are unique, networks are valid IPs or CIDR ranges
+// and tokenless plain HTTP access is limited to allowed networks.
+func (auth Auth) Validate() error {
+	seen := map[string]struct{}{}
+	for i, token := range auth.Tokens {
+		if token.Token == "" {
+			return fmt.Errorf("token %d has no value", i)
+		}
+		if _, exists := seen[token.Token]; exists {
+			return fmt.Errorf("token %q is configured more than once", token.Name)
+		}
+		seen[token.Token] = struct{}{}
+	}
+	for _, network := range auth.AllowedNetworks {
+		if _, err := ParseNetwork(network); err != nil {
+			return err
+		}
+	}
+	if len(auth.PlainHTTPActions) > 0 && len(auth.AllowedNetworks) == 0 {
+		return fmt.Errorf("plainHttpActions requires allowedNetworks")
+	}
+	return nil
+}
+
+// ParseNetwork parses a CIDR range or a single IP address into a prefix.
+func ParseNetwork(network string) (netip.Prefix, error) {
+	network = strings.TrimSpace(network)
+	if strings.Contains(network, "/") {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid network %q: must be an IP address or CIDR range", network)
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(network)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid network %q: must be an IP address or CIDR range", network)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestLoadValidConfig(t *testing.T) {
@@ -41,6 +42,66 @@ func TestLoadValidConfig(t *testing.T) {
 	}
 }
 
+func TestLoadAppliesDefaults(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "config.json")
+	content := `{"hueUser": "test-user", "serverPort": 8090}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write test config: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.ShutdownTimeout.Duration() != defaultShutdownTimeout {
+		t.Fatalf("ShutdownTimeout = %v, want %v", cfg.ShutdownTimeout.Duration(), defaultShutdownTimeout)
+	}
+	if cfg.BridgeTimeout.Duration() != defaultBridgeTimeout {
+		t.Fatalf("BridgeTimeout = %v, want %v", cfg.BridgeTimeout.Duration(), defaultBridgeTimeout)
+	}
+}
+
+func TestLoadDuration(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "config.json")
+	content := `{"hueUser": "test-user", "serverPort": 8090, "shutdownTimeout": "2m30s"}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write test config: %v", err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.ShutdownTimeout.Duration() != 150*time.Second {
+		t.Fatalf("ShutdownTimeout = %v, want %v", cfg.ShutdownTimeout.Duration(), 150*time.Second)
+	}
+}
+
+func TestLoadInvalidDuration(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "config.json")
+	content := `{"hueUser": "test-user", "serverPort": 8090, "shutdownTimeout": "soon"}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write test config: %v", err)
+	}
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatalf("Load() error = nil, want non-nil")
+	}
+	if !strings.Contains(err.Error(), "invalid duration") {
+		t.Fatalf("Load() error = %q, want message to contain %q", err.Error(), "invalid duration")
+	}
+}
+
 func TestLoadInvalidJSON(t *testing.T) {
 	t.Parallel()
 
@@ -62,6 +123,7 @@ func TestLoadInvalidJSON(t *testing.T) {
 func TestValidate(t *testing.T) {
 	t.Parallel()
 
+	nightLevel, fullLevel := 20.0, 100.0
 	tests := []struct {
 		name    string
 		cfg     Config
@@ -82,11 +144,264 @@ func TestValidate(t *testing.T) {
 			},
 			wantErr: "serverPort must be between 1 and 65535",
 		},
+		{
+			name: "duplicate token",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				Auth: Auth{Tokens: []APIToken{
+					{Name: "a", Token: "secret"},
+					{Name: "b", Token: "secret"},
+				}},
+			},
+			wantErr: `auth: token "b" is configured more than once`,
+		},
+		{
+			name: "invalid network",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				Auth:       Auth{AllowedNetworks: []string{"192.168.1.0/33"}},
+			},
+			wantErr: `auth: invalid network "192.168.1.0/33": must be an IP address or CIDR range`,
+		},
+		{
+			name: "tls port clashes with http port",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				TLS:        TLS{Port: 8090, SelfSigned: true},
+			},
+			wantErr: "tls: port must differ from serverPort",
+		},
+		{
+			name: "tls without certificate",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				TLS:        TLS{Port: 8443},
+			},
+			wantErr: "tls: certFile and keyFile are required unless selfSigned is enabled",
+		},
+		{
+			name: "plain http actions without allowed networks",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				Auth:       Auth{PlainHTTPActions: []string{"toggle"}},
+			},
+			wantErr: "auth: plainHttpActions requires allowedNetworks",
+		},
+		{
+			name: "http disabled without tls",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				TLS:        TLS{DisableHTTP: true},
+			},
+			wantErr: "tls: disableHttp requires an HTTPS port",
+		},
+		{
+			name: "duplicate routine",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				Routines: []Routine{
+					{Name: "leave", Steps: []RoutineStep{{Action: RoutineActionOff, Room: "Kitchen"}}},
+					{Name: "leave", Steps: []RoutineStep{{Action: RoutineActionOff, Room: "Hall"}}},
+				},
+			},
+			wantErr: `routines: routine "leave" is configured more than once`,
+		},
+		{
+			name: "routine step without target",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				Routines: []Routine{
+					{Name: "leave", Steps: []RoutineStep{{Action: RoutineActionOn}}},
+				},
+			},
+			wantErr: `routines: routine "leave" step 0: on needs exactly one of room, zone or light`,
+		},
+		{
+			name: "routine step with relative url",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				Routines: []Routine{
+					{Name: "leave", Steps: []RoutineStep{{Action: RoutineActionURL, URL: "/notify"}}},
+				},
+			},
+			wantErr: `routines: routine "leave" step 0: url "/notify" must be an absolute http or https URL`,
+		},
+		{
+			name: "invalid timezone",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				Timezone:   "Mars/Olympus_Mons",
+			},
+			wantErr: `invalid timezone "Mars/Olympus_Mons": unknown time zone Mars/Olympus_Mons`,
+		},
+		{
+			name: "schedule with invalid cron",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				Schedules:  []Schedule{{Name: "porch", Cron: "0 25 * * *", Routine: "movie"}},
+			},
+			wantErr: `schedules: schedule "porch": cron expression "0 25 * * *": hour must be between 0 and 23, got "25"`,
+		},
+		{
+			name: "schedule with unknown routine",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				Schedules:  []Schedule{{Name: "porch", Cron: "@daily", Routine: "movie"}},
+			},
+			wantErr: `schedules: schedule "porch": unknown routine "movie"`,
+		},
+		{
+			name: "sun schedule without coordinates",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				Routines:   []Routine{{Name: "porch", Steps: []RoutineStep{{Action: RoutineActionOn, Room: "Porch"}}}},
+				Schedules:  []Schedule{{Name: "porch", At: "sunset-30m", Routine: "porch"}},
+			},
+			wantErr: `schedules: schedule "porch": at needs coordinates`,
+		},
+		{
+			name: "schedule with cron and at",
+			cfg: Config{
+				HueUser:     "abc",
+				ServerPort:  8090,
+				Coordinates: &Coordinates{Latitude: 52.5, Longitude: 13.4},
+				Schedules:   []Schedule{{Name: "porch", Cron: "@daily", At: "sunset", Action: &RoutineStep{Action: RoutineActionOn, Room: "Porch"}}},
+			},
+			wantErr: `schedules: schedule "porch" needs either cron or at`,
+		},
+		{
+			name: "daylight without coordinates",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				Daylight:   Daylight{Rooms: map[string]DaylightLevels{"Hallway": {}}},
+			},
+			wantErr: "daylight: needs coordinates",
+		},
+		{
+			name: "daylight light by name",
+			cfg: Config{
+				HueUser:     "abc",
+				ServerPort:  8090,
+				Coordinates: &Coordinates{Latitude: 52.5, Longitude: 13.4},
+				Daylight:    Daylight{Lights: map[string]DaylightLevels{"Desk": {}}},
+			},
+			wantErr: `daylight: light "Desk" must be a numeric light id`,
+		},
+		{
+			name: "profile with sun-relative period without coordinates",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				OnProfiles: OnProfiles{Profiles: map[string][]ProfilePeriod{"evening": {{From: "sunset"}}}},
+			},
+			wantErr: `onProfiles: profile "evening" period 0: from "sunset" must be a time like 20:00, or sun-relative with coordinates`,
+		},
+		{
+			name: "profile with colour temperature out of range",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				OnProfiles: OnProfiles{Profiles: map[string][]ProfilePeriod{"warm": {{From: "20:00", ColorTemperature: 1500}}}},
+			},
+			wantErr: `onProfiles: profile "warm" period 0: colorTemperature must be between 2000 and 6500`,
+		},
+		{
+			name: "room with unknown profile",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				OnProfiles: OnProfiles{Rooms: map[string]string{"Kitchen": "warm"}},
+			},
+			wantErr: `onProfiles: room "Kitchen" uses unknown profile "warm"`,
+		},
+		{
+			name: "transition too long",
+			cfg: Config{
+				HueUser:     "abc",
+				ServerPort:  8090,
+				Restore:     Restore{Default: RestorePrevious, Rooms: map[string]string{"Living room": RestoreSnapshot}},
+				Transitions: Transitions{Rooms: map[string]Duration{"Bedroom": Duration(2 * time.Hour)}},
+			},
+			wantErr: `transitions: room "Bedroom": transition must be between 0 and 1h0m0s, got 2h0m0s`,
+		},
+		{
+			name: "negative dimming ramp",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				Dimming:    Dimming{RampDuration: Duration(-time.Second)},
+			},
+			wantErr: "dimming: rampDuration: must be between 0 and 5m0s, got -1s",
+		},
+		{
+			name: "unknown toggle policy",
+			cfg: Config{
+				HueUser:        "abc",
+				ServerPort:     8090,
+				TogglePolicies: TogglePolicies{Rooms: map[string]string{"Kitchen": "all-off"}},
+			},
+			wantErr: `togglePolicies: room "Kitchen": unknown toggle policy "all-off", want any-on, all-on or majority`,
+		},
+		{
+			name: "unknown restore mode",
+			cfg: Config{
+				HueUser:    "abc",
+				ServerPort: 8090,
+				Restore:    Restore{Lights: map[string]string{"3": "last"}},
+			},
+			wantErr: `restore: light "3": unknown restore mode "last", want full, previous or snapshot`,
+		},
 		{
 			name: "valid",
 			cfg: Config{
 				HueUser:    "abc",
 				ServerPort: 8090,
+				TLS:        TLS{Port: 8443, SelfSigned: true},
+				Auth: Auth{
+					Tokens:          []APIToken{{Name: "a", Token: "secret"}},
+					AllowedNetworks: []string{"192.168.1.0/24", "fd00::1"},
+				},
+				Routines: []Routine{{Name: "movie", Steps: []RoutineStep{
+					{Action: RoutineActionScene, Room: "Living room", Scene: "Relax"},
+					{Action: RoutineActionDelay, Delay: Duration(time.Second)},
+					{Action: RoutineActionOff, Zone: "Downstairs"},
+					{Action: RoutineActionURL, URL: "http://192.168.1.30/relay/0?turn=off"},
+				}}},
+				Timezone: "Europe/Berlin",
+				Schedules: []Schedule{
+					{Name: "movie night", Cron: "0 20 * * fri", Routine: "movie"},
+					{Name: "porch off", Cron: "30 23 * * *", Action: &RoutineStep{Action: RoutineActionOff, Room: "Porch"}},
+					{Name: "porch on", At: "sunset-30m", Action: &RoutineStep{Action: RoutineActionOn, Room: "Porch"}},
+				},
+				Coordinates: &Coordinates{Latitude: 52.52, Longitude: 13.405},
+				Daylight:    Daylight{Lights: map[string]DaylightLevels{"3": {Night: &nightLevel}}},
+				OnProfiles: OnProfiles{
+					Profiles: map[string][]ProfilePeriod{"evening": {
+						{From: "06:00", Brightness: &fullLevel, ColorTemperature: 4000},
+						{From: "sunset-30m", Brightness: &nightLevel, ColorTemperature: 2700},
+					}},
+					Lights:  map[string]string{"3": "evening"},
+					Default: "evening",
+				},
+				Transitions: Transitions{
+					Default: Duration(400 * time.Millisecond),
+					Lights:  map[string]Duration{"3": Duration(2 * time.Second)},
+					FadeOff: Duration(time.Minute),
+				},
 			},
 		},
 	}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Daylight sets the brightness that toggles switch rooms and lights on with,
+// depending on whether the sun is up. It needs coordinates. Targets without an
+// entry keep the default of full brightness or the restored previous state.
+type Daylight struct {
+	// Rooms maps room names to levels.
+	Rooms map[string]DaylightLevels `json:"rooms"`
+	// Lights maps light ids to levels.
+	Lights map[string]DaylightLevels `json:"lights"`
+}
+
+// DaylightLevels are brightness levels in percent. A nil level keeps the default.
+type DaylightLevels struct {
+	Day   *float64 `json:"day,omitempty"`
+	Night *float64 `json:"night,omitempty"`
+}
+
+// Validate checks the levels and that lights are given by numeric id.
+func (daylight Daylight) Validate() error {
+	for room, levels := range daylight.Rooms {
+		if err := levels.validate(); err != nil {
+			return fmt.Errorf("room %q: %w", room, err)
+		}
+	}
+	for light, levels := range daylight.Lights {
+		if id, err := strconv.Atoi(light); err != nil || id <= 0 {
+			return fmt.Errorf("light %q must be a numeric light id", light)
+		}
+		if err := levels.validate(); err != nil {
+			return fmt.Errorf("light %q: %w", light, err)
+		}
+	}
+	return nil
+}
+
+func (daylight Daylight) empty() bool {
+	return len(daylight.Rooms) == 0 && len(daylight.Lights) == 0
+}
+
+func (levels DaylightLevels) validate() error {
+	for _, level := range []*float64{levels.Day, levels.Night} {
+		if level != nil && (*level < 0 || *level > 100) {
+			return fmt.Errorf("brightness must be between 0 and 100")
+		}
+	}
+	return nil
+}
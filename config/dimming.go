@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const maxDimmingDuration = 5 * time.Minute
+
+// Dimming configures dim-while-held, started by a long press and stopped on release.
+type Dimming struct {
+	// RampDuration is how long a ramp takes across the full brightness range. It defaults to 5s.
+	RampDuration Duration `json:"rampDuration"`
+	// MaxDuration stops a ramp whose release never arrived. It defaults to 10s.
+	MaxDuration Duration `json:"maxDuration"`
+}
+
+// Validate checks the durations. Zero durations are filled in by the defaults.
+func (dimming Dimming) Validate() error {
+	if err := validateDimmingDuration(dimming.RampDuration.Duration()); err != nil {
+		return fmt.Errorf("rampDuration: %w", err)
+	}
+	if err := validateDimmingDuration(dimming.MaxDuration.Duration()); err != nil {
+		return fmt.Errorf("maxDuration: %w", err)
+	}
+	return nil
+}
+
+func validateDimmingDuration(duration time.Duration) error {
+	if duration < 0 || duration > maxDimmingDuration {
+		return fmt.Errorf("must be between 0 and %s, got %s", maxDimmingDuration, duration)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Duration is a time.Duration that is written as a Go duration string (e.g. "300ms", "15s") in config.json.
+type Duration time.Duration
+
+func (duration Duration) Duration() time.Duration {
+	return time.Duration(duration)
+}
+
+func (duration Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(duration).String())
+}
+
+func (duration *Duration) UnmarshalJSON(content []byte) error {
+	var raw string
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return fmt.Errorf("duration must be a string like \"15s\": %w", err)
+	}
+	if raw == "" {
+		*duration = 0
+		return nil
+	}
+
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", raw, err)
+	}
+	*duration = Duration(parsed)
+	return nil
+}
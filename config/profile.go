@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"hueshelly/sun"
+)
+
+// Colour temperatures supported by Hue lights, in Kelvin.
+const (
+	MinColorTemperature = 2000
+	MaxColorTemperature = 6500
+)
+
+// OnProfiles choose the brightness and colour temperature that toggles switch
+// rooms and lights on with, by time of day. Daylight levels take precedence
+// over a profile's brightness.
+type OnProfiles struct {
+	// Profiles maps profile names to their periods.
+	Profiles map[string][]ProfilePeriod `json:"profiles"`
+	// Rooms maps room names to profile names.
+	Rooms map[string]string `json:"rooms"`
+	// Lights maps light ids to profile names.
+	Lights map[string]string `json:"lights"`
+	// Default is the profile of rooms and lights without their own. Empty means none.
+	Default string `json:"default"`
+}
+
+// ProfilePeriod applies from its start until the next period of the profile
+// starts. The last period of a day lasts until the first one of the next day.
+type ProfilePeriod struct {
+	// From is a time of day such as "20:00" or a sun-relative time such as "sunset-30m".
+	From string `json:"from"`
+	// Brightness in percent. Nil keeps the default brightness.
+	Brightness *float64 `json:"brightness,omitempty"`
+	// ColorTemperature in Kelvin. 0 leaves the colour unchanged.
+	ColorTemperature int `json:"colorTemperature,omitempty"`
+}
+
+// Start returns when the period starts on the day of date, in date's location.
+// ok is false when it starts relative to a sunrise or sunset that does not happen that day.
+func (period ProfilePeriod) Start(date time.Time, coordinates *Coordinates) (time.Time, bool, error) {
+	year, month, day := date.Date()
+	if clock, err := time.Parse("15:04", period.From); err == nil {
+		return time.Date(year, month, day, clock.Hour(), clock.Minute(), 0, 0, date.Location()), true, nil
+	}
+	if coordinates == nil {
+		return time.Time{}, false, fmt.Errorf("from %q must be a time like 20:00, or sun-relative with coordinates", period.From)
+	}
+	trigger, err := sun.ParseTrigger(period.From, coordinates.Latitude, coordinates.Longitude)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("from %q must be a time like 20:00 or sun-relative: %w", period.From, err)
+	}
+
+	times := sun.On(time.Date(year, month, day, 12, 0, 0, 0, date.Location()), coordinates.Latitude, coordinates.Longitude)
+	event := times.Sunset
+	if trigger.Event == sun.Sunrise {
+		event = times.Sunrise
+	}
+	if event.IsZero() {
+		return time.Time{}, false, nil
+	}
+	return event.Add(trigger.Offset), true, nil
+}
+
+// Validate checks the periods and that every assigned profile exists.
+func (profiles OnProfiles) Validate(coordinates *Coordinates) error {
+	for name, periods := range profiles.Profiles {
+		if len(periods) == 0 {
+			return fmt.Errorf("profile %q has no periods", name)
+		}
+		for i, period := range periods {
+			if _, _, err := period.Start(time.Now(), coordinates); err != nil {
+				return fmt.Errorf("profile %q period %d: %w", name, i, err)
+			}
+			if period.Brightness != nil && (*period.Brightness < 0 || *period.Brightness > 100) {
+				return fmt.Errorf("profile %q period %d: brightness must be between 0 and 100", name, i)
+			}
+			if period.ColorTemperature != 0 && (period.ColorTemperature < MinColorTemperature || period.ColorTemperature > MaxColorTemperature) {
+				return fmt.Errorf("profile %q period %d: colorTemperature must be between %d and %d", name, i, MinColorTemperature, MaxColorTemperature)
+			}
+		}
+	}
+
+	if err := profiles.checkAssigned("default", profiles.Default); profiles.Default != "" && err != nil {
+		return err
+	}
+	for room, profile := range profiles.Rooms {
+		if err := profiles.checkAssigned(fmt.Sprintf("room %q", room), profile); err != nil {
+			return err
+		}
+	}
+	for light, profile := range profiles.Lights {
+		if id, err := strconv.Atoi(light); err != nil || id <= 0 {
+			return fmt.Errorf("light %q must be a numeric light id", light)
+		}
+		if err := profiles.checkAssigned(fmt.Sprintf("light %q", light), profile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (profiles OnProfiles) checkAssigned(target, profile string) error {
+	if _, exists := profiles.Profiles[profile]; !exists {
+		return fmt.Errorf("%s uses unknown profile %q", target, profile)
+	}
+	return nil
+}
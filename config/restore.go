@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Restore modes decide what a toggle switches a room or light on with.
+const (
+	// RestoreFull switches on at full brightness.
+	RestoreFull = "full"
+	// RestorePrevious lets the bridge restore the last brightness and colour it knows.
+	RestorePrevious = "previous"
+	// RestoreSnapshot restores the on state, brightness, colour and effect of
+	// every light as hueshelly saw them when the target was last switched off,
+	// by any route. A snapshot is restored once.
+	RestoreSnapshot = "snapshot"
+)
+
+// Restore sets the restore mode per room and light. Targets without a mode
+// follow Default, or restorePreviousLightState when Default is empty.
+type Restore struct {
+	Default string `json:"default"`
+	// Rooms maps room names to restore modes.
+	Rooms map[string]string `json:"rooms"`
+	// Lights maps light ids to restore modes.
+	Lights map[string]string `json:"lights"`
+}
+
+// Mode returns the restore mode of a target. targetType is "light" or "room".
+func (restore Restore) Mode(targetType, target string, restorePreviousLightState bool) string {
+	modes := restore.Rooms
+	if targetType == "light" {
+		modes = restore.Lights
+	}
+	if mode, exists := modes[target]; exists {
+		return mode
+	}
+	if restore.Default != "" {
+		return restore.Default
+	}
+	if restorePreviousLightState {
+		return RestorePrevious
+	}
+	return RestoreFull
+}
+
+// Validate checks the modes and that lights are given by numeric id.
+func (restore Restore) Validate() error {
+	if restore.Default != "" {
+		if err := validateRestoreMode(restore.Default); err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+	}
+	for room, mode := range restore.Rooms {
+		if err := validateRestoreMode(mode); err != nil {
+			return fmt.Errorf("room %q: %w", room, err)
+		}
+	}
+	for light, mode := range restore.Lights {
+		if id, err := strconv.Atoi(light); err != nil || id <= 0 {
+			return fmt.Errorf("light %q must be a numeric light id", light)
+		}
+		if err := validateRestoreMode(mode); err != nil {
+			return fmt.Errorf("light %q: %w", light, err)
+		}
+	}
+	return nil
+}
+
+func validateRestoreMode(mode string) error {
+	switch mode {
+	case RestoreFull, RestorePrevious, RestoreSnapshot:
+		return nil
+	}
+	return fmt.Errorf("unknown restore mode %q, want %s, %s or %s", mode, RestoreFull, RestorePrevious, RestoreSnapshot)
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Actions of routine steps.
+const (
+	RoutineActionOn         = "on"
+	RoutineActionOff        = "off"
+	RoutineActionToggle     = "toggle"
+	RoutineActionBrightness = "brightness"
+	RoutineActionScene      = "scene"
+	RoutineActionDelay      = "delay"
+	RoutineActionURL        = "url"
+)
+
+// Routine is a named, ordered list of steps.
+type Routine struct {
+	Name  string        `json:"name"`
+	Steps []RoutineStep `json:"steps"`
+	// ContinueOnError runs the remaining steps after a step failed.
+	ContinueOnError bool `json:"continueOnError"`
+}
+
+// RoutineStep is one step of a routine. Action selects which other fields are used:
+// on, off, toggle and brightness need exactly one of Room, Zone or Light; scene needs
+// Scene and a Room or Zone; delay needs Delay; url needs URL.
+type RoutineStep struct {
+	Action     string   `json:"action"`
+	Room       string   `json:"room,omitempty"`
+	Zone       string   `json:"zone,omitempty"`
+	Light      int      `json:"light,omitempty"`
+	Brightness *float64 `json:"brightness,omitempty"`
+	// Transition overrides the configured transition time of on, off, toggle
+	// and brightness steps; an off step with a long transition fades out.
+	Transition Duration `json:"transition,omitempty"`
+	// Scene is the id or name of a scene of Room or Zone.
+	Scene string   `json:"scene,omitempty"`
+	Delay Duration `json:"delay,omitempty"`
+	URL   string   `json:"url,omitempty"`
+	// Method is the HTTP method of a url step. It defaults to GET.
+	Method string `json:"method,omitempty"`
+}
+
+// Target describes what a step acts on, e.g. `room "Kitchen"`.
+func (step RoutineStep) Target() string {
+	switch {
+	case step.Room != "":
+		return fmt.Sprintf("room %q", step.Room)
+	case step.Zone != "":
+		return fmt.Sprintf("zone %q", step.Zone)
+	case step.Light != 0:
+		return fmt.Sprintf("light %d", step.Light)
+	case step.URL != "":
+		return step.URL
+	}
+	return ""
+}
+
+func validateRoutines(routines []Routine) error {
+	seen := map[string]struct{}{}
+	for _, routine := range routines {
+		if strings.TrimSpace(routine.Name) == "" || strings.Contains(routine.Name, "/") {
+			return fmt.Errorf("routine name %q must not be empty or contain '/'", routine.Name)
+		}
+		if _, exists := seen[routine.Name]; exists {
+			return fmt.Errorf("routine %q is configured more than once", routine.Name)
+		}
+		seen[routine.Name] = struct{}{}
+
+		if len(routine.Steps) == 0 {
+			return fmt.Errorf("routine %q has no steps", routine.Name)
+		}
+		for i, step := range routine.Steps {
+			if err := step.validate(); err != nil {
+				return fmt.Errorf("routine %q step %d: %w", routine.Name, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (step RoutineStep) validate() error {
+	targets := 0
+	for _, set := range []bool{step.Room != "", step.Zone != "", step.Light != 0} {
+		if set {
+			targets++
+		}
+	}
+
+	switch step.Action {
+	case RoutineActionOn, RoutineActionOff, RoutineActionToggle, RoutineActionBrightness:
+		if targets != 1 {
+			return fmt.Errorf("%s needs exactly one of room, zone or light", step.Action)
+		}
+		if step.Light < 0 {
+			return fmt.Errorf("light must be positive")
+		}
+		if step.Action == RoutineActionBrightness && step.Brightness == nil {
+			return fmt.Errorf("brightness needs a brightness")
+		}
+		if step.Brightness != nil && (*step.Brightness < 0 || *step.Brightness > 100) {
+			return fmt.Errorf("brightness must be between 0 and 100")
+		}
+		if err := ValidateTransition(step.Transition.Duration()); err != nil {
+			return err
+		}
+	case RoutineActionScene:
+		if step.Scene == "" || targets != 1 || step.Light != 0 {
+			return fmt.Errorf("scene needs a scene and exactly one of room or zone")
+		}
+	case RoutineActionDelay:
+		if step.Delay <= 0 {
+			return fmt.Errorf("delay must be positive")
+		}
+	case RoutineActionURL:
+		target, err := url.Parse(step.URL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return fmt.Errorf("url %q must be an absolute http or https URL", step.URL)
+		}
+	default:
+		return fmt.Errorf("unknown action %q", step.Action)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"hueshelly/cron"
+	"hueshelly/sun"
+)
+
+// Schedule runs a routine or a single action at the times of a cron expression
+// or daily relative to sunrise or sunset.
+type Schedule struct {
+	Name string `json:"name"`
+	// Cron is a five-field cron expression evaluated in the configured timezone.
+	Cron string `json:"cron,omitempty"`
+	// At is a sun-relative time such as "sunset-30m", used instead of Cron.
+	At string `json:"at,omitempty"`
+	// Enabled defaults to true. Disabled schedules start paused and can be resumed at runtime.
+	Enabled *bool  `json:"enabled,omitempty"`
+	Routine string `json:"routine,omitempty"`
+	// Action is a single routine step, used instead of Routine.
+	Action *RoutineStep `json:"action,omitempty"`
+}
+
+// IsEnabled reports whether the schedule starts active.
+func (schedule Schedule) IsEnabled() bool {
+	return schedule.Enabled == nil || *schedule.Enabled
+}
+
+// Location returns the time zone of schedules and time-of-day settings, which
+// is the local time zone unless Timezone names an IANA zone.
+func (cfg Config) Location() (*time.Location, error) {
+	if cfg.Timezone == "" {
+		return time.Local, nil
+	}
+	location, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", cfg.Timezone, err)
+	}
+	return location, nil
+}
+
+// Coordinates locate the home for sunrise and sunset, in degrees. North and east are positive.
+type Coordinates struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Validate checks that the coordinates are on the globe.
+func (coordinates Coordinates) Validate() error {
+	if coordinates.Latitude < -90 || coordinates.Latitude > 90 {
+		return fmt.Errorf("latitude must be between -90 and 90")
+	}
+	if coordinates.Longitude < -180 || coordinates.Longitude > 180 {
+		return fmt.Errorf("longitude must be between -180 and 180")
+	}
+	return nil
+}
+
+func validateSchedules(schedules []Schedule, routines []Routine, coordinates *Coordinates) error {
+	names := map[string]struct{}{}
+	for _, routine := range routines {
+		names[routine.Name] = struct{}{}
+	}
+
+	seen := map[string]struct{}{}
+	for _, schedule := range schedules {
+		if strings.TrimSpace(schedule.Name) == "" || strings.Contains(schedule.Name, "/") {
+			return fmt.Errorf("schedule name %q must not be empty or contain '/'", schedule.Name)
+		}
+		if _, exists := seen[schedule.Name]; exists {
+			return fmt.Errorf("schedule %q is configured more than once", schedule.Name)
+		}
+		seen[schedule.Name] = struct{}{}
+
+		switch {
+		case (schedule.Cron == "") == (schedule.At == ""):
+			return fmt.Errorf("schedule %q needs either cron or at", schedule.Name)
+		case schedule.At != "":
+			if coordinates == nil {
+				return fmt.Errorf("schedule %q: at needs coordinates", schedule.Name)
+			}
+			if _, err := sun.ParseTrigger(schedule.At, coordinates.Latitude, coordinates.Longitude); err != nil {
+				return fmt.Errorf("schedule %q: %w", schedule.Name, err)
+			}
+		default:
+			if _, err := cron.Parse(schedule.Cron); err != nil {
+				return fmt.Errorf("schedule %q: %w", schedule.Name, err)
+			}
+		}
+		switch {
+		case (schedule.Routine == "") == (schedule.Action == nil):
+			return fmt.Errorf("schedule %q needs either a routine or an action", schedule.Name)
+		case schedule.Action != nil:
+			if schedule.Action.Action == RoutineActionDelay {
+				return fmt.Errorf("schedule %q: action must not be a delay", schedule.Name)
+			}
+			if err := schedule.Action.validate(); err != nil {
+				return fmt.Errorf("schedule %q: %w", schedule.Name, err)
+			}
+		default:
+			if _, exists := names[schedule.Routine]; !exists {
+				return fmt.Errorf("schedule %q: unknown routine %q", schedule.Name, schedule.Routine)
+			}
+		}
+	}
+	return nil
+}
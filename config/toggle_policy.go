@@ -0,0 +1,55 @@
+package config
+
+import "fmt"
+
+// Toggle policies decide when toggling a room switches it off rather than on.
+const (
+	// TogglePolicyAnyOn switches the room off when any of its lights is on.
+	TogglePolicyAnyOn = "any-on"
+	// TogglePolicyAllOn switches the room off only when all its lights are on.
+	TogglePolicyAllOn = "all-on"
+	// TogglePolicyMajority switches the room off when more than half of its lights are on.
+	TogglePolicyMajority = "majority"
+)
+
+// TogglePolicies choose the toggle policy per room.
+type TogglePolicies struct {
+	// Default applies to rooms without their own policy. It defaults to any-on.
+	Default string `json:"default"`
+	// Rooms maps room names to policies.
+	Rooms map[string]string `json:"rooms"`
+}
+
+// Policy returns the toggle policy of a room.
+func (policies TogglePolicies) Policy(room string) string {
+	if policy, exists := policies.Rooms[room]; exists {
+		return policy
+	}
+	if policies.Default != "" {
+		return policies.Default
+	}
+	return TogglePolicyAnyOn
+}
+
+// Validate checks that every policy is known.
+func (policies TogglePolicies) Validate() error {
+	if policies.Default != "" {
+		if err := validateTogglePolicy(policies.Default); err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+	}
+	for room, policy := range policies.Rooms {
+		if err := validateTogglePolicy(policy); err != nil {
+			return fmt.Errorf("room %q: %w", room, err)
+		}
+	}
+	return nil
+}
+
+func validateTogglePolicy(policy string) error {
+	switch policy {
+	case TogglePolicyAnyOn, TogglePolicyAllOn, TogglePolicyMajority:
+		return nil
+	}
+	return fmt.Errorf("unknown toggle policy %q, want %s, %s or %s", policy, TogglePolicyAnyOn, TogglePolicyAllOn, TogglePolicyMajority)
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// MaxTransition is the longest transition a state change may ask for.
+const MaxTransition = time.Hour
+
+// Transitions set how long lights take to reach a new state. Targets without
+// an entry use Default; a zero transition switches at the bridge's default speed.
+type Transitions struct {
+	Default Duration `json:"default"`
+	// Rooms maps room names to transitions.
+	Rooms map[string]Duration `json:"rooms"`
+	// Lights maps light ids to transitions.
+	Lights map[string]Duration `json:"lights"`
+	// FadeOff is how long the fade-off routes take unless ?over= is given. It defaults to one minute.
+	FadeOff Duration `json:"fadeOff"`
+}
+
+// Validate checks the durations and that lights are given by numeric id.
+func (transitions Transitions) Validate() error {
+	if err := ValidateTransition(transitions.Default.Duration()); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	if err := ValidateTransition(transitions.FadeOff.Duration()); err != nil {
+		return fmt.Errorf("fadeOff: %w", err)
+	}
+	for room, transition := range transitions.Rooms {
+		if err := ValidateTransition(transition.Duration()); err != nil {
+			return fmt.Errorf("room %q: %w", room, err)
+		}
+	}
+	for light, transition := range transitions.Lights {
+		if id, err := strconv.Atoi(light); err != nil || id <= 0 {
+			return fmt.Errorf("light %q must be a numeric light id", light)
+		}
+		if err := ValidateTransition(transition.Duration()); err != nil {
+			return fmt.Errorf("light %q: %w", light, err)
+		}
+	}
+	return nil
+}
+
+// ValidateTransition checks that a transition lies between 0 and MaxTransition.
+func ValidateTransition(transition time.Duration) error {
+	if transition < 0 || transition > MaxTransition {
+		return fmt.Errorf("transition must be between 0 and %s, got %s", MaxTransition, transition)
+	}
+	return nil
+}
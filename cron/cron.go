@@ -0,0 +1,205 @@
+// Package cron parses five-field cron expressions and computes their next run
+// time in a time zone.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchYears bounds the search for the next run, e.g. for "0 0 30 2 *", which never matches.
+const searchYears = 5
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	minutes, hours, days, months, weekdays uint64
+	// anyDay and anyWeekday record a "*" day-of-month or day-of-week field. When
+	// both fields are restricted, a day matching either of them matches, as in Vixie cron.
+	anyDay, anyWeekday bool
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var (
+	minuteField  = field{name: "minute", min: 0, max: 59}
+	hourField    = field{name: "hour", min: 0, max: 23}
+	dayField     = field{name: "day of month", min: 1, max: 31}
+	monthField   = field{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	weekdayField = field{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses "minute hour day-of-month month day-of-week" or one of the
+// macros @yearly, @monthly, @weekly, @daily and @hourly. Fields accept *,
+// lists, ranges, steps and English month and weekday abbreviations.
+func Parse(expression string) (Schedule, error) {
+	expression = strings.TrimSpace(expression)
+	if macro, ok := macros[strings.ToLower(expression)]; ok {
+		expression = macro
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("cron expression %q must have 5 fields, got %d", expression, len(fields))
+	}
+
+	var schedule Schedule
+	var err error
+	for i, target := range []struct {
+		bits *uint64
+		field
+	}{
+		{&schedule.minutes, minuteField},
+		{&schedule.hours, hourField},
+		{&schedule.days, dayField},
+		{&schedule.months, monthField},
+		{&schedule.weekdays, weekdayField},
+	} {
+		if *target.bits, err = target.parse(fields[i]); err != nil {
+			return Schedule{}, fmt.Errorf("cron expression %q: %w", expression, err)
+		}
+	}
+	// 7 is another name for Sunday.
+	if schedule.weekdays&(1<<7) != 0 {
+		schedule.weekdays = schedule.weekdays&^(1<<7) | 1
+	}
+	schedule.anyDay = strings.HasPrefix(fields[2], "*")
+	schedule.anyWeekday = strings.HasPrefix(fields[4], "*")
+	return schedule, nil
+}
+
+func (f field) parse(expression string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(expression, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepPart, f.name)
+			}
+		}
+
+		low, high := f.min, f.max
+		if rangePart != "*" {
+			first, last, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = f.value(first); err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				if high, err = f.value(last); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				high = f.max
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid range %q in %s field", rangePart, f.name)
+			}
+		}
+		for value := low; value <= high; value += step {
+			set |= 1 << value
+		}
+	}
+	return set, nil
+}
+
+func (f field) value(raw string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(raw, name) {
+			return i + f.min, nil
+		}
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < f.min || value > f.max {
+		return 0, fmt.Errorf("%s must be between %d and %d, got %q", f.name, f.min, f.max, raw)
+	}
+	return value, nil
+}
+
+// Next returns the first time after after at which the schedule fires, in
+// location, or the zero time if there is none within the next years.
+//
+// Times are matched against the wall clock of location. A time skipped by a
+// daylight saving change does not fire that day, and a time that occurs twice
+// fires only at its first occurrence.
+func (schedule Schedule) Next(after time.Time, location *time.Location) time.Time {
+	after = after.In(location)
+	year, month, day := after.Date()
+	limit := time.Date(year+searchYears, month, day, 0, 0, 0, 0, location)
+
+	for date := time.Date(year, month, day, 12, 0, 0, 0, location); date.Before(limit); date = date.AddDate(0, 0, 1) {
+		if !schedule.matchesDay(date) {
+			continue
+		}
+		for hour := range 24 {
+			if schedule.hours&(1<<hour) == 0 {
+				continue
+			}
+			for minute := range 60 {
+				if schedule.minutes&(1<<minute) == 0 {
+					continue
+				}
+				candidate := time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, location)
+				if candidate.Hour() != hour || candidate.Minute() != minute {
+					// The wall clock time does not exist on this day.
+					continue
+				}
+				candidate = firstOccurrence(candidate)
+				if candidate.After(after) {
+					return candidate
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
+
+func (schedule Schedule) matchesDay(date time.Time) bool {
+	if schedule.months&(1<<int(date.Month())) == 0 {
+		return false
+	}
+	dayMatches := schedule.days&(1<<date.Day()) != 0
+	weekdayMatches := schedule.weekdays&(1<<int(date.Weekday())) != 0
+	switch {
+	case schedule.anyDay && schedule.anyWeekday:
+		return true
+	case schedule.anyDay:
+		return weekdayMatches
+	case schedule.anyWeekday:
+		return dayMatches
+	default:
+		return dayMatches || weekdayMatches
+	}
+}
+
+// firstOccurrence returns the earlier instant when the wall clock time of t
+// occurs twice because clocks were set back; time.Date picks the later one.
+func firstOccurrence(t time.Time) time.Time {
+	_, offset := t.Zone()
+	_, earlierOffset := t.Add(-3 * time.Hour).Zone()
+	if earlierOffset <= offset {
+		return t
+	}
+	earlier := t.Add(-time.Duration(earlierOffset-offset) * time.Second)
+	if earlier.Hour() == t.Hour() && earlier.Minute() == t.Minute() {
+		return earlier
+	}
+	return t
+}
@@ -0,0 +1,129 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, expression := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@every 5m",
+	} {
+		if _, err := Parse(expression); err == nil {
+			t.Fatalf("Parse(%q) error = nil, want error", expression)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	t.Parallel()
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("LoadLocation() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		expression string
+		after      time.Time
+		want       time.Time
+	}{
+		{
+			name:       "every five minutes",
+			expression: "*/5 * * * *",
+			after:      time.Date(2026, 6, 1, 10, 2, 30, 0, berlin),
+			want:       time.Date(2026, 6, 1, 10, 5, 0, 0, berlin),
+		},
+		{
+			name:       "exact match is not after",
+			expression: "0 7 * * *",
+			after:      time.Date(2026, 6, 1, 7, 0, 0, 0, berlin),
+			want:       time.Date(2026, 6, 2, 7, 0, 0, 0, berlin),
+		},
+		{
+			name:       "weekdays by name",
+			expression: "30 6 * * mon-fri",
+			after:      time.Date(2026, 6, 5, 7, 0, 0, 0, berlin), // Friday
+			want:       time.Date(2026, 6, 8, 6, 30, 0, 0, berlin),
+		},
+		{
+			name:       "sunday as 7",
+			expression: "0 9 * * 7",
+			after:      time.Date(2026, 6, 1, 0, 0, 0, 0, berlin),
+			want:       time.Date(2026, 6, 7, 9, 0, 0, 0, berlin),
+		},
+		{
+			name:       "day of month or day of week",
+			expression: "0 0 15 * fri",
+			after:      time.Date(2026, 6, 6, 0, 0, 0, 0, berlin),
+			want:       time.Date(2026, 6, 12, 0, 0, 0, 0, berlin),
+		},
+		{
+			name:       "macro",
+			expression: "@monthly",
+			after:      time.Date(2026, 6, 10, 0, 0, 0, 0, berlin),
+			want:       time.Date(2026, 7, 1, 0, 0, 0, 0, berlin),
+		},
+		{
+			name:       "leap day",
+			expression: "0 12 29 2 *",
+			after:      time.Date(2026, 3, 1, 0, 0, 0, 0, berlin),
+			want:       time.Date(2028, 2, 29, 12, 0, 0, 0, berlin),
+		},
+		{
+			name:       "never",
+			expression: "0 0 30 2 *",
+			after:      time.Date(2026, 3, 1, 0, 0, 0, 0, berlin),
+		},
+		{
+			name:       "wall clock across spring forward",
+			expression: "0 7 * * *",
+			after:      time.Date(2026, 3, 28, 7, 0, 0, 0, berlin),
+			want:       time.Date(2026, 3, 29, 7, 0, 0, 0, berlin),
+		},
+		{
+			name:       "skipped time does not fire",
+			expression: "30 2 * * *",
+			after:      time.Date(2026, 3, 29, 0, 0, 0, 0, berlin),
+			want:       time.Date(2026, 3, 30, 2, 30, 0, 0, berlin),
+		},
+		{
+			name:       "repeated time fires at first occurrence",
+			expression: "30 2 * * *",
+			after:      time.Date(2026, 10, 25, 0, 0, 0, 0, berlin),
+			want:       time.Date(2026, 10, 25, 0, 30, 0, 0, time.UTC),
+		},
+		{
+			name:       "repeated time fires once",
+			expression: "30 2 * * *",
+			after:      time.Date(2026, 10, 25, 0, 30, 0, 0, time.UTC),
+			want:       time.Date(2026, 10, 26, 2, 30, 0, 0, berlin),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			schedule, err := Parse(tt.expression)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.expression, err)
+			}
+			if got := schedule.Next(tt.after, berlin); !got.Equal(tt.want) {
+				t.Fatalf("Next(%v) = %v, want %v", tt.after, got, tt.want)
+			}
+		})
+	}
+}
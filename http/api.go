@@ -0,0 +1,347 @@
+package huehttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"hueshelly/hue"
+)
+
+const maxRequestBodyBytes = 64 << 10
+
+// sceneStateRequest is the body of PUT /api/v1/scenes/{id}/state.
+type sceneStateRequest struct {
+	// Action is "active" (the default), "static" or "dynamic_palette".
+	Action string `json:"action"`
+}
+
+// registerAPIRoutes registers the versioned REST API. Rooms, zones and scenes are
+// addressed by their bridge resource id, lights by their numeric id. Scoped
+// tokens only see the targets they may control; the lights of a room or zone
+// count as targets of a token scoped to it.
+func (handler *Handler) registerAPIRoutes() {
+	mux := handler.mux
+	handler.handle(mux, "GET /api/v1/rooms", actionRead, handler.apiRooms)
+	handler.handle(mux, "GET /api/v1/rooms/{id}", actionRead, handler.apiRoom)
+	handler.handle(mux, "PUT /api/v1/rooms/{id}/state", actionToggle, handler.apiSetRoomState)
+	handler.handle(mux, "GET /api/v1/zones", actionRead, handler.apiZones)
+	handler.handle(mux, "GET /api/v1/zones/{id}", actionRead, handler.apiZone)
+	handler.handle(mux, "PUT /api/v1/zones/{id}/state", actionToggle, handler.apiSetZoneState)
+	handler.handle(mux, "GET /api/v1/lights", actionRead, handler.apiLights)
+	handler.handle(mux, "GET /api/v1/lights/{id}", actionRead, handler.apiLight)
+	handler.handle(mux, "PUT /api/v1/lights/{id}/state", actionToggle, handler.apiSetLightState)
+	handler.handle(mux, "GET /api/v1/scenes", actionRead, handler.apiScenes)
+	handler.handle(mux, "GET /api/v1/scenes/{id}", actionRead, handler.apiScene)
+	handler.handle(mux, "PUT /api/v1/scenes/{id}/state", actionToggle, handler.apiSetSceneState)
+
+	// The home route catches every path, so without this an API request with the
+	// wrong method would get a 404 instead of a 405.
+	routes := http.NewServeMux()
+	for _, pattern := range handler.routes {
+		if _, path, _ := strings.Cut(pattern, " "); strings.HasPrefix(path, "/api/v1/") {
+			routes.HandleFunc(pattern, func(http.ResponseWriter, *http.Request) {})
+		}
+	}
+	// It is not in handler.routes, which must match the spec, but is authenticated like them.
+	mux.Handle("/api/v1/", instrument("/api/v1/", handler.authenticate(actionRead, func(writer http.ResponseWriter, request *http.Request) {
+		handler.apiNoRoute(writer, request, routes)
+	})))
+}
+
+// apiNoRoute answers API requests no route matched: 405 with the allowed
+// methods when the path exists, otherwise 404.
+func (handler *Handler) apiNoRoute(writer http.ResponseWriter, request *http.Request, routes *http.ServeMux) {
+	var allowed []string
+	for _, method := range []string{http.MethodGet, http.MethodHead, http.MethodPut} {
+		probe := *request
+		probe.Method = method
+		if _, pattern := routes.Handler(&probe); pattern != "" {
+			allowed = append(allowed, method)
+		}
+	}
+	if len(allowed) == 0 {
+		handler.writeError(writer, http.StatusNotFound, "endpoint not found")
+		return
+	}
+	writer.Header().Set("Allow", strings.Join(allowed, ", "))
+	handler.writeError(writer, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+func (handler *Handler) apiRooms(writer http.ResponseWriter, request *http.Request) {
+	rooms, err := handler.hueService.Rooms(request.Context())
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	handler.writeJSON(writer, http.StatusOK, visibleGroups(request, rooms))
+}
+
+func (handler *Handler) apiRoom(writer http.ResponseWriter, request *http.Request) {
+	room, err := handler.hueService.Room(request.Context(), request.PathValue("id"))
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	if err := allowRoom(request, room.Name); err != nil {
+		handler.writeError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+	handler.writeJSON(writer, http.StatusOK, room)
+}
+
+func (handler *Handler) apiSetRoomState(writer http.ResponseWriter, request *http.Request) {
+	handler.setGroupState(writer, request, handler.hueService.Room, handler.hueService.SetRoomState)
+}
+
+func (handler *Handler) apiZones(writer http.ResponseWriter, request *http.Request) {
+	zones, err := handler.hueService.Zones(request.Context())
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	handler.writeJSON(writer, http.StatusOK, visibleGroups(request, zones))
+}
+
+func (handler *Handler) apiZone(writer http.ResponseWriter, request *http.Request) {
+	zone, err := handler.hueService.Zone(request.Context(), request.PathValue("id"))
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	if err := allowRoom(request, zone.Name); err != nil {
+		handler.writeError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+	handler.writeJSON(writer, http.StatusOK, zone)
+}
+
+func (handler *Handler) apiSetZoneState(writer http.ResponseWriter, request *http.Request) {
+	handler.setGroupState(writer, request, handler.hueService.Zone, handler.hueService.SetZoneState)
+}
+
+func (handler *Handler) apiLights(writer http.ResponseWriter, request *http.Request) {
+	lights, err := handler.hueService.Lights(request.Context())
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	members, err := handler.scopedRoomLights(request)
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	lights = slices.DeleteFunc(lights, func(light hue.LightDetails) bool {
+		return !members[light.ID] && allowLight(request, light.ID) != nil
+	})
+	handler.writeJSON(writer, http.StatusOK, lights)
+}
+
+func (handler *Handler) apiLight(writer http.ResponseWriter, request *http.Request) {
+	lightID, err := lightIDFromPath(request)
+	if err != nil {
+		handler.writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !handler.authorizeLight(writer, request, lightID) {
+		return
+	}
+	light, err := handler.hueService.Light(request.Context(), lightID)
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	handler.writeJSON(writer, http.StatusOK, light)
+}
+
+func (handler *Handler) apiSetLightState(writer http.ResponseWriter, request *http.Request) {
+	lightID, err := lightIDFromPath(request)
+	if err != nil {
+		handler.writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	var change hue.StateChange
+	if err := decodeJSONBody(writer, request, &change); err != nil {
+		handler.writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !handler.authorizeLight(writer, request, lightID) {
+		return
+	}
+
+	started := time.Now()
+	state, err := handler.hueService.SetLightState(request.Context(), lightID, change)
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	handler.writeJSON(writer, http.StatusOK, stateResponse{State: state, DurationMs: time.Since(started).Milliseconds()})
+}
+
+func (handler *Handler) apiScenes(writer http.ResponseWriter, request *http.Request) {
+	scenes, err := handler.hueService.Scenes(request.Context())
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	scenes = slices.DeleteFunc(scenes, func(scene hue.Scene) bool { return allowRoom(request, scene.GroupName) != nil })
+	handler.writeJSON(writer, http.StatusOK, scenes)
+}
+
+func (handler *Handler) apiScene(writer http.ResponseWriter, request *http.Request) {
+	scene, err := handler.hueService.Scene(request.Context(), request.PathValue("id"))
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	if err := allowRoom(request, scene.GroupName); err != nil {
+		handler.writeError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+	handler.writeJSON(writer, http.StatusOK, scene)
+}
+
+func (handler *Handler) apiSetSceneState(writer http.ResponseWriter, request *http.Request) {
+	id := request.PathValue("id")
+	var body sceneStateRequest
+	if err := decodeJSONBody(writer, request, &body); err != nil {
+		handler.writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	// A scoped token may recall the scenes of the rooms and zones it lists.
+	if targetScoped(tokenFromContext(request.Context())) {
+		scene, err := handler.hueService.Scene(request.Context(), id)
+		if err != nil {
+			handler.writeServiceError(writer, err)
+			return
+		}
+		if err := allowRoom(request, scene.GroupName); err != nil {
+			handler.writeError(writer, http.StatusForbidden, err.Error())
+			return
+		}
+	}
+
+	started := time.Now()
+	state, err := handler.hueService.RecallScene(request.Context(), id, body.Action)
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	handler.writeJSON(writer, http.StatusOK, stateResponse{State: state, DurationMs: time.Since(started).Milliseconds()})
+}
+
+// authorizeLight checks that the request's token may control the light, by
+// id or as a member of a room or zone it may control, and answers the request
+// when it may not.
+func (handler *Handler) authorizeLight(writer http.ResponseWriter, request *http.Request, lightID int) bool {
+	err := allowLight(request, lightID)
+	if err == nil {
+		return true
+	}
+	members, lookupErr := handler.scopedRoomLights(request)
+	if lookupErr != nil {
+		handler.writeServiceError(writer, lookupErr)
+		return false
+	}
+	if members[lightID] {
+		return true
+	}
+	handler.writeError(writer, http.StatusForbidden, err.Error())
+	return false
+}
+
+// scopedRoomLights returns the ids of the lights in the rooms and zones the
+// request's token is scoped to. Tokens without rooms get none.
+func (handler *Handler) scopedRoomLights(request *http.Request) (map[int]bool, error) {
+	token := tokenFromContext(request.Context())
+	if token == nil || len(token.Rooms) == 0 {
+		return nil, nil
+	}
+	rooms, err := handler.hueService.Rooms(request.Context())
+	if err != nil {
+		return nil, err
+	}
+	zones, err := handler.hueService.Zones(request.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	members := map[int]bool{}
+	for _, group := range append(rooms, zones...) {
+		if !slices.Contains(token.Rooms, group.Name) {
+			continue
+		}
+		for _, light := range group.Lights {
+			members[light.ID] = true
+		}
+	}
+	return members, nil
+}
+
+// visibleGroups drops the rooms or zones a scoped token may not control.
+func visibleGroups(request *http.Request, groups []hue.Room) []hue.Room {
+	return slices.DeleteFunc(groups, func(group hue.Room) bool { return allowRoom(request, group.Name) != nil })
+}
+
+// setGroupState handles PUT requests for rooms and zones. Scoped tokens list
+// rooms and zones by name, so the group is looked up before it is changed.
+func (handler *Handler) setGroupState(
+	writer http.ResponseWriter,
+	request *http.Request,
+	lookup func(ctx context.Context, id string) (hue.Room, error),
+	set func(ctx context.Context, id string, change hue.StateChange) (hue.State, error),
+) {
+	id := request.PathValue("id")
+	var change hue.StateChange
+	if err := decodeJSONBody(writer, request, &change); err != nil {
+		handler.writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if targetScoped(tokenFromContext(request.Context())) {
+		group, err := lookup(request.Context(), id)
+		if err != nil {
+			handler.writeServiceError(writer, err)
+			return
+		}
+		if err := allowRoom(request, group.Name); err != nil {
+			handler.writeError(writer, http.StatusForbidden, err.Error())
+			return
+		}
+	}
+
+	started := time.Now()
+	state, err := set(request.Context(), id, change)
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	handler.writeJSON(writer, http.StatusOK, stateResponse{State: state, DurationMs: time.Since(started).Milliseconds()})
+}
+
+func lightIDFromPath(request *http.Request) (int, error) {
+	lightID, err := strconv.Atoi(request.PathValue("id"))
+	if err != nil || lightID <= 0 {
+		return 0, errors.New("given light id is not valid")
+	}
+	return lightID, nil
+}
+
+// decodeJSONBody decodes a JSON object into value. An empty body leaves value unchanged.
+func decodeJSONBody(writer http.ResponseWriter, request *http.Request, value any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(writer, request.Body, maxRequestBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(value); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	if decoder.More() {
+		return errors.New("invalid request body: unexpected data after JSON object")
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package huehttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"hueshelly/config"
+	"hueshelly/hue"
+)
+
+func TestAPIRoutes(t *testing.T) {
+	t.Parallel()
+
+	runRouteTests(t, nil, []routeTest{
+		{name: "list rooms", method: http.MethodGet, target: "/api/v1/rooms?token=admin-token", wantStatus: http.StatusOK, wantBody: `[{"id":"room-1","name":"Office","on":false,"brightness":50,"lights":[{"name":"Desk","id":3}]}]`},
+		{name: "get light", method: http.MethodGet, target: "/api/v1/lights/3?token=admin-token", wantStatus: http.StatusOK, wantBody: `"id":3,"name":"Desk","on":false`},
+		{name: "unknown light", method: http.MethodGet, target: "/api/v1/lights/9?token=admin-token", wantStatus: http.StatusNotFound, wantBody: `"code":"not_found"`},
+		{name: "wrong method", method: http.MethodDelete, target: "/api/v1/rooms?token=admin-token", wantStatus: http.StatusMethodNotAllowed, wantBody: `"error":"method not allowed"`},
+		{name: "unknown api path", method: http.MethodGet, target: "/api/v1/groups?token=admin-token", wantStatus: http.StatusNotFound, wantBody: `"error":"endpoint not found"`},
+		{name: "wrong method without token", method: http.MethodDelete, target: "/api/v1/rooms", wantStatus: http.StatusUnauthorized},
+		{name: "unknown api path without token", method: http.MethodGet, target: "/api/v1/groups", wantStatus: http.StatusUnauthorized},
+		{name: "invalid light id", method: http.MethodPut, target: "/api/v1/lights/desk/state?token=admin-token", body: `{"on":true}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown field", method: http.MethodPut, target: "/api/v1/lights/3/state?token=admin-token", body: `{"power":true}`, wantStatus: http.StatusBadRequest},
+		{name: "malformed body", method: http.MethodPut, target: "/api/v1/rooms/room-1/state?token=admin-token", body: `{"on":`, wantStatus: http.StatusBadRequest},
+		{name: "light outside scope", method: http.MethodPut, target: "/api/v1/lights/4/state?token=desk-token", body: `{"on":true}`, wantStatus: http.StatusForbidden},
+		{name: "light inside scope", method: http.MethodPut, target: "/api/v1/lights/3/state?token=desk-token", body: `{"on":true}`, wantStatus: http.StatusOK, wantBody: `"targetType":"light","target":"3","on":true`, wantUpdate: `light/light-3 {"on":{"on":true}}`},
+		{name: "room state", method: http.MethodPut, target: "/api/v1/rooms/room-1/state?token=admin-token", body: `{"on":true,"brightness":40}`, wantStatus: http.StatusOK, wantBody: `"on":true,"brightness":40`, wantUpdate: `grouped_light/grouped-1 {"dimming":{"brightness":40},"on":{"on":true}}`},
+		{name: "recall scene", method: http.MethodPut, target: "/api/v1/scenes/scene-1/state?token=admin-token", body: `{}`, wantStatus: http.StatusOK, wantUpdate: `scene/scene-1 {"recall":{"action":"active"}}`},
+		{name: "legacy route", method: http.MethodGet, target: "/toggle/light/0?token=admin-token", wantStatus: http.StatusBadRequest},
+	})
+}
+
+// routeTest is a request to a handler on a fake bridge, and the response and
+// bridge update it should cause.
+type routeTest struct {
+	name       string
+	method     string
+	target     string
+	body       string
+	wantStatus int
+	// wantBody is part of the compact JSON response.
+	wantBody string
+	// wantUpdate is the update sent to the bridge as "resource/id body", if any.
+	wantUpdate string
+}
+
+// runRouteTests runs every test on its own fake bridge with light 3 "Desk" in
+// the room "Office", the room's scene "Focus" and anything prepare adds.
+func runRouteTests(t *testing.T, prepare func(fake *fakeBridge), tests []routeTest) {
+	t.Helper()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake := newFakeBridge()
+			fake.addLight("light-3", 3, "Desk", false)
+			fake.addRoom("room-1", "Office", "grouped-1", false, "light-3")
+			fake.addScene("scene-1", "Focus", "room-1")
+			if prepare != nil {
+				prepare(fake)
+			}
+			handler := newAPITestHandler(t, fake)
+
+			request := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			recorder := httptest.NewRecorder()
+			handler.mux.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("%s %s status = %d, want %d (body %q)", tt.method, tt.target, recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+			if !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Fatalf("%s %s body = %q, want it to contain %q", tt.method, tt.target, recorder.Body.String(), tt.wantBody)
+			}
+			if got := formatUpdates(fake.sentUpdates()); got != tt.wantUpdate {
+				t.Fatalf("%s %s bridge updates = %q, want %q", tt.method, tt.target, got, tt.wantUpdate)
+			}
+		})
+	}
+}
+
+func TestAPIScopedListings(t *testing.T) {
+	t.Parallel()
+
+	hall := func(fake *fakeBridge) {
+		fake.addLight("light-4", 4, "Hall lamp", false)
+		fake.addRoom("room-2", "Hall", "grouped-2", false, "light-4")
+		fake.addScene("scene-2", "Evening", "room-2")
+	}
+	runRouteTests(t, hall, []routeTest{
+		{name: "admin sees all rooms", method: http.MethodGet, target: "/api/v1/rooms?token=admin-token", wantStatus: http.StatusOK, wantBody: `[{"id":"room-2","name":"Hall"`},
+		{name: "room token sees its room", method: http.MethodGet, target: "/api/v1/rooms?token=office-token", wantStatus: http.StatusOK, wantBody: `[{"id":"room-1","name":"Office"`},
+		{name: "room token sees its scenes", method: http.MethodGet, target: "/api/v1/scenes?token=office-token", wantStatus: http.StatusOK, wantBody: `[{"id":"scene-1","name":"Focus"`},
+		{name: "light token sees no rooms", method: http.MethodGet, target: "/api/v1/rooms?token=desk-token", wantStatus: http.StatusOK, wantBody: `[]`},
+		{name: "light token sees its light", method: http.MethodGet, target: "/api/v1/lights?token=desk-token", wantStatus: http.StatusOK, wantBody: `[{"id":3,"name":"Desk"`},
+		{name: "room outside scope", method: http.MethodGet, target: "/api/v1/rooms/room-2?token=office-token", wantStatus: http.StatusForbidden},
+		{name: "scene outside scope", method: http.MethodGet, target: "/api/v1/scenes/scene-2?token=office-token", wantStatus: http.StatusForbidden},
+		{name: "light outside scope", method: http.MethodGet, target: "/api/v1/lights/4?token=desk-token", wantStatus: http.StatusForbidden},
+		{name: "room token sees its lights", method: http.MethodGet, target: "/api/v1/lights?token=office-token", wantStatus: http.StatusOK, wantBody: `[{"id":3,"name":"Desk","on":false,"brightness":50}]`},
+		{name: "room token controls its lights", method: http.MethodPut, target: "/api/v1/lights/3/state?token=office-token", body: `{"on":true}`, wantStatus: http.StatusOK, wantUpdate: `light/light-3 {"on":{"on":true}}`},
+		{name: "light outside room scope", method: http.MethodGet, target: "/api/v1/lights/4?token=office-token", wantStatus: http.StatusForbidden},
+	})
+}
+
+func TestAPILightColorTemperature(t *testing.T) {
+	t.Parallel()
+
+	white := func(fake *fakeBridge) {
+		fake.set("light", "light-3", "color_temperature", map[string]any{"mirek": 370})
+	}
+	runRouteTests(t, white, []routeTest{
+		{name: "kelvin", method: http.MethodGet, target: "/api/v1/lights/3?token=admin-token", wantStatus: http.StatusOK, wantBody: `"colorTemperature":2703`},
+	})
+}
+
+func TestAPIColor(t *testing.T) {
+	t.Parallel()
+
+	color := func(fake *fakeBridge) {
+		fake.set("light", "light-3", "color", map[string]any{"xy": map[string]any{"x": 0.675, "y": 0.322}})
+	}
+	runRouteTests(t, color, []routeTest{
+		{name: "light colour", method: http.MethodGet, target: "/api/v1/lights/3?token=admin-token", wantStatus: http.StatusOK, wantBody: `"color":{"x":0.675,"y":0.322}`},
+		{name: "set light colour", method: http.MethodPut, target: "/api/v1/lights/3/state?token=admin-token", body: `{"on":true,"color":{"x":0.5,"y":0.25}}`, wantStatus: http.StatusOK, wantBody: `"color":{"x":0.5,"y":0.25}`, wantUpdate: `light/light-3 {"color":{"xy":{"x":0.5,"y":0.25}},"on":{"on":true}}`},
+		{name: "set room colour", method: http.MethodPut, target: "/api/v1/rooms/room-1/state?token=admin-token", body: `{"on":true,"color":{"x":0.5,"y":0.25}}`, wantStatus: http.StatusOK, wantUpdate: `grouped_light/grouped-1 {"color":{"xy":{"x":0.5,"y":0.25}},"on":{"on":true}}`},
+		{name: "colour out of range", method: http.MethodPut, target: "/api/v1/lights/3/state?token=admin-token", body: `{"color":{"x":1.5,"y":0.25}}`, wantStatus: http.StatusBadRequest},
+		{name: "colour and colour temperature", method: http.MethodPut, target: "/api/v1/lights/3/state?token=admin-token", body: `{"colorTemperature":2700,"color":{"x":0.5,"y":0.25}}`, wantStatus: http.StatusBadRequest},
+	})
+	runRouteTests(t, nil, []routeTest{
+		{name: "light without colour", method: http.MethodPut, target: "/api/v1/lights/3/state?token=admin-token", body: `{"color":{"x":0.5,"y":0.25}}`, wantStatus: http.StatusBadRequest, wantBody: `does not support colour`},
+	})
+}
+
+func TestAPIWrongMethodAllow(t *testing.T) {
+	t.Parallel()
+
+	handler := newAPITestHandler(t, newFakeBridge())
+	request := httptest.NewRequest(http.MethodPost, "/api/v1/lights/3/state?token=admin-token", nil)
+	recorder := httptest.NewRecorder()
+	handler.mux.ServeHTTP(recorder, request)
+
+	if recorder.Code != http.StatusMethodNotAllowed || recorder.Header().Get("Allow") != "PUT" {
+		t.Fatalf("POST status = %d, Allow = %q, want 405 with Allow PUT", recorder.Code, recorder.Header().Get("Allow"))
+	}
+}
+
+// newAPITestHandler returns a handler on a service connected to fake, with an
+// admin token, a desk token scoped to light 3 and an office token scoped to the
+// room "Office".
+func newAPITestHandler(t *testing.T, fake *fakeBridge) *Handler {
+	t.Helper()
+
+	handler, err := New(newFakeService(t, fake), config.Config{
+		Auth: config.Auth{Tokens: []config.APIToken{
+			{Name: "admin", Token: "admin-token"},
+			{Name: "desk", Token: "desk-token", Lights: []int{3}},
+			{Name: "office", Token: "office-token", Rooms: []string{"Office"}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v, want nil", err)
+	}
+	return handler
+}
+
+// formatUpdates renders bridge updates as "resource/id body" lines.
+func formatUpdates(updates []bridgeUpdate) string {
+	lines := make([]string, 0, len(updates))
+	for _, update := range updates {
+		body, _ := json.Marshal(update.body)
+		lines = append(lines, update.resource+"/"+update.id+" "+string(body))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestDecodeJSONBody(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		body    string
+		wantErr bool
+	}{
+		{name: "object", body: `{"on":false,"brightness":20}`},
+		{name: "empty", body: ""},
+		{name: "unknown field", body: `{"colour":"red"}`, wantErr: true},
+		{name: "trailing data", body: `{"on":true}{"on":false}`, wantErr: true},
+		{name: "wrong type", body: `{"on":"yes"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			request := httptest.NewRequest(http.MethodPut, "/api/v1/lights/1/state", strings.NewReader(tt.body))
+			var change hue.StateChange
+			err := decodeJSONBody(httptest.NewRecorder(), request, &change)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeJSONBody() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package huehttp
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"hueshelly/config"
+)
+
+// Actions a token can be scoped to.
+const (
+	actionRead    = "read"
+	actionToggle  = "toggle"
+	actionMetrics = "metrics"
+)
+
+var knownActions = []string{actionRead, actionToggle, actionMetrics}
+
+var (
+	errMissingToken      = errors.New("missing API token")
+	errInvalidToken      = errors.New("invalid API token")
+	errForbiddenIP       = errors.New("client address is not allowed")
+	errActionDenied      = errors.New("token is not allowed to perform this action")
+	errTargetDenied      = errors.New("token is not allowed to control this target")
+	errUnknownAddress    = errors.New("client address could not be determined")
+	errAuthRequiresHTTPS = errors.New("authentication is only accepted over HTTPS")
+)
+
+type tokenContextKey struct{}
+
+// authenticator checks the client address against the allowlist and resolves API tokens.
+type authenticator struct {
+	tokens   []config.APIToken
+	networks []netip.Prefix
+	// plainHTTPActions may be performed without a token over plain HTTP when tokens are only accepted over HTTPS.
+	plainHTTPActions []string
+}
+
+func newAuthenticator(cfg config.Auth) (*authenticator, error) {
+	auth := &authenticator{tokens: cfg.Tokens, plainHTTPActions: cfg.PlainHTTPActions}
+	for _, token := range cfg.Tokens {
+		for _, action := range token.Actions {
+			if !slices.Contains(knownActions, action) {
+				return nil, fmt.Errorf("token %q has unknown action %q", token.Name, action)
+			}
+		}
+	}
+	for _, action := range cfg.PlainHTTPActions {
+		if !slices.Contains(knownActions, action) {
+			return nil, fmt.Errorf("plainHttpActions has unknown action %q", action)
+		}
+	}
+	for _, network := range cfg.AllowedNetworks {
+		prefix, err := config.ParseNetwork(network)
+		if err != nil {
+			return nil, err
+		}
+		auth.networks = append(auth.networks, prefix)
+	}
+	return auth, nil
+}
+
+func (auth *authenticator) tokensRequired() bool {
+	return auth != nil && len(auth.tokens) > 0
+}
+
+// allowAddress reports whether the remote address is inside the allowlist.
+func (auth *authenticator) allowAddress(remoteAddr string) error {
+	if auth == nil || len(auth.networks) == 0 {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return errUnknownAddress
+	}
+	addr = addr.Unmap()
+	for _, network := range auth.networks {
+		if network.Contains(addr) {
+			return nil
+		}
+	}
+	return errForbiddenIP
+}
+
+// presentedToken returns the token sent in the Authorization header or the token query parameter.
+func presentedToken(request *http.Request) string {
+	presented := request.URL.Query().Get("token")
+	if header := request.Header.Get("Authorization"); header != "" {
+		scheme, value, found := strings.Cut(header, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			presented = strings.TrimSpace(value)
+		}
+	}
+	return presented
+}
+
+// tokenFromRequest resolves the token the request presents.
+func (auth *authenticator) tokenFromRequest(request *http.Request) (*config.APIToken, error) {
+	presented := presentedToken(request)
+	if presented == "" {
+		return nil, errMissingToken
+	}
+
+	for i := range auth.tokens {
+		if subtle.ConstantTimeCompare([]byte(auth.tokens[i].Token), []byte(presented)) == 1 {
+			return &auth.tokens[i], nil
+		}
+	}
+	return nil, errInvalidToken
+}
+
+// authenticate wraps next with the address allowlist and, when tokens are configured,
+// requires a token that may perform action.
+func (handler *Handler) authenticate(action string, next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		if err := handler.auth.allowAddress(request.RemoteAddr); err != nil {
+			handler.writeError(writer, http.StatusForbidden, err.Error())
+			return
+		}
+		if !handler.auth.tokensRequired() {
+			next(writer, request)
+			return
+		}
+		if handler.tlsConfig.AuthOnlyOverHTTPS && request.TLS == nil {
+			// Only a token sent in the clear is refused; tokenless requests fall back to plainHttpActions.
+			if presentedToken(request) != "" || request.Header.Get("Authorization") != "" {
+				handler.writeError(writer, http.StatusForbidden, errAuthRequiresHTTPS.Error())
+				return
+			}
+			if slices.Contains(handler.auth.plainHTTPActions, action) {
+				next(writer, request)
+				return
+			}
+		}
+
+		token, err := handler.auth.tokenFromRequest(request)
+		if err != nil {
+			writer.Header().Set("WWW-Authenticate", `Bearer realm="hueshelly"`)
+			handler.writeError(writer, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if len(token.Actions) > 0 && !slices.Contains(token.Actions, action) {
+			handler.writeError(writer, http.StatusForbidden, errActionDenied.Error())
+			return
+		}
+
+		next(writer, request.WithContext(context.WithValue(request.Context(), tokenContextKey{}, token)))
+	}
+}
+
+func tokenFromContext(ctx context.Context) *config.APIToken {
+	token, _ := ctx.Value(tokenContextKey{}).(*config.APIToken)
+	return token
+}
+
+// targetScoped reports whether the token is limited to specific rooms or lights.
+// A scoped token may only control the targets it lists.
+func targetScoped(token *config.APIToken) bool {
+	return token != nil && (len(token.Rooms) > 0 || len(token.Lights) > 0)
+}
+
+// allowRoom reports whether the request's token may control the room.
+func allowRoom(request *http.Request, room string) error {
+	token := tokenFromContext(request.Context())
+	if !targetScoped(token) || slices.Contains(token.Rooms, room) {
+		return nil
+	}
+	return errTargetDenied
+}
+
+// allowLight reports whether the request's token may control the light.
+func allowLight(request *http.Request, lightID int) error {
+	token := tokenFromContext(request.Context())
+	if !targetScoped(token) || slices.Contains(token.Lights, lightID) {
+		return nil
+	}
+	return errTargetDenied
+}
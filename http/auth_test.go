@@ -0,0 +1,191 @@
+package huehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"hueshelly/config"
+)
+
+func newAuthTestHandler(t *testing.T, cfg config.Auth) *Handler {
+	t.Helper()
+
+	auth, err := newAuthenticator(cfg)
+	if err != nil {
+		t.Fatalf("newAuthenticator() error = %v, want nil", err)
+	}
+	return &Handler{auth: auth}
+}
+
+func TestAuthenticate(t *testing.T) {
+	t.Parallel()
+
+	handler := newAuthTestHandler(t, config.Auth{
+		Tokens: []config.APIToken{
+			{Name: "admin", Token: "admin-token"},
+			{Name: "guest", Token: "guest-token", Actions: []string{actionToggle}, Rooms: []string{"Living Room"}},
+		},
+		AllowedNetworks: []string{"192.168.1.0/24", "10.0.0.5"},
+	})
+
+	tests := []struct {
+		name       string
+		action     string
+		target     string
+		remoteAddr string
+		header     string
+		wantStatus int
+	}{
+		{name: "query token", action: actionRead, target: "/groups?token=admin-token", remoteAddr: "192.168.1.20:5000", wantStatus: http.StatusOK},
+		{name: "bearer token", action: actionRead, target: "/groups", remoteAddr: "192.168.1.20:5000", header: "Bearer admin-token", wantStatus: http.StatusOK},
+		{name: "single allowed ip", action: actionRead, target: "/groups?token=admin-token", remoteAddr: "10.0.0.5:5000", wantStatus: http.StatusOK},
+		{name: "missing token", action: actionRead, target: "/groups", remoteAddr: "192.168.1.20:5000", wantStatus: http.StatusUnauthorized},
+		{name: "invalid token", action: actionRead, target: "/groups?token=nope", remoteAddr: "192.168.1.20:5000", wantStatus: http.StatusUnauthorized},
+		{name: "address not allowed", action: actionRead, target: "/groups?token=admin-token", remoteAddr: "172.16.0.1:5000", wantStatus: http.StatusForbidden},
+		{name: "action not allowed", action: actionRead, target: "/groups?token=guest-token", remoteAddr: "192.168.1.20:5000", wantStatus: http.StatusForbidden},
+		{name: "action allowed", action: actionToggle, target: "/toggle?token=guest-token", remoteAddr: "192.168.1.20:5000", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			request := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			request.RemoteAddr = tt.remoteAddr
+			if tt.header != "" {
+				request.Header.Set("Authorization", tt.header)
+			}
+			recorder := httptest.NewRecorder()
+
+			handler.authenticate(tt.action, func(writer http.ResponseWriter, request *http.Request) {
+				writer.WriteHeader(http.StatusOK)
+			})(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestAuthenticateDisabled(t *testing.T) {
+	t.Parallel()
+
+	handler := newAuthTestHandler(t, config.Auth{})
+	recorder := httptest.NewRecorder()
+	handler.authenticate(actionToggle, func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusNoContent)
+	})(recorder, httptest.NewRequest(http.MethodGet, "/toggle/light/1", nil))
+
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusNoContent)
+	}
+}
+
+func TestTargetScopes(t *testing.T) {
+	t.Parallel()
+
+	handler := newAuthTestHandler(t, config.Auth{
+		Tokens: []config.APIToken{
+			{Name: "guest", Token: "guest-token", Rooms: []string{"Living Room"}, Lights: []int{3}},
+			{Name: "admin", Token: "admin-token"},
+		},
+	})
+
+	var roomErr, otherRoomErr, lightErr, otherLightErr error
+	handler.authenticate(actionToggle, func(writer http.ResponseWriter, request *http.Request) {
+		roomErr = allowRoom(request, "Living Room")
+		otherRoomErr = allowRoom(request, "Bedroom")
+		lightErr = allowLight(request, 3)
+		otherLightErr = allowLight(request, 4)
+	})(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?token=guest-token", nil))
+
+	if roomErr != nil || lightErr != nil {
+		t.Fatalf("allowed targets denied: room = %v, light = %v", roomErr, lightErr)
+	}
+	if otherRoomErr == nil || otherLightErr == nil {
+		t.Fatalf("unlisted targets allowed: room = %v, light = %v", otherRoomErr, otherLightErr)
+	}
+
+	var adminErr error
+	handler.authenticate(actionToggle, func(writer http.ResponseWriter, request *http.Request) {
+		adminErr = allowRoom(request, "Bedroom")
+	})(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?token=admin-token", nil))
+	if adminErr != nil {
+		t.Fatalf("unscoped token denied: %v", adminErr)
+	}
+}
+
+func TestNewAuthenticatorRejectsUnknownAction(t *testing.T) {
+	t.Parallel()
+
+	_, err := newAuthenticator(config.Auth{Tokens: []config.APIToken{{Name: "x", Token: "x", Actions: []string{"explode"}}}})
+	if err == nil {
+		t.Fatalf("newAuthenticator() error = nil, want non-nil")
+	}
+}
+
+func TestAuthenticateRequiresHTTPS(t *testing.T) {
+	t.Parallel()
+
+	handler := newAuthTestHandler(t, config.Auth{Tokens: []config.APIToken{{Name: "admin", Token: "admin-token"}}})
+	handler.tlsConfig = config.TLS{AuthOnlyOverHTTPS: true}
+	next := func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	}
+
+	plain := httptest.NewRecorder()
+	handler.authenticate(actionRead, next)(plain, httptest.NewRequest(http.MethodGet, "/groups?token=admin-token", nil))
+	if plain.Code != http.StatusForbidden {
+		t.Fatalf("plain HTTP status = %d, want %d", plain.Code, http.StatusForbidden)
+	}
+
+	secure := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "https://hueshelly/groups?token=admin-token", nil)
+	handler.authenticate(actionRead, next)(secure, request)
+	if secure.Code != http.StatusOK {
+		t.Fatalf("HTTPS status = %d, want %d", secure.Code, http.StatusOK)
+	}
+}
+
+func TestAuthenticatePlainHTTPWithoutToken(t *testing.T) {
+	t.Parallel()
+
+	handler := newAuthTestHandler(t, config.Auth{
+		Tokens:           []config.APIToken{{Name: "admin", Token: "admin-token"}},
+		AllowedNetworks:  []string{"192.168.1.0/24"},
+		PlainHTTPActions: []string{actionToggle},
+	})
+	handler.tlsConfig = config.TLS{AuthOnlyOverHTTPS: true}
+
+	tests := []struct {
+		name       string
+		action     string
+		target     string
+		remoteAddr string
+		wantStatus int
+	}{
+		{name: "shelly toggle without token", action: actionToggle, target: "/toggle/light/3", remoteAddr: "192.168.1.30:80", wantStatus: http.StatusOK},
+		{name: "action outside the policy", action: actionRead, target: "/groups", remoteAddr: "192.168.1.30:80", wantStatus: http.StatusUnauthorized},
+		{name: "token in the clear", action: actionToggle, target: "/toggle/light/3?token=admin-token", remoteAddr: "192.168.1.30:80", wantStatus: http.StatusForbidden},
+		{name: "outside allowed networks", action: actionToggle, target: "/toggle/light/3", remoteAddr: "10.0.0.7:80", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			request := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			request.RemoteAddr = tt.remoteAddr
+			recorder := httptest.NewRecorder()
+			handler.authenticate(tt.action, func(writer http.ResponseWriter, request *http.Request) {
+				writer.WriteHeader(http.StatusOK)
+			})(recorder, request)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+		})
+	}
+}
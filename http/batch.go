@@ -0,0 +1,248 @@
+package huehttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"hueshelly/config"
+	"hueshelly/hue"
+)
+
+const maxBatchActions = 50
+
+// Target types and actions accepted by POST /batch.
+const (
+	batchTargetLight = "light"
+	batchTargetRoom  = "room"
+	batchTargetZone  = "zone"
+
+	batchActionOn         = "on"
+	batchActionOff        = "off"
+	batchActionToggle     = "toggle"
+	batchActionBrightness = "brightness"
+	batchActionScene      = "scene"
+)
+
+// batchRequest is the body of POST /batch.
+type batchRequest struct {
+	// Parallel runs the actions concurrently instead of one after another.
+	Parallel bool          `json:"parallel"`
+	Actions  []batchAction `json:"actions"`
+}
+
+// batchAction is one item of a batch. Lights are addressed by id, rooms and
+// zones by id or name.
+type batchAction struct {
+	Type       string     `json:"type"`
+	ID         flexibleID `json:"id,omitempty"`
+	Name       string     `json:"name,omitempty"`
+	Action     string     `json:"action"`
+	Brightness *float64   `json:"brightness,omitempty"`
+	// Scene is the id or name of a scene of the room or zone, used by the scene action.
+	Scene string `json:"scene,omitempty"`
+	// Transition overrides the configured transition time of on, off, toggle and brightness actions.
+	Transition *config.Duration `json:"transition,omitempty"`
+}
+
+type batchResult struct {
+	Index int        `json:"index"`
+	OK    bool       `json:"ok"`
+	State *hue.State `json:"state,omitempty"`
+	// Status is the HTTP status the action would have had on its own.
+	Status int    `json:"status"`
+	Code   string `json:"code,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Results    []batchResult `json:"results"`
+	DurationMs int64         `json:"durationMs"`
+}
+
+// flexibleID accepts ids as JSON strings or numbers, so light ids can be written as 3 or "3".
+type flexibleID string
+
+func (id *flexibleID) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var value string
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		*id = flexibleID(value)
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("id must be a string or number: %w", err)
+	}
+	*id = flexibleID(number.String())
+	return nil
+}
+
+func (action batchAction) validate() error {
+	switch action.Type {
+	case batchTargetLight:
+		if lightID, err := strconv.Atoi(string(action.ID)); err != nil || lightID <= 0 {
+			return errors.New("light actions need a numeric id")
+		}
+		if action.Name != "" {
+			return errors.New("lights are addressed by id, not name")
+		}
+	case batchTargetRoom, batchTargetZone:
+		if (action.ID == "") == (action.Name == "") {
+			return fmt.Errorf("%s actions need either an id or a name", action.Type)
+		}
+	default:
+		return fmt.Errorf("unknown type %q", action.Type)
+	}
+
+	switch action.Action {
+	case batchActionOn, batchActionOff, batchActionToggle:
+	case batchActionBrightness:
+		if action.Brightness == nil {
+			return errors.New("brightness action needs a brightness")
+		}
+	case batchActionScene:
+		if action.Type == batchTargetLight {
+			return errors.New("scenes can only be recalled for rooms and zones")
+		}
+		if action.Scene == "" {
+			return errors.New("scene action needs a scene")
+		}
+	default:
+		return fmt.Errorf("unknown action %q", action.Action)
+	}
+	return nil
+}
+
+func (action batchAction) stateChange() hue.StateChange {
+	switch action.Action {
+	case batchActionOn, batchActionOff:
+		on := action.Action == batchActionOn
+		return hue.StateChange{On: &on, Transition: action.Transition}
+	case batchActionToggle:
+		return hue.StateChange{Toggle: true, Transition: action.Transition}
+	default:
+		on := true
+		return hue.StateChange{On: &on, Brightness: action.Brightness, Transition: action.Transition}
+	}
+}
+
+// batch runs several actions in one request and reports a result per action.
+// The batch is rejected as a whole when any action is malformed.
+func (handler *Handler) batch(writer http.ResponseWriter, request *http.Request) {
+	var body batchRequest
+	if err := decodeJSONBody(writer, request, &body); err != nil {
+		handler.writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(body.Actions) == 0 || len(body.Actions) > maxBatchActions {
+		handler.writeError(writer, http.StatusBadRequest, fmt.Sprintf("a batch needs between 1 and %d actions", maxBatchActions))
+		return
+	}
+	for i, action := range body.Actions {
+		if err := action.validate(); err != nil {
+			handler.writeError(writer, http.StatusBadRequest, fmt.Sprintf("actions[%d]: %v", i, err))
+			return
+		}
+	}
+
+	started := time.Now()
+	results := make([]batchResult, len(body.Actions))
+	run := func(i int) {
+		state, err := handler.runBatchAction(request, body.Actions[i])
+		results[i] = newBatchResult(i, state, err)
+	}
+	if body.Parallel {
+		var wg sync.WaitGroup
+		for i := range body.Actions {
+			wg.Go(func() { run(i) })
+		}
+		wg.Wait()
+	} else {
+		for i := range body.Actions {
+			run(i)
+		}
+	}
+
+	handler.writeJSON(writer, http.StatusOK, batchResponse{Results: results, DurationMs: time.Since(started).Milliseconds()})
+}
+
+func (handler *Handler) runBatchAction(request *http.Request, action batchAction) (hue.State, error) {
+	ctx := request.Context()
+	if action.Type == batchTargetLight {
+		lightID, _ := strconv.Atoi(string(action.ID))
+		if err := allowLight(request, lightID); err != nil {
+			return hue.State{}, err
+		}
+		return handler.hueService.SetLightState(ctx, lightID, action.stateChange())
+	}
+
+	id, err := handler.resolveBatchGroup(request, action)
+	if err != nil {
+		return hue.State{}, err
+	}
+	if action.Action == batchActionScene {
+		sceneID, err := handler.hueService.SceneID(ctx, id, action.Scene)
+		if err != nil {
+			return hue.State{}, err
+		}
+		return handler.hueService.RecallScene(ctx, sceneID, "")
+	}
+	if action.Type == batchTargetZone {
+		return handler.hueService.SetZoneState(ctx, id, action.stateChange())
+	}
+	return handler.hueService.SetRoomState(ctx, id, action.stateChange())
+}
+
+// resolveBatchGroup returns the resource id of the action's room or zone after
+// checking that the request's token may control it.
+func (handler *Handler) resolveBatchGroup(request *http.Request, action batchAction) (string, error) {
+	ctx := request.Context()
+	id, name := string(action.ID), action.Name
+	if name != "" {
+		var err error
+		if action.Type == batchTargetZone {
+			id, err = handler.hueService.ZoneID(ctx, name)
+		} else {
+			id, err = handler.hueService.RoomID(ctx, name)
+		}
+		if err != nil {
+			return "", err
+		}
+	} else if targetScoped(tokenFromContext(ctx)) {
+		var group hue.Room
+		var err error
+		if action.Type == batchTargetZone {
+			group, err = handler.hueService.Zone(ctx, id)
+		} else {
+			group, err = handler.hueService.Room(ctx, id)
+		}
+		if err != nil {
+			return "", err
+		}
+		name = group.Name
+	}
+
+	if err := allowRoom(request, name); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func newBatchResult(index int, state hue.State, err error) batchResult {
+	if err == nil {
+		return batchResult{Index: index, OK: true, State: &state, Status: http.StatusOK}
+	}
+
+	statusCode, code := serviceErrorStatus(err)
+	if errors.Is(err, errTargetDenied) {
+		statusCode, code = http.StatusForbidden, errorCodeForStatus(http.StatusForbidden)
+	}
+	return batchResult{Index: index, Status: statusCode, Code: code, Error: err.Error()}
+}
@@ -0,0 +1,106 @@
+package huehttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"hueshelly/config"
+	"hueshelly/hue"
+)
+
+func TestBatchActionValidate(t *testing.T) {
+	t.Parallel()
+
+	brightness := 30.0
+	tests := []struct {
+		name    string
+		action  batchAction
+		wantErr bool
+	}{
+		{name: "light toggle", action: batchAction{Type: "light", ID: "3", Action: "toggle"}},
+		{name: "room off by name", action: batchAction{Type: "room", Name: "Kitchen", Action: "off"}},
+		{name: "zone brightness by id", action: batchAction{Type: "zone", ID: "zone-1", Action: "brightness", Brightness: &brightness}},
+		{name: "room scene", action: batchAction{Type: "room", Name: "Kitchen", Action: "scene", Scene: "Relax"}},
+		{name: "light without numeric id", action: batchAction{Type: "light", ID: "desk", Action: "on"}, wantErr: true},
+		{name: "room with id and name", action: batchAction{Type: "room", ID: "room-1", Name: "Kitchen", Action: "on"}, wantErr: true},
+		{name: "room without target", action: batchAction{Type: "room", Action: "on"}, wantErr: true},
+		{name: "brightness missing", action: batchAction{Type: "light", ID: "3", Action: "brightness"}, wantErr: true},
+		{name: "scene for light", action: batchAction{Type: "light", ID: "3", Action: "scene", Scene: "Relax"}, wantErr: true},
+		{name: "unknown type", action: batchAction{Type: "group", ID: "1", Action: "on"}, wantErr: true},
+		{name: "unknown action", action: batchAction{Type: "light", ID: "1", Action: "blink"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.action.validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFlexibleIDUnmarshal(t *testing.T) {
+	t.Parallel()
+
+	var actions []batchAction
+	if err := json.Unmarshal([]byte(`[{"id":3},{"id":"room-1"}]`), &actions); err != nil {
+		t.Fatalf("Unmarshal() error = %v, want nil", err)
+	}
+	if actions[0].ID != "3" || actions[1].ID != "room-1" {
+		t.Fatalf("ids = %q, %q, want %q, %q", actions[0].ID, actions[1].ID, "3", "room-1")
+	}
+	if err := json.Unmarshal([]byte(`[{"id":true}]`), &actions); err == nil {
+		t.Fatalf("Unmarshal() error = nil, want error for boolean id")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	t.Parallel()
+
+	handler, err := New(&hue.Service{}, config.Config{
+		Auth: config.Auth{Tokens: []config.APIToken{{Name: "desk", Token: "desk-token", Lights: []int{3}}}},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v, want nil", err)
+	}
+
+	for _, body := range []string{`{"actions":[]}`, `{"actions":[{"type":"light","id":3,"action":"blink"}]}`} {
+		request := httptest.NewRequest(http.MethodPost, "/batch?token=desk-token", strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		handler.mux.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("POST /batch %s status = %d, want %d", body, recorder.Code, http.StatusBadRequest)
+		}
+	}
+
+	// The zero Service is not initialized, so actions that reach it fail with 500.
+	for _, parallel := range []bool{false, true} {
+		body := `{"parallel":` + strconv.FormatBool(parallel) +
+			`,"actions":[{"type":"light","id":3,"action":"off"},{"type":"light","id":4,"action":"off"}]}`
+		request := httptest.NewRequest(http.MethodPost, "/batch?token=desk-token", strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		handler.mux.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("POST /batch status = %d, want %d", recorder.Code, http.StatusOK)
+		}
+
+		var response batchResponse
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decode body: %v", err)
+		}
+		if len(response.Results) != 2 {
+			t.Fatalf("results = %d, want 2", len(response.Results))
+		}
+		if got := response.Results[0]; got.Index != 0 || got.OK || got.Status != http.StatusInternalServerError {
+			t.Fatalf("parallel=%v results[0] = %+v, want failed action with status 500", parallel, got)
+		}
+		if got := response.Results[1]; got.Index != 1 || got.OK || got.Status != http.StatusForbidden || got.Code != "forbidden" {
+			t.Fatalf("parallel=%v results[1] = %+v, want forbidden action", parallel, got)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package huehttp
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+
+	"hueshelly/logging"
+)
+
+// dashboardPage is a self-contained page for wall tablets. It controls rooms
+// through /api/v1 and polls it for live state, so it needs no external assets.
+//
+//go:embed dashboard.html
+var dashboardPage []byte
+
+func (handler *Handler) dashboard(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.WriteHeader(http.StatusOK)
+	if _, err := writer.Write(dashboardPage); err != nil {
+		logging.Logger.Println(fmt.Errorf("write dashboard page: %w", err))
+	}
+}
@@ -0,0 +1,26 @@
+package huehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboardServed(t *testing.T) {
+	t.Parallel()
+
+	handler := newAPITestHandler(t, newFakeBridge())
+	recorder := httptest.NewRecorder()
+	handler.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/dashboard?token=admin-token", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("GET /dashboard status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/html") {
+		t.Fatalf("GET /dashboard Content-Type = %q, want text/html", contentType)
+	}
+	if !strings.Contains(recorder.Body.String(), "<title>hueshelly dashboard</title>") {
+		t.Fatalf("GET /dashboard body does not contain the dashboard page")
+	}
+}
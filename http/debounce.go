@@ -0,0 +1,146 @@
+package huehttp
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"hueshelly/hue"
+	"hueshelly/logging"
+	"hueshelly/metrics"
+)
+
+// Reasons reported when a toggle is suppressed.
+const (
+	suppressedByDebounce       = "debounce"
+	suppressedByIdempotencyKey = "idempotency_key"
+)
+
+// deduplicator collapses toggles that Shelly devices fire more than once, either
+// because a contact bounced or because the device retried the action URL.
+type deduplicator struct {
+	window time.Duration
+	keyTTL time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex
+	accepted map[string]time.Time
+	keys     map[string]time.Time
+}
+
+func newDeduplicator(window, keyTTL time.Duration) *deduplicator {
+	return &deduplicator{
+		window:   window,
+		keyTTL:   keyTTL,
+		now:      time.Now,
+		accepted: map[string]time.Time{},
+		keys:     map[string]time.Time{},
+	}
+}
+
+// admission is a toggle the deduplicator let through.
+type admission struct {
+	dedup  *deduplicator
+	target string
+	key    string
+	at     time.Time
+}
+
+// suppress reports whether a toggle of target should be dropped and why. The
+// debounce window is measured from the last accepted toggle, so a held or
+// bouncing contact cannot suppress presses forever. Duplicates that arrive
+// while the accepted toggle is still running are suppressed too.
+func (dedup *deduplicator) suppress(target, idempotencyKey string) (admission, string, bool) {
+	if dedup == nil {
+		return admission{}, "", false
+	}
+	now := dedup.now()
+
+	dedup.mu.Lock()
+	defer dedup.mu.Unlock()
+	dedup.prune(now)
+
+	admitted := admission{dedup: dedup, target: target, at: now}
+	if idempotencyKey != "" {
+		admitted.key = target + "\x00" + idempotencyKey
+		if _, seen := dedup.keys[admitted.key]; seen {
+			return admission{}, suppressedByIdempotencyKey, true
+		}
+	}
+	if dedup.window > 0 {
+		if last, exists := dedup.accepted[target]; exists && now.Sub(last) < dedup.window {
+			return admission{}, suppressedByDebounce, true
+		}
+		dedup.accepted[target] = now
+	}
+	if admitted.key != "" {
+		dedup.keys[admitted.key] = now
+	}
+	return admitted, "", false
+}
+
+// forget drops an admission whose toggle failed, so the device's retry of the
+// same press is not suppressed.
+func (admitted admission) forget() {
+	dedup := admitted.dedup
+	if dedup == nil {
+		return
+	}
+	dedup.mu.Lock()
+	defer dedup.mu.Unlock()
+
+	if seen, exists := dedup.keys[admitted.key]; exists && seen.Equal(admitted.at) {
+		delete(dedup.keys, admitted.key)
+	}
+	if last, exists := dedup.accepted[admitted.target]; exists && last.Equal(admitted.at) {
+		delete(dedup.accepted, admitted.target)
+	}
+}
+
+func (dedup *deduplicator) prune(now time.Time) {
+	for target, last := range dedup.accepted {
+		if now.Sub(last) >= dedup.window {
+			delete(dedup.accepted, target)
+		}
+	}
+	for key, seen := range dedup.keys {
+		if now.Sub(seen) >= dedup.keyTTL {
+			delete(dedup.keys, key)
+		}
+	}
+}
+
+// suppressToggle answers duplicate toggles and reports whether the request was
+// handled. A suppressed toggle answers 204, or the current state from current
+// when the caller asked for it and current is not nil. The caller forgets the
+// returned admission when its toggle fails.
+func (handler *Handler) suppressToggle(writer http.ResponseWriter, request *http.Request, targetType, target string, current func(ctx context.Context) (hue.State, error)) (admission, bool) {
+	idempotencyKey := request.Header.Get("Idempotency-Key")
+	if idempotencyKey == "" {
+		idempotencyKey = request.URL.Query().Get("idempotencyKey")
+	}
+
+	admitted, reason, suppressed := handler.dedup.suppress(targetType+":"+target, idempotencyKey)
+	if !suppressed {
+		return admitted, false
+	}
+
+	// The target comes straight from the URL, so it is not used as a label.
+	metrics.ToggleSuppressed.Inc(targetType, reason)
+	logging.Logger.Printf("Suppressed duplicate toggle of %s %q (%s)", targetType, target, reason)
+	writer.Header().Set("X-Hueshelly-Suppressed", reason)
+	if current == nil || !wantsState(request) {
+		writer.WriteHeader(http.StatusNoContent)
+		return admission{}, true
+	}
+
+	started := time.Now()
+	state, err := current(request.Context())
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return admission{}, true
+	}
+	handler.writeActionResult(writer, request, state, started)
+	return admission{}, true
+}
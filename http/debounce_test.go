@@ -0,0 +1,140 @@
+package huehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeduplicatorDebounce(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	dedup := newDeduplicator(300*time.Millisecond, time.Minute)
+	dedup.now = func() time.Time { return now }
+
+	if _, _, suppressed := dedup.suppress("light:1", ""); suppressed {
+		t.Fatalf("first toggle suppressed, want accepted")
+	}
+	now = now.Add(100 * time.Millisecond)
+	if _, reason, suppressed := dedup.suppress("light:1", ""); !suppressed || reason != suppressedByDebounce {
+		t.Fatalf("suppress() = %q, %v, want %q, true", reason, suppressed, suppressedByDebounce)
+	}
+	if _, _, suppressed := dedup.suppress("light:2", ""); suppressed {
+		t.Fatalf("other target suppressed, want accepted")
+	}
+	now = now.Add(250 * time.Millisecond)
+	if _, _, suppressed := dedup.suppress("light:1", ""); suppressed {
+		t.Fatalf("toggle after window suppressed, want accepted")
+	}
+}
+
+func TestDeduplicatorIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	dedup := newDeduplicator(0, time.Minute)
+	dedup.now = func() time.Time { return now }
+
+	if _, _, suppressed := dedup.suppress("room:Kitchen", "abc"); suppressed {
+		t.Fatalf("first toggle suppressed, want accepted")
+	}
+	now = now.Add(10 * time.Second)
+	if _, reason, suppressed := dedup.suppress("room:Kitchen", "abc"); !suppressed || reason != suppressedByIdempotencyKey {
+		t.Fatalf("suppress() = %q, %v, want %q, true", reason, suppressed, suppressedByIdempotencyKey)
+	}
+	if _, _, suppressed := dedup.suppress("room:Kitchen", "def"); suppressed {
+		t.Fatalf("new key suppressed, want accepted")
+	}
+	now = now.Add(time.Minute)
+	if _, _, suppressed := dedup.suppress("room:Kitchen", "abc"); suppressed {
+		t.Fatalf("expired key suppressed, want accepted")
+	}
+}
+
+func TestDeduplicatorForgetsFailedToggle(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	dedup := newDeduplicator(300*time.Millisecond, time.Minute)
+	dedup.now = func() time.Time { return now }
+
+	admitted, _, suppressed := dedup.suppress("light:1", "abc")
+	if suppressed {
+		t.Fatalf("first toggle suppressed, want accepted")
+	}
+	if _, _, suppressed := dedup.suppress("light:1", "abc"); !suppressed {
+		t.Fatalf("duplicate of running toggle accepted, want suppressed")
+	}
+	admitted.forget()
+	if _, _, suppressed := dedup.suppress("light:1", "abc"); suppressed {
+		t.Fatalf("retry of failed toggle suppressed, want accepted")
+	}
+}
+
+func TestSuppressedToggleRetriesAfterFailure(t *testing.T) {
+	t.Parallel()
+
+	handler := newAPITestHandler(t, newFakeBridge())
+	handler.dedup = newDeduplicator(time.Minute, time.Minute)
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		request := httptest.NewRequest(http.MethodGet, "/toggle/light/9?token=admin-token", nil)
+		request.Header.Set("Idempotency-Key", "press-1")
+		recorder := httptest.NewRecorder()
+		handler.mux.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusNotFound {
+			t.Fatalf("attempt %d status = %d, want %d for the unknown light", attempt, recorder.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestSuppressedToggleReturnsState(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-3", 3, "Desk", false)
+	handler := newAPITestHandler(t, fake)
+	handler.dedup = newDeduplicator(time.Minute, time.Minute)
+
+	first := httptest.NewRecorder()
+	handler.mux.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/toggle/light/3?token=admin-token", nil))
+	if first.Code != http.StatusNoContent {
+		t.Fatalf("first toggle status = %d, want %d", first.Code, http.StatusNoContent)
+	}
+
+	second := httptest.NewRecorder()
+	handler.mux.ServeHTTP(second, httptest.NewRequest(http.MethodGet, "/toggle/light/3?token=admin-token&return=state", nil))
+	if second.Code != http.StatusOK || second.Header().Get("X-Hueshelly-Suppressed") != suppressedByDebounce {
+		t.Fatalf("suppressed toggle status = %d, X-Hueshelly-Suppressed = %q, want 200 and %q", second.Code, second.Header().Get("X-Hueshelly-Suppressed"), suppressedByDebounce)
+	}
+	if want := `"targetType":"light","target":"3","on":true`; !strings.Contains(second.Body.String(), want) {
+		t.Fatalf("suppressed toggle body = %q, want it to contain %q", second.Body.String(), want)
+	}
+	if updates := fake.sentUpdates(); len(updates) != 1 {
+		t.Fatalf("bridge updates = %d, want only the first toggle", len(updates))
+	}
+}
+
+func TestSuppressToggleWritesNoContent(t *testing.T) {
+	t.Parallel()
+
+	handler := &Handler{dedup: newDeduplicator(time.Minute, time.Minute)}
+	first := httptest.NewRecorder()
+	if _, suppressed := handler.suppressToggle(first, httptest.NewRequest(http.MethodGet, "/toggle/light/9", nil), "light", "9", nil); suppressed {
+		t.Fatalf("first toggle suppressed, want accepted")
+	}
+
+	second := httptest.NewRecorder()
+	if _, suppressed := handler.suppressToggle(second, httptest.NewRequest(http.MethodGet, "/toggle/light/9", nil), "light", "9", nil); !suppressed {
+		t.Fatalf("second toggle accepted, want suppressed")
+	}
+	if second.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", second.Code, http.StatusNoContent)
+	}
+	if got := second.Header().Get("X-Hueshelly-Suppressed"); got != suppressedByDebounce {
+		t.Fatalf("X-Hueshelly-Suppressed = %q, want %q", got, suppressedByDebounce)
+	}
+}
@@ -0,0 +1,101 @@
+package huehttp
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"hueshelly/hue"
+)
+
+// Phases of a long press, as the last path segment of the dim routes.
+const (
+	dimStart = "start"
+	dimStop  = "stop"
+)
+
+// dimLight starts or stops dimming a light while a button is held.
+func (handler *Handler) dimLight(writer http.ResponseWriter, request *http.Request) {
+	if !isToggleMethod(request.Method) {
+		handler.writeError(writer, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	lightID, err := lightIDFromPath(request)
+	if err != nil {
+		handler.writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := parseDimAction(request); err != nil {
+		handler.writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := allowLight(request, lightID); err != nil {
+		handler.writeError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+
+	started := time.Now()
+	if request.PathValue("action") == dimStop {
+		if err := handler.hueService.StopDimmingLight(request.Context(), lightID); err != nil {
+			handler.writeServiceError(writer, err)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+	state, err := handler.hueService.StartDimmingLight(request.Context(), lightID, request.URL.Query().Get("direction"))
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	handler.writeActionResult(writer, request, state, started)
+}
+
+// dimRoom starts or stops dimming a room while a button is held.
+func (handler *Handler) dimRoom(writer http.ResponseWriter, request *http.Request) {
+	if !isToggleMethod(request.Method) {
+		handler.writeError(writer, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	room := request.PathValue("name")
+	if err := parseDimAction(request); err != nil {
+		handler.writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := allowRoom(request, room); err != nil {
+		handler.writeError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+
+	started := time.Now()
+	if request.PathValue("action") == dimStop {
+		if err := handler.hueService.StopDimmingRoom(request.Context(), room); err != nil {
+			handler.writeServiceError(writer, err)
+			return
+		}
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+	state, err := handler.hueService.StartDimmingRoom(request.Context(), room, request.URL.Query().Get("direction"))
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	handler.writeActionResult(writer, request, state, started)
+}
+
+func parseDimAction(request *http.Request) error {
+	switch action := request.PathValue("action"); action {
+	case dimStart, dimStop:
+	default:
+		return fmt.Errorf("dim action must be %s or %s, got %q", dimStart, dimStop, action)
+	}
+	switch direction := request.URL.Query().Get("direction"); direction {
+	case hue.DimAuto, hue.DimUp, hue.DimDown:
+		return nil
+	default:
+		return fmt.Errorf("direction must be %s or %s, got %q", hue.DimUp, hue.DimDown, direction)
+	}
+}
@@ -0,0 +1,42 @@
+package huehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDimRoutes(t *testing.T) {
+	t.Parallel()
+
+	runRouteTests(t, nil, []routeTest{
+		{name: "start light", method: http.MethodPost, target: "/dim/light/3/start?return=state&token=desk-token", wantStatus: http.StatusOK, wantBody: `"targetType":"light","target":"3","on":true`, wantUpdate: `light/light-3 {"dimming_delta":{"action":"up","brightness_delta":100},"dynamics":{"duration":5000},"on":{"on":true}}`},
+		{name: "start room down while off", method: http.MethodGet, target: "/dim/room/Office/start?direction=down&return=state&token=admin-token", wantStatus: http.StatusOK, wantBody: `"targetType":"room","target":"Office","on":false`},
+		{name: "stop without ramp", method: http.MethodPost, target: "/dim/room/Office/stop?token=admin-token", wantStatus: http.StatusNoContent},
+		{name: "invalid action", method: http.MethodGet, target: "/dim/light/3/hold?token=admin-token", wantStatus: http.StatusBadRequest},
+		{name: "invalid direction", method: http.MethodGet, target: "/dim/room/Office/start?direction=sideways&token=admin-token", wantStatus: http.StatusBadRequest, wantBody: `direction must be up or down`},
+		{name: "light outside scope", method: http.MethodPost, target: "/dim/light/4/stop?token=desk-token", wantStatus: http.StatusForbidden},
+	})
+}
+
+func TestDimWhileHeldRoutes(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addRoom("room-1", "Office", "grouped-1", true)
+	handler := newAPITestHandler(t, fake)
+
+	for _, target := range []string{"/dim/room/Office/start?direction=up&token=admin-token", "/dim/room/Office/stop?token=admin-token"} {
+		recorder := httptest.NewRecorder()
+		handler.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, target, nil))
+		if recorder.Code != http.StatusNoContent {
+			t.Fatalf("POST %s status = %d, want %d (body %q)", target, recorder.Code, http.StatusNoContent, recorder.Body.String())
+		}
+	}
+
+	want := "grouped_light/grouped-1 {\"dimming_delta\":{\"action\":\"up\",\"brightness_delta\":100},\"dynamics\":{\"duration\":5000}}\n" +
+		"grouped_light/grouped-1 {\"dimming_delta\":{\"action\":\"stop\"}}"
+	if got := formatUpdates(fake.sentUpdates()); got != want {
+		t.Fatalf("bridge updates = %q, want %q", got, want)
+	}
+}
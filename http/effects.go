@@ -0,0 +1,102 @@
+package huehttp
+
+import (
+	"net/http"
+	"time"
+)
+
+// identifyLight makes a light breathe so it can be found in the house.
+func (handler *Handler) identifyLight(writer http.ResponseWriter, request *http.Request) {
+	if !isToggleMethod(request.Method) {
+		handler.writeError(writer, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	lightID, err := lightIDFromPath(request)
+	if err != nil {
+		handler.writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := allowLight(request, lightID); err != nil {
+		handler.writeError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+
+	started := time.Now()
+	state, err := handler.hueService.IdentifyLight(request.Context(), lightID)
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	handler.writeActionResult(writer, request, state, started)
+}
+
+// identifyRoom makes the lights of a room breathe.
+func (handler *Handler) identifyRoom(writer http.ResponseWriter, request *http.Request) {
+	if !isToggleMethod(request.Method) {
+		handler.writeError(writer, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	room := request.PathValue("name")
+	if err := allowRoom(request, room); err != nil {
+		handler.writeError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+
+	started := time.Now()
+	state, err := handler.hueService.IdentifyRoom(request.Context(), room)
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	handler.writeActionResult(writer, request, state, started)
+}
+
+// effectLight starts an effect on a light, or stops it with "none".
+func (handler *Handler) effectLight(writer http.ResponseWriter, request *http.Request) {
+	if !isToggleMethod(request.Method) {
+		handler.writeError(writer, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	lightID, err := lightIDFromPath(request)
+	if err != nil {
+		handler.writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := allowLight(request, lightID); err != nil {
+		handler.writeError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+
+	started := time.Now()
+	state, err := handler.hueService.SetLightEffect(request.Context(), lightID, request.PathValue("effect"))
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	handler.writeActionResult(writer, request, state, started)
+}
+
+// effectRoom starts an effect on the lights of a room that support it.
+func (handler *Handler) effectRoom(writer http.ResponseWriter, request *http.Request) {
+	if !isToggleMethod(request.Method) {
+		handler.writeError(writer, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	room := request.PathValue("name")
+	if err := allowRoom(request, room); err != nil {
+		handler.writeError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+
+	started := time.Now()
+	state, err := handler.hueService.SetRoomEffect(request.Context(), room, request.PathValue("effect"))
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	handler.writeActionResult(writer, request, state, started)
+}
@@ -0,0 +1,27 @@
+package huehttp
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEffectRoutes(t *testing.T) {
+	t.Parallel()
+
+	withEffects := func(fake *fakeBridge) {
+		fake.set("light", "light-3", "effects", map[string]any{"effect_values": []string{"no_effect", "candle", "fire"}})
+		fake.addLight("light-4", 4, "Hall lamp", false)
+		fake.set("light", "light-3", "alert", map[string]any{"action_values": []string{"breathe"}})
+	}
+	runRouteTests(t, withEffects, []routeTest{
+		{name: "identify light", method: http.MethodPost, target: "/identify/light/3?token=desk-token", wantStatus: http.StatusNoContent, wantUpdate: `light/light-3 {"alert":{"action":"breathe"}}`},
+		{name: "identify room", method: http.MethodGet, target: "/identify/room/Office?return=state&token=admin-token", wantStatus: http.StatusOK, wantBody: `"targetType":"room","target":"Office","on":false`, wantUpdate: `grouped_light/grouped-1 {"alert":{"action":"breathe"}}`},
+		{name: "effect on light", method: http.MethodPost, target: "/effect/light/3/candle?return=state&token=desk-token", wantStatus: http.StatusOK, wantBody: `"on":true,"effect":"candle"`, wantUpdate: `light/light-3 {"effects":{"effect":"candle"},"on":{"on":true}}`},
+		{name: "stop room effects", method: http.MethodPost, target: "/effect/room/Office/none?token=admin-token", wantStatus: http.StatusNoContent, wantUpdate: `light/light-3 {"effects":{"effect":"no_effect"}}`},
+		{name: "unsupported effect", method: http.MethodPost, target: "/effect/light/3/sparkle?token=admin-token", wantStatus: http.StatusBadRequest, wantBody: `want one of candle, fire`},
+		{name: "identify light without breathe", method: http.MethodPost, target: "/identify/light/4?token=admin-token", wantStatus: http.StatusBadRequest, wantBody: `does not support the breathe alert`},
+		{name: "identify light outside scope", method: http.MethodPost, target: "/identify/light/4?token=desk-token", wantStatus: http.StatusForbidden},
+		{name: "invalid identify light id", method: http.MethodGet, target: "/identify/light/lamp?token=admin-token", wantStatus: http.StatusBadRequest},
+		{name: "effect light outside scope", method: http.MethodGet, target: "/effect/light/4/candle?token=desk-token", wantStatus: http.StatusForbidden},
+	})
+}
@@ -0,0 +1,179 @@
+package huehttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"hueshelly/config"
+	"hueshelly/hue"
+)
+
+// fakeBridge serves the part of the Hue CLIP v2 API the service uses, so handler
+// tests run against a real hue.Service. Updates are recorded and switch the
+// stored lights and grouped lights on or off.
+type fakeBridge struct {
+	mu sync.Mutex
+	// resources holds the resources by type and id, encoded like the bridge does.
+	resources map[string]map[string]map[string]any
+	updates   []bridgeUpdate
+}
+
+// bridgeUpdate is a PUT received by the fake bridge.
+type bridgeUpdate struct {
+	// resource is "light", "grouped_light" or "scene".
+	resource string
+	id       string
+	body     map[string]any
+}
+
+func newFakeBridge() *fakeBridge {
+	return &fakeBridge{resources: map[string]map[string]map[string]any{
+		"room": {}, "zone": {}, "light": {}, "grouped_light": {}, "scene": {},
+	}}
+}
+
+// newFakeService starts a TLS server for fake and connects a service to it.
+func newFakeService(t *testing.T, fake *fakeBridge) *hue.Service {
+	t.Helper()
+
+	server := httptest.NewTLSServer(fake)
+	t.Cleanup(server.Close)
+
+	service, err := hue.New(context.Background(), config.Config{
+		HueBridgeIP:     strings.TrimPrefix(server.URL, "https://"),
+		HueUser:         "test-key",
+		BridgeRateLimit: config.BridgeRateLimit{QueueSize: 10},
+		Transitions:     config.Transitions{FadeOff: config.Duration(time.Minute)},
+		Dimming:         config.Dimming{RampDuration: config.Duration(5 * time.Second), MaxDuration: config.Duration(time.Minute)},
+	})
+	if err != nil {
+		t.Fatalf("hue.New() error = %v, want nil", err)
+	}
+	t.Cleanup(func() { _ = service.Close(context.Background()) })
+	return service
+}
+
+func (fake *fakeBridge) addLight(id string, v1ID int, name string, on bool) {
+	fake.add("light", map[string]any{
+		"id":       id,
+		"id_v1":    fmt.Sprintf("/lights/%d", v1ID),
+		"on":       map[string]any{"on": on},
+		"metadata": map[string]any{"name": name},
+		"dimming":  map[string]any{"brightness": 50.0},
+	})
+}
+
+func (fake *fakeBridge) addRoom(id, name, groupedLightID string, on bool, lightIDs ...string) {
+	children := make([]map[string]any, 0, len(lightIDs))
+	for _, lightID := range lightIDs {
+		children = append(children, map[string]any{"rid": lightID, "rtype": "light"})
+	}
+	fake.add("room", map[string]any{
+		"id":       id,
+		"metadata": map[string]any{"name": name},
+		"children": children,
+		"services": []map[string]any{{"rid": groupedLightID, "rtype": "grouped_light"}},
+	})
+	fake.add("grouped_light", map[string]any{
+		"id":      groupedLightID,
+		"on":      map[string]any{"on": on},
+		"dimming": map[string]any{"brightness": 50.0},
+	})
+}
+
+func (fake *fakeBridge) addScene(id, name, roomID string) {
+	fake.add("scene", map[string]any{
+		"id":       id,
+		"metadata": map[string]any{"name": name},
+		"group":    map[string]any{"rid": roomID, "rtype": "room"},
+	})
+}
+
+func (fake *fakeBridge) add(resource string, value map[string]any) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.resources[resource][value["id"].(string)] = value
+}
+
+// set replaces a field of a stored resource, e.g. to give a light effects.
+func (fake *fakeBridge) set(resource, id, field string, value any) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.resources[resource][id][field] = value
+}
+
+// sentUpdates returns the updates received so far.
+func (fake *fakeBridge) sentUpdates() []bridgeUpdate {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return append([]bridgeUpdate(nil), fake.updates...)
+}
+
+func (fake *fakeBridge) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Header.Get("hue-application-key") != "test-key" {
+		writer.WriteHeader(http.StatusForbidden)
+		return
+	}
+	path, ok := strings.CutPrefix(request.URL.Path, "/clip/v2/resource/")
+	if !ok {
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+	resource, id, _ := strings.Cut(path, "/")
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	if resource == "bridge_home" {
+		writeFakeData(writer, []any{})
+		return
+	}
+	resources, known := fake.resources[resource]
+	if !known {
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if id == "" {
+		data := make([]any, 0, len(resources))
+		for _, value := range resources {
+			data = append(data, value)
+		}
+		writeFakeData(writer, data)
+		return
+	}
+	value, exists := resources[id]
+	if !exists {
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch request.Method {
+	case http.MethodGet:
+		writeFakeData(writer, []any{value})
+	case http.MethodPut:
+		var body map[string]any
+		if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fake.updates = append(fake.updates, bridgeUpdate{resource: resource, id: id, body: body})
+		if on, switched := body["on"]; switched && resource != "scene" {
+			value["on"] = on
+		}
+		writeFakeData(writer, []any{map[string]any{"rid": id, "rtype": resource}})
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func writeFakeData(writer http.ResponseWriter, data []any) {
+	writer.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(writer).Encode(map[string]any{"errors": []any{}, "data": data})
+}
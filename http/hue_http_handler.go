@@ -2,28 +2,50 @@ package huehttp
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
 	"net/url"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"hueshelly/config"
 	"hueshelly/hue"
 	"hueshelly/logging"
+	"hueshelly/metrics"
+	"hueshelly/routine"
+	"hueshelly/schedule"
 )
 
 var errNilHueService = errors.New("hue service is nil")
 
 type Handler struct {
 	hueService *hue.Service
+	auth       *authenticator
+	tlsConfig  config.TLS
+	dedup      *deduplicator
+	routines   *routine.Runner
+	scheduler  *schedule.Scheduler
+	mux        *http.ServeMux
+	// routes lists the registered patterns; the OpenAPI contract test compares them with the spec.
+	routes []string
+
+	serverMu sync.Mutex
+	servers  []*http.Server
+	stopped  bool
 }
 
 type errorResponse struct {
+	// Code is a stable, machine-readable identifier such as "not_found".
+	Code  string `json:"code"`
 	Error string `json:"error"`
 }
 
@@ -41,6 +63,7 @@ type homePageData struct {
 	GeneratedAt string
 	Rooms       []roomResponse
 	Lights      []lightResponse
+	Routines    []config.Routine
 }
 
 var homePageTemplate = template.Must(template.New("home").Funcs(template.FuncMap{
@@ -63,17 +86,25 @@ var homePageTemplate = template.Must(template.New("home").Funcs(template.FuncMap
     a { color: #0b66d0; text-decoration: none; }
     a:hover { text-decoration: underline; }
     code { background: #f1f4f8; padding: 2px 4px; border-radius: 4px; }
+    button { font: inherit; font-size: 13px; padding: 3px 10px; border: 1px solid #c3ccd6; border-radius: 6px; background: #ffffff; cursor: pointer; }
+    button:hover { background: #eef3f9; }
   </style>
 </head>
 <body>
   <div class="container">
     <h1>hueshelly</h1>
-    <div class="meta">Generated at {{.GeneratedAt}}</div>
+    <div class="meta">Generated at {{.GeneratedAt}}. Control rooms on the <a href="/dashboard">dashboard</a> or build Shelly action URLs with the <a href="/url-builder">URL builder</a>.</div>
     <div class="panel">
       <h2>Endpoints</h2>
       <p><a href="/groups">/groups</a> full group and light JSON</p>
       <p><a href="/rooms">/rooms</a> room list JSON</p>
       <p><a href="/lights">/lights</a> light list JSON (flattened)</p>
+      <p><a href="/timers">/timers</a> pending auto-off timers (start one with <code>?for=10m</code> on a toggle URL)</p>
+      <p><a href="/schedules">/schedules</a> schedules with upcoming runs and last results</p>
+      <p><code>/identify/light/{id}</code> and <code>/effect/light/{id}/{effect}</code> flash a light or start an effect such as candle (also for rooms)</p>
+      <p><a href="/metrics">/metrics</a> Prometheus metrics</p>
+      <p><a href="/docs">/docs</a> API documentation (<a href="/openapi.json">OpenAPI 3 document</a>)</p>
+      <p><a href="/api/v1/rooms">/api/v1</a> REST API for rooms, zones, lights and scenes (<code>PUT …/{id}/state</code> with a JSON body)</p>
     </div>
     <div class="panel">
       <h2>Rooms</h2>
@@ -94,7 +125,7 @@ var homePageTemplate = template.Must(template.New("home").Funcs(template.FuncMap
     <div class="panel">
       <h2>Lights</h2>
       <table>
-        <thead><tr><th>ID</th><th>Name</th><th>Room</th><th>Toggle URL</th></tr></thead>
+        <thead><tr><th>ID</th><th>Name</th><th>Room</th><th>Toggle URL</th><th></th></tr></thead>
         <tbody>
         {{range .Lights}}
           <tr>
@@ -102,44 +133,176 @@ var homePageTemplate = template.Must(template.New("home").Funcs(template.FuncMap
             <td>{{.Name}}</td>
             <td>{{.Room}}</td>
             <td><code>/toggle/light/{{.ID}}</code></td>
+            <td><button type="button" data-identify="/identify/light/{{.ID}}">Identify</button></td>
           </tr>
         {{else}}
-          <tr><td colspan="4">No lights found.</td></tr>
+          <tr><td colspan="5">No lights found.</td></tr>
         {{end}}
         </tbody>
       </table>
     </div>
+    {{if .Routines}}
+    <div class="panel">
+      <h2>Routines</h2>
+      <table>
+        <thead><tr><th>Routine</th><th>Steps</th><th>Trigger URL</th></tr></thead>
+        <tbody>
+        {{range .Routines}}
+          <tr>
+            <td>{{.Name}}</td>
+            <td>{{range $i, $step := .Steps}}{{if $i}}, {{end}}{{$step.Action}}{{with $step.Target}} {{.}}{{end}}{{end}}</td>
+            <td><code>/routine/{{pathEscape .Name}}</code></td>
+          </tr>
+        {{end}}
+        </tbody>
+      </table>
+    </div>
+    {{end}}
   </div>
+  <script>
+    // Identify buttons POST to the identify route, keeping ?token= from the page URL.
+    document.querySelectorAll("button[data-identify]").forEach(function (button) {
+      button.addEventListener("click", function () {
+        button.disabled = true;
+        fetch(button.dataset.identify + window.location.search, { method: "POST" })
+          .then(function (response) { button.textContent = response.ok ? "Identify" : "Failed"; })
+          .catch(function () { button.textContent = "Failed"; })
+          .finally(function () { button.disabled = false; });
+      });
+    });
+  </script>
 </body>
 </html>`))
 
-func New(hueService *hue.Service) (*Handler, error) {
+func New(hueService *hue.Service, cfg config.Config) (*Handler, error) {
 	if hueService == nil {
 		return nil, errNilHueService
 	}
-	return &Handler{hueService: hueService}, nil
+	auth, err := newAuthenticator(cfg.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("configure auth: %w", err)
+	}
+
+	routines := routine.New(hueService, cfg.Routines)
+	scheduler, err := schedule.New(routines, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("configure schedules: %w", err)
+	}
+
+	handler := &Handler{
+		hueService: hueService,
+		auth:       auth,
+		tlsConfig:  cfg.TLS,
+		dedup:      newDeduplicator(cfg.ToggleDebounce.Duration(), cfg.IdempotencyKeyTTL.Duration()),
+		routines:   routines,
+		scheduler:  scheduler,
+		mux:        http.NewServeMux(),
+	}
+	handler.registerRoutes()
+	scheduler.Start()
+	return handler, nil
 }
 
+func (handler *Handler) registerRoutes() {
+	mux := handler.mux
+	handler.handle(mux, "/toggle/lights/group/", actionToggle, handler.toggleLightsRoom)
+	handler.handle(mux, "/toggle/light/", actionToggle, handler.toggleLight)
+	handler.handle(mux, "/groups", actionRead, handler.groups)
+	handler.handle(mux, "/rooms", actionRead, handler.rooms)
+	handler.handle(mux, "/lights", actionRead, handler.lights)
+	handler.handle(mux, "POST /batch", actionToggle, handler.batch)
+	handler.handle(mux, "/routine/{name}", actionToggle, handler.runRoutine)
+	handler.handle(mux, "/fade-off/light/{id}", actionToggle, handler.fadeOffLight)
+	handler.handle(mux, "/fade-off/room/{name}", actionToggle, handler.fadeOffRoom)
+	handler.handle(mux, "/dim/light/{id}/{action}", actionToggle, handler.dimLight)
+	handler.handle(mux, "/dim/room/{name}/{action}", actionToggle, handler.dimRoom)
+	handler.handle(mux, "/identify/light/{id}", actionToggle, handler.identifyLight)
+	handler.handle(mux, "/identify/room/{name}", actionToggle, handler.identifyRoom)
+	handler.handle(mux, "/effect/light/{id}/{effect}", actionToggle, handler.effectLight)
+	handler.handle(mux, "/effect/room/{name}/{effect}", actionToggle, handler.effectRoom)
+	handler.handle(mux, "GET /timers", actionRead, handler.timers)
+	handler.handle(mux, "GET /schedules", actionRead, handler.schedules)
+	handler.handle(mux, "POST /schedules/{name}/pause", actionToggle, handler.pauseSchedule)
+	handler.handle(mux, "POST /schedules/{name}/resume", actionToggle, handler.resumeSchedule)
+	handler.handle(mux, "/metrics", actionMetrics, metrics.Handler().ServeHTTP)
+	handler.handle(mux, "/", actionRead, handler.home)
+	handler.handle(mux, "GET /openapi.json", actionRead, handler.openAPI)
+	handler.handle(mux, "GET /docs", actionRead, handler.docs)
+	handler.handle(mux, "GET /dashboard", actionRead, handler.dashboard)
+	handler.handle(mux, "GET /url-builder", actionRead, handler.urlBuilder)
+	handler.registerAPIRoutes()
+}
+
+// Start serves plain HTTP on addr until Shutdown is called.
 func (handler *Handler) Start(addr string) error {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/toggle/lights/group/", handler.toggleLightsRoom)
-	mux.HandleFunc("/toggle/light/", handler.toggleLight)
-	mux.HandleFunc("/groups", handler.groups)
-	mux.HandleFunc("/rooms", handler.rooms)
-	mux.HandleFunc("/lights", handler.lights)
-	mux.HandleFunc("/", handler.home)
-
-	server := http.Server{
+	server, err := handler.newServer(addr)
+	if err != nil {
+		return err
+	}
+
+	logging.Logger.Println("Starting server on", addr)
+	return server.ListenAndServe()
+}
+
+// StartTLS serves HTTPS on addr with the configured or self-signed certificate until Shutdown is called.
+func (handler *Handler) StartTLS(addr string) error {
+	certificate, err := loadCertificate(handler.tlsConfig)
+	if err != nil {
+		return err
+	}
+	server, err := handler.newServer(addr)
+	if err != nil {
+		return err
+	}
+	server.TLSConfig = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{certificate},
+	}
+
+	logging.Logger.Println("Starting TLS server on", addr)
+	return server.ListenAndServeTLS("", "")
+}
+
+func (handler *Handler) newServer(addr string) (*http.Server, error) {
+	server := &http.Server{
 		Addr:              addr,
-		Handler:           mux,
+		Handler:           handler.mux,
 		ReadHeaderTimeout: 5 * time.Second,
 		ReadTimeout:       10 * time.Second,
 		WriteTimeout:      10 * time.Second,
 		IdleTimeout:       60 * time.Second,
 	}
 
-	logging.Logger.Println("Starting server on", addr)
-	return server.ListenAndServe()
+	handler.serverMu.Lock()
+	defer handler.serverMu.Unlock()
+	if handler.stopped {
+		return nil, http.ErrServerClosed
+	}
+	handler.servers = append(handler.servers, server)
+	return server, nil
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests until ctx expires.
+func (handler *Handler) Shutdown(ctx context.Context) error {
+	handler.serverMu.Lock()
+	handler.stopped = true
+	servers := append([]*http.Server(nil), handler.servers...)
+	handler.serverMu.Unlock()
+
+	var errs []error
+	for _, server := range servers {
+		logging.Logger.Println("Stopping server on", server.Addr)
+		if err := server.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shutdown server on %s: %w", server.Addr, err))
+		}
+	}
+	if err := handler.scheduler.Close(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	if err := handler.routines.Close(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
 }
 
 func (handler *Handler) toggleLightsRoom(writer http.ResponseWriter, request *http.Request) {
@@ -153,13 +316,36 @@ func (handler *Handler) toggleLightsRoom(writer http.ResponseWriter, request *ht
 		handler.writeError(writer, http.StatusBadRequest, err.Error())
 		return
 	}
+	duration, err := parseFor(request)
+	if err != nil {
+		handler.writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	transition, err := parseTransition(request)
+	if err != nil {
+		handler.writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := allowRoom(request, room); err != nil {
+		handler.writeError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+	admitted, suppressed := handler.suppressToggle(writer, request, "room", room, func(ctx context.Context) (hue.State, error) {
+		return handler.hueService.RoomState(ctx, room)
+	})
+	if suppressed {
+		return
+	}
 
-	if err := handler.hueService.ToggleLightsInRoom(room); err != nil {
-		handler.writeError(writer, http.StatusInternalServerError, err.Error())
+	started := time.Now()
+	state, err := handler.hueService.ToggleLightsInRoomWith(request.Context(), room, hue.ToggleOptions{For: duration, Transition: transition})
+	if err != nil {
+		admitted.forget()
+		handler.writeServiceError(writer, err)
 		return
 	}
 
-	writer.WriteHeader(http.StatusNoContent)
+	handler.writeActionResult(writer, request, state, started)
 }
 
 func (handler *Handler) toggleLight(writer http.ResponseWriter, request *http.Request) {
@@ -173,13 +359,36 @@ func (handler *Handler) toggleLight(writer http.ResponseWriter, request *http.Re
 		handler.writeError(writer, http.StatusBadRequest, err.Error())
 		return
 	}
+	duration, err := parseFor(request)
+	if err != nil {
+		handler.writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	transition, err := parseTransition(request)
+	if err != nil {
+		handler.writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := allowLight(request, lightID); err != nil {
+		handler.writeError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+	admitted, suppressed := handler.suppressToggle(writer, request, "light", strconv.Itoa(lightID), func(ctx context.Context) (hue.State, error) {
+		return handler.hueService.LightState(ctx, lightID)
+	})
+	if suppressed {
+		return
+	}
 
-	if err := handler.hueService.ToggleLight(lightID); err != nil {
-		handler.writeError(writer, http.StatusInternalServerError, err.Error())
+	started := time.Now()
+	state, err := handler.hueService.ToggleLightWith(request.Context(), lightID, hue.ToggleOptions{For: duration, Transition: transition})
+	if err != nil {
+		admitted.forget()
+		handler.writeServiceError(writer, err)
 		return
 	}
 
-	writer.WriteHeader(http.StatusNoContent)
+	handler.writeActionResult(writer, request, state, started)
 }
 
 func (handler *Handler) groups(writer http.ResponseWriter, request *http.Request) {
@@ -188,13 +397,13 @@ func (handler *Handler) groups(writer http.ResponseWriter, request *http.Request
 		return
 	}
 
-	groups, err := handler.hueService.AvailableGroups()
+	groups, err := handler.hueService.AvailableGroups(request.Context())
 	if err != nil {
-		handler.writeError(writer, http.StatusInternalServerError, err.Error())
+		handler.writeServiceError(writer, err)
 		return
 	}
 
-	handler.writeJSON(writer, http.StatusOK, groups)
+	handler.writeJSON(writer, http.StatusOK, visibleGroupLights(request, groups))
 }
 
 func (handler *Handler) rooms(writer http.ResponseWriter, request *http.Request) {
@@ -203,13 +412,13 @@ func (handler *Handler) rooms(writer http.ResponseWriter, request *http.Request)
 		return
 	}
 
-	groups, err := handler.hueService.AvailableGroups()
+	groups, err := handler.hueService.AvailableGroups(request.Context())
 	if err != nil {
-		handler.writeError(writer, http.StatusInternalServerError, err.Error())
+		handler.writeServiceError(writer, err)
 		return
 	}
 
-	handler.writeJSON(writer, http.StatusOK, collectRooms(groups))
+	handler.writeJSON(writer, http.StatusOK, collectRooms(visibleRooms(request, groups)))
 }
 
 func (handler *Handler) lights(writer http.ResponseWriter, request *http.Request) {
@@ -218,13 +427,13 @@ func (handler *Handler) lights(writer http.ResponseWriter, request *http.Request
 		return
 	}
 
-	groups, err := handler.hueService.AvailableGroups()
+	groups, err := handler.hueService.AvailableGroups(request.Context())
 	if err != nil {
-		handler.writeError(writer, http.StatusInternalServerError, err.Error())
+		handler.writeServiceError(writer, err)
 		return
 	}
 
-	handler.writeJSON(writer, http.StatusOK, collectLights(groups))
+	handler.writeJSON(writer, http.StatusOK, collectLights(visibleGroupLights(request, groups)))
 }
 
 func (handler *Handler) home(writer http.ResponseWriter, request *http.Request) {
@@ -237,16 +446,17 @@ func (handler *Handler) home(writer http.ResponseWriter, request *http.Request)
 		return
 	}
 
-	groups, err := handler.hueService.AvailableGroups()
+	groups, err := handler.hueService.AvailableGroups(request.Context())
 	if err != nil {
-		handler.writeError(writer, http.StatusInternalServerError, err.Error())
+		handler.writeServiceError(writer, err)
 		return
 	}
 
 	pageData := homePageData{
 		GeneratedAt: time.Now().Format(time.RFC1123),
-		Rooms:       collectRooms(groups),
-		Lights:      collectLights(groups),
+		Rooms:       collectRooms(visibleRooms(request, groups)),
+		Lights:      collectLights(visibleGroupLights(request, groups)),
+		Routines:    handler.routines.Routines(),
 	}
 
 	var page bytes.Buffer
@@ -263,8 +473,97 @@ func (handler *Handler) home(writer http.ResponseWriter, request *http.Request)
 }
 
 func (handler *Handler) writeError(writer http.ResponseWriter, statusCode int, message string) {
+	handler.writeErrorCode(writer, statusCode, errorCodeForStatus(statusCode), message)
+}
+
+func (handler *Handler) writeErrorCode(writer http.ResponseWriter, statusCode int, code string, message string) {
 	logging.Logger.Println(message)
-	handler.writeJSON(writer, statusCode, errorResponse{Error: message})
+	handler.writeJSON(writer, statusCode, errorResponse{Code: code, Error: message})
+}
+
+// serviceErrors maps the error kinds of the hue service to responses. The
+// first matching entry wins, so more specific kinds come first.
+var serviceErrors = []struct {
+	kind       error
+	statusCode int
+	code       string
+}{
+	{hue.ErrInvalidParameter, http.StatusBadRequest, "invalid_parameter"},
+	{hue.ErrNotFound, http.StatusNotFound, "not_found"},
+	{hue.ErrAmbiguous, http.StatusConflict, "ambiguous"},
+	{hue.ErrUnauthorized, http.StatusUnauthorized, "bridge_unauthorized"},
+	{hue.ErrRateLimited, http.StatusTooManyRequests, "rate_limited"},
+	{hue.ErrBridgeUnreachable, http.StatusBadGateway, "bridge_unreachable"},
+	{hue.ErrBridgeUnavailable, http.StatusServiceUnavailable, "bridge_unavailable"},
+}
+
+// writeServiceError maps errors returned by the hue service to a status code and error code.
+func (handler *Handler) writeServiceError(writer http.ResponseWriter, err error) {
+	statusCode, code := serviceErrorStatus(err)
+	if statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable {
+		writer.Header().Set("Retry-After", "1")
+	}
+	handler.writeErrorCode(writer, statusCode, code, err.Error())
+}
+
+func serviceErrorStatus(err error) (int, string) {
+	for _, mapping := range serviceErrors {
+		if errors.Is(err, mapping.kind) {
+			return mapping.statusCode, mapping.code
+		}
+	}
+	return http.StatusInternalServerError, "internal_error"
+}
+
+// errorCodeForStatus returns the error code used for errors raised by the HTTP layer itself.
+func errorCodeForStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return "invalid_parameter"
+	case http.StatusUnauthorized:
+		return "unauthorized"
+	case http.StatusForbidden:
+		return "forbidden"
+	case http.StatusNotFound:
+		return "not_found"
+	case http.StatusMethodNotAllowed:
+		return "method_not_allowed"
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	case http.StatusServiceUnavailable:
+		return "unavailable"
+	default:
+		return "internal_error"
+	}
+}
+
+// stateResponse is returned by action endpoints when the caller asks for the resulting state.
+type stateResponse struct {
+	hue.State
+	DurationMs int64 `json:"durationMs"`
+}
+
+// writeActionResult responds with 204 No Content, or with the state that was sent
+// when the caller asked for it with ?return=state or an Accept: application/json header.
+func (handler *Handler) writeActionResult(writer http.ResponseWriter, request *http.Request, state hue.State, started time.Time) {
+	if !wantsState(request) {
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+	handler.writeJSON(writer, http.StatusOK, stateResponse{State: state, DurationMs: time.Since(started).Milliseconds()})
+}
+
+func wantsState(request *http.Request) bool {
+	if request.URL.Query().Get("return") == "state" {
+		return true
+	}
+	for _, mediaType := range strings.Split(request.Header.Get("Accept"), ",") {
+		mediaType, _, _ = strings.Cut(mediaType, ";")
+		if strings.EqualFold(strings.TrimSpace(mediaType), "application/json") {
+			return true
+		}
+	}
+	return false
 }
 
 func (handler *Handler) writeJSON(writer http.ResponseWriter, statusCode int, value any) {
@@ -278,6 +577,9 @@ func (handler *Handler) writeJSON(writer http.ResponseWriter, statusCode int, va
 	}
 }
 
+// maxRoomNameLength is the longest room name, in bytes, the toggle route accepts.
+const maxRoomNameLength = 32
+
 func parseRoomName(path string) (string, error) {
 	const prefix = "/toggle/lights/group/"
 	if !strings.HasPrefix(path, prefix) {
@@ -288,7 +590,7 @@ func parseRoomName(path string) (string, error) {
 	switch {
 	case room == "":
 		return "", errors.New("given group name is not valid")
-	case len(room) > 32:
+	case len(room) > maxRoomNameLength:
 		return "", errors.New("given group name is not valid")
 	case strings.Contains(room, "/"):
 		return "", errors.New("given group name is not valid")
@@ -318,6 +620,31 @@ func isToggleMethod(method string) bool {
 	return method == http.MethodGet || method == http.MethodPost
 }
 
+// visibleRooms drops the rooms a scoped token may not control.
+func visibleRooms(request *http.Request, groups []hue.Group) []hue.Group {
+	return slices.DeleteFunc(slices.Clone(groups), func(group hue.Group) bool {
+		return allowRoom(request, group.Name) != nil
+	})
+}
+
+// visibleGroupLights keeps the lights a scoped token may control: all lights of
+// its rooms and the lights it names. Rooms left without lights are dropped.
+func visibleGroupLights(request *http.Request, groups []hue.Group) []hue.Group {
+	visible := make([]hue.Group, 0, len(groups))
+	for _, group := range groups {
+		if allowRoom(request, group.Name) != nil {
+			group.Lights = slices.DeleteFunc(slices.Clone(group.Lights), func(light hue.Light) bool {
+				return allowLight(request, light.ID) != nil
+			})
+			if len(group.Lights) == 0 {
+				continue
+			}
+		}
+		visible = append(visible, group)
+	}
+	return visible
+}
+
 func collectRooms(groups []hue.Group) []roomResponse {
 	rooms := make([]roomResponse, 0, len(groups))
 	for _, group := range groups {
@@ -1,8 +1,15 @@
 package huehttp
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"hueshelly/hue"
 )
@@ -149,3 +156,180 @@ func TestCollectLights(t *testing.T) {
 		t.Fatalf("collectLights() = %#v, want %#v", got, want)
 	}
 }
+
+func TestLegacyListingsScoped(t *testing.T) {
+	t.Parallel()
+
+	hall := func(fake *fakeBridge) {
+		fake.addLight("light-4", 4, "Hall lamp", false)
+		fake.addRoom("room-2", "Hall", "grouped-2", false, "light-4")
+	}
+	runRouteTests(t, hall, []routeTest{
+		{name: "admin rooms", method: http.MethodGet, target: "/rooms?token=admin-token", wantStatus: http.StatusOK, wantBody: `[{"name":"Hall"},{"name":"Office"}]`},
+		{name: "room token rooms", method: http.MethodGet, target: "/rooms?token=office-token", wantStatus: http.StatusOK, wantBody: `[{"name":"Office"}]`},
+		{name: "room token lights", method: http.MethodGet, target: "/lights?token=office-token", wantStatus: http.StatusOK, wantBody: `[{"id":3,"name":"Desk","room":"Office"}]`},
+		{name: "light token lights", method: http.MethodGet, target: "/lights?token=desk-token", wantStatus: http.StatusOK, wantBody: `[{"id":3,"name":"Desk","room":"Office"}]`},
+		{name: "light token rooms", method: http.MethodGet, target: "/rooms?token=desk-token", wantStatus: http.StatusOK, wantBody: `[]`},
+		{name: "light token groups", method: http.MethodGet, target: "/groups?token=desk-token", wantStatus: http.StatusOK, wantBody: `[{"name":"Office","togglePolicy":"any-on","lights":[{"name":"Desk","id":3}]}]`},
+	})
+}
+
+func TestWriteServiceErrorQueueFull(t *testing.T) {
+	t.Parallel()
+
+	recorder := httptest.NewRecorder()
+	(&Handler{}).writeServiceError(recorder, fmt.Errorf("toggle: %w", hue.ErrQueueFull))
+
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusTooManyRequests)
+	}
+	if got := recorder.Header().Get("Retry-After"); got != "1" {
+		t.Fatalf("Retry-After = %q, want %q", got, "1")
+	}
+}
+
+func TestWriteServiceErrorCodes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "not found", err: fmt.Errorf("toggle: %w", hue.ErrNotFound), wantStatus: http.StatusNotFound, wantCode: "not_found"},
+		{name: "ambiguous", err: hue.ErrAmbiguous, wantStatus: http.StatusConflict, wantCode: "ambiguous"},
+		{name: "invalid parameter", err: hue.ErrInvalidParameter, wantStatus: http.StatusBadRequest, wantCode: "invalid_parameter"},
+		{name: "unauthorized", err: hue.ErrUnauthorized, wantStatus: http.StatusUnauthorized, wantCode: "bridge_unauthorized"},
+		{name: "queue full", err: hue.ErrQueueFull, wantStatus: http.StatusTooManyRequests, wantCode: "rate_limited"},
+		{name: "unreachable", err: hue.ErrBridgeUnreachable, wantStatus: http.StatusBadGateway, wantCode: "bridge_unreachable"},
+		{name: "unavailable", err: hue.ErrBridgeUnavailable, wantStatus: http.StatusServiceUnavailable, wantCode: "bridge_unavailable"},
+		{name: "other", err: errors.New("boom"), wantStatus: http.StatusInternalServerError, wantCode: "internal_error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			recorder := httptest.NewRecorder()
+			(&Handler{}).writeServiceError(recorder, tt.err)
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			var body errorResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if body.Code != tt.wantCode || body.Error != tt.err.Error() {
+				t.Fatalf("body = %+v, want code %q and error %q", body, tt.wantCode, tt.err.Error())
+			}
+		})
+	}
+}
+
+func TestWriteActionResult(t *testing.T) {
+	t.Parallel()
+
+	brightness := 100.0
+	state := hue.State{TargetType: "room", Target: "Kitchen", On: true, Brightness: &brightness}
+
+	tests := []struct {
+		name       string
+		target     string
+		accept     string
+		wantStatus int
+	}{
+		{name: "default", target: "/toggle/lights/group/Kitchen", wantStatus: http.StatusNoContent},
+		{name: "browser accept", target: "/toggle/lights/group/Kitchen", accept: "text/html,*/*;q=0.8", wantStatus: http.StatusNoContent},
+		{name: "query", target: "/toggle/lights/group/Kitchen?return=state", wantStatus: http.StatusOK},
+		{name: "accept header", target: "/toggle/lights/group/Kitchen", accept: "application/json; charset=utf-8", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			request := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			if tt.accept != "" {
+				request.Header.Set("Accept", tt.accept)
+			}
+			recorder := httptest.NewRecorder()
+			(&Handler{}).writeActionResult(recorder, request, state, time.Now())
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var body stateResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if !reflect.DeepEqual(body.State, state) {
+				t.Fatalf("state = %+v, want %+v", body.State, state)
+			}
+		})
+	}
+}
+
+func TestBuilderRooms(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		room        string
+		wantPath    string
+		wantTooLong bool
+	}{
+		{name: "plain", room: "Office", wantPath: "Office"},
+		{name: "spaces and umlauts", room: "Küche oben", wantPath: "K%C3%BCche%20oben"},
+		{name: "limit", room: strings.Repeat("a", maxRoomNameLength), wantPath: strings.Repeat("a", maxRoomNameLength)},
+		// Umlauts take two bytes, so 17 of them exceed the limit.
+		{name: "too long in bytes", room: strings.Repeat("ü", 17), wantPath: strings.Repeat("%C3%BC", 17), wantTooLong: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := builderRooms([]roomResponse{{Name: tt.room}})
+			if len(got) != 1 || got[0].Path != tt.wantPath || got[0].TooLong != tt.wantTooLong {
+				t.Fatalf("builderRooms() = %+v, want path %q and tooLong %v", got, tt.wantPath, tt.wantTooLong)
+			}
+		})
+	}
+}
+
+func TestURLBuilderServed(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-3", 3, "Desk", false)
+	fake.addRoom("room-1", "Küche oben", "grouped-1", false, "light-3")
+	handler := newAPITestHandler(t, fake)
+
+	recorder := httptest.NewRecorder()
+	handler.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/url-builder", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("GET /url-builder without token status = %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/url-builder?token=admin-token", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("GET /url-builder status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/html") {
+		t.Fatalf("GET /url-builder Content-Type = %q, want text/html", contentType)
+	}
+	body := recorder.Body.String()
+	for _, want := range []string{
+		`"name":"Küche oben","path":"K%C3%BCche%20oben"`,
+		`"name":"Desk"`,
+		"var tokensRequired =  true ;",
+		`"btn1_on_url"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("GET /url-builder body does not contain %q", want)
+		}
+	}
+}
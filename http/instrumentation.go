@@ -0,0 +1,53 @@
+package huehttp
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"hueshelly/metrics"
+)
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (recorder *statusRecorder) WriteHeader(statusCode int) {
+	recorder.statusCode = statusCode
+	recorder.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (recorder *statusRecorder) Unwrap() http.ResponseWriter {
+	return recorder.ResponseWriter
+}
+
+// handle registers a handler on the mux that requires the given action and
+// records request metrics labelled with the route pattern.
+func (handler *Handler) handle(mux *http.ServeMux, pattern, action string, handlerFunc http.HandlerFunc) {
+	handler.routes = append(handler.routes, pattern)
+	mux.Handle(pattern, instrument(pattern, handler.authenticate(action, handlerFunc)))
+}
+
+func instrument(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: writer, statusCode: http.StatusOK}
+		next.ServeHTTP(recorder, request)
+
+		metrics.HTTPRequestDuration.Observe(time.Since(start).Seconds(), route)
+		metrics.HTTPRequests.Inc(route, methodLabel(request.Method), strconv.Itoa(recorder.statusCode))
+	})
+}
+
+// methodLabel maps the request method to a known label. Clients choose the
+// method freely, so anything else is counted as "other".
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodHead, http.MethodOptions:
+		return method
+	default:
+		return "other"
+	}
+}
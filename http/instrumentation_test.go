@@ -0,0 +1,42 @@
+package huehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"hueshelly/metrics"
+)
+
+func TestInstrumentRecordsStatusByRoute(t *testing.T) {
+	t.Parallel()
+
+	const route = "/instrumentation-test/"
+	handler := instrument(route, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusTeapot)
+	}))
+
+	before := metrics.HTTPRequests.Value(route, http.MethodPost, "418")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, route+"abc", nil))
+
+	if got := metrics.HTTPRequests.Value(route, http.MethodPost, "418"); got != before+1 {
+		t.Fatalf("HTTPRequests = %v, want %v", got, before+1)
+	}
+}
+
+func TestInstrumentBoundsMethodLabel(t *testing.T) {
+	t.Parallel()
+
+	const route = "/instrumentation-method-test/"
+	handler := instrument(route, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+
+	before := metrics.HTTPRequests.Value(route, "other", "200")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", route, nil))
+
+	if got := metrics.HTTPRequests.Value(route, "other", "200"); got != before+1 {
+		t.Fatalf("HTTPRequests for method other = %v, want %v", got, before+1)
+	}
+	if got := metrics.HTTPRequests.Value(route, "BREW", "200"); got != 0 {
+		t.Fatalf("HTTPRequests for method BREW = %v, want no series", got)
+	}
+}
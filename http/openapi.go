@@ -0,0 +1,34 @@
+package huehttp
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+
+	"hueshelly/logging"
+)
+
+// openAPIDocument is maintained by hand. TestOpenAPIContract fails when it no
+// longer matches the registered routes or the JSON shapes of the responses.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+//go:embed docs.html
+var docsPage []byte
+
+func (handler *Handler) openAPI(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+	writer.WriteHeader(http.StatusOK)
+	if _, err := writer.Write(openAPIDocument); err != nil {
+		logging.Logger.Println(fmt.Errorf("write OpenAPI document: %w", err))
+	}
+}
+
+func (handler *Handler) docs(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.WriteHeader(http.StatusOK)
+	if _, err := writer.Write(docsPage); err != nil {
+		logging.Logger.Println(fmt.Errorf("write docs page: %w", err))
+	}
+}
@@ -0,0 +1,197 @@
+package huehttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"hueshelly/config"
+	"hueshelly/hue"
+	"hueshelly/routine"
+	"hueshelly/schedule"
+)
+
+type openAPISpec struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+// legacyRoutes describes the patterns registered without a method: their path in
+// the spec and the methods they accept.
+var legacyRoutes = map[string]struct {
+	path    string
+	methods []string
+}{
+	"/":                            {path: "/", methods: []string{"get"}},
+	"/groups":                      {path: "/groups", methods: []string{"get"}},
+	"/rooms":                       {path: "/rooms", methods: []string{"get"}},
+	"/lights":                      {path: "/lights", methods: []string{"get"}},
+	"/metrics":                     {path: "/metrics", methods: []string{"get"}},
+	"/toggle/lights/group/":        {path: "/toggle/lights/group/{room}", methods: []string{"get", "post"}},
+	"/toggle/light/":               {path: "/toggle/light/{id}", methods: []string{"get", "post"}},
+	"/routine/{name}":              {path: "/routine/{name}", methods: []string{"get", "post"}},
+	"/fade-off/light/{id}":         {path: "/fade-off/light/{id}", methods: []string{"get", "post"}},
+	"/fade-off/room/{name}":        {path: "/fade-off/room/{name}", methods: []string{"get", "post"}},
+	"/dim/light/{id}/{action}":     {path: "/dim/light/{id}/{action}", methods: []string{"get", "post"}},
+	"/dim/room/{name}/{action}":    {path: "/dim/room/{name}/{action}", methods: []string{"get", "post"}},
+	"/identify/light/{id}":         {path: "/identify/light/{id}", methods: []string{"get", "post"}},
+	"/identify/room/{name}":        {path: "/identify/room/{name}", methods: []string{"get", "post"}},
+	"/effect/light/{id}/{effect}":  {path: "/effect/light/{id}/{effect}", methods: []string{"get", "post"}},
+	"/effect/room/{name}/{effect}": {path: "/effect/room/{name}/{effect}", methods: []string{"get", "post"}},
+}
+
+// openAPISchemas maps every schema in the spec to the Go type encoded for it.
+var openAPISchemas = map[string]any{
+	"Error":             errorResponse{},
+	"Light":             hue.Light{},
+	"Group":             hue.Group{},
+	"RoomSummary":       roomResponse{},
+	"LightSummary":      lightResponse{},
+	"Room":              hue.Room{},
+	"LightDetails":      hue.LightDetails{},
+	"Scene":             hue.Scene{},
+	"StateChange":       hue.StateChange{},
+	"SceneState":        sceneStateRequest{},
+	"StateResponse":     stateResponse{},
+	"State":             hue.State{},
+	"XY":                hue.XY{},
+	"LightResult":       hue.LightResult{},
+	"BatchRequest":      batchRequest{},
+	"BatchAction":       batchAction{},
+	"BatchResult":       batchResult{},
+	"BatchResponse":     batchResponse{},
+	"RoutineResult":     routine.Result{},
+	"RoutineStepResult": routine.StepResult{},
+	"Timer":             hue.Timer{},
+	"ScheduleStatus":    schedule.Status{},
+	"ScheduleRun":       schedule.Run{},
+	"RoutineStep":       config.RoutineStep{},
+}
+
+func loadOpenAPISpec(t *testing.T) openAPISpec {
+	t.Helper()
+
+	var spec openAPISpec
+	if err := json.Unmarshal(openAPIDocument, &spec); err != nil {
+		t.Fatalf("decode openapi.json: %v", err)
+	}
+	return spec
+}
+
+func TestOpenAPIContractRoutes(t *testing.T) {
+	t.Parallel()
+
+	handler, err := New(&hue.Service{}, config.Config{})
+	if err != nil {
+		t.Fatalf("New() error = %v, want nil", err)
+	}
+	spec := loadOpenAPISpec(t)
+
+	registered := map[string]bool{}
+	for _, pattern := range handler.routes {
+		method, path, hasMethod := strings.Cut(pattern, " ")
+		if hasMethod {
+			registered[strings.ToLower(method)+" "+path] = true
+			continue
+		}
+		legacy, ok := legacyRoutes[pattern]
+		if !ok {
+			t.Fatalf("route %q has no method; describe it in legacyRoutes and openapi.json", pattern)
+		}
+		for _, method := range legacy.methods {
+			registered[method+" "+legacy.path] = true
+		}
+	}
+
+	documented := map[string]bool{}
+	for path, item := range spec.Paths {
+		for method := range item {
+			if slices.Contains([]string{"get", "post", "put", "patch", "delete"}, method) {
+				documented[method+" "+path] = true
+			}
+		}
+	}
+
+	for operation := range registered {
+		if !documented[operation] {
+			t.Errorf("route %q is not documented in openapi.json", operation)
+		}
+	}
+	for operation := range documented {
+		if !registered[operation] {
+			t.Errorf("openapi.json documents %q, but no such route is registered", operation)
+		}
+	}
+}
+
+func TestOpenAPIContractSchemas(t *testing.T) {
+	t.Parallel()
+
+	spec := loadOpenAPISpec(t)
+	for name, schema := range spec.Components.Schemas {
+		value, ok := openAPISchemas[name]
+		if !ok {
+			t.Errorf("schema %q has no Go type in openAPISchemas", name)
+			continue
+		}
+
+		documented := make([]string, 0, len(schema.Properties))
+		for property := range schema.Properties {
+			documented = append(documented, property)
+		}
+		slices.Sort(documented)
+		if fields := jsonFields(reflect.TypeOf(value)); !slices.Equal(fields, documented) {
+			t.Errorf("schema %q properties = %v, want JSON fields of %T %v", name, documented, value, fields)
+		}
+	}
+	for name := range openAPISchemas {
+		if _, ok := spec.Components.Schemas[name]; !ok {
+			t.Errorf("openAPISchemas lists %q, but openapi.json has no such schema", name)
+		}
+	}
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	t.Parallel()
+
+	handler, err := New(&hue.Service{}, config.Config{})
+	if err != nil {
+		t.Fatalf("New() error = %v, want nil", err)
+	}
+
+	for _, target := range []string{"/openapi.json", "/docs", "/dashboard"} {
+		recorder := httptest.NewRecorder()
+		handler.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, target, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("GET %s status = %d, want %d", target, recorder.Code, http.StatusOK)
+		}
+	}
+}
+
+// jsonFields returns the sorted JSON field names encoding/json uses for a struct type.
+func jsonFields(structType reflect.Type) []string {
+	var fields []string
+	for i := range structType.NumField() {
+		field := structType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch {
+		case name == "-" || !field.IsExported():
+		case field.Anonymous && name == "":
+			fields = append(fields, jsonFields(field.Type)...)
+		case name == "":
+			fields = append(fields, field.Name)
+		default:
+			fields = append(fields, name)
+		}
+	}
+	slices.Sort(fields)
+	return fields
+}
@@ -0,0 +1,97 @@
+package huehttp
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"hueshelly/config"
+	"hueshelly/routine"
+)
+
+// routineWait is how long a trigger waits for its routine before answering 202
+// Accepted. It stays below the server's write timeout; the routine keeps running.
+const routineWait = 5 * time.Second
+
+// runRoutine starts a configured routine and reports its result when it finishes within routineWait.
+func (handler *Handler) runRoutine(writer http.ResponseWriter, request *http.Request) {
+	if !isToggleMethod(request.Method) {
+		handler.writeError(writer, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	name := request.PathValue("name")
+	configured, ok := handler.routines.Routine(name)
+	if !ok {
+		handler.writeError(writer, http.StatusNotFound, fmt.Sprintf("routine %q not found", name))
+		return
+	}
+	if err := allowRoutine(request, configured); err != nil {
+		handler.writeError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+	// A routine has no single state, so a suppressed run always answers 204.
+	admitted, suppressed := handler.suppressToggle(writer, request, "routine", name, nil)
+	if suppressed {
+		return
+	}
+
+	done, err := handler.routines.Start(name)
+	if err != nil {
+		admitted.forget()
+		handler.writeError(writer, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	timer := time.NewTimer(routineWait)
+	defer timer.Stop()
+	select {
+	case result := <-done:
+		if !result.OK {
+			admitted.forget()
+		}
+		handler.writeRoutineResult(writer, request, result)
+	case <-timer.C:
+		writer.WriteHeader(http.StatusAccepted)
+	case <-request.Context().Done():
+	}
+}
+
+// writeRoutineResult responds like the toggle endpoints: 204 No Content, or the
+// result when the caller asked for it. A failed routine without ?return=state is a 500.
+func (handler *Handler) writeRoutineResult(writer http.ResponseWriter, request *http.Request, result routine.Result) {
+	if wantsState(request) {
+		handler.writeJSON(writer, http.StatusOK, result)
+		return
+	}
+	if result.OK {
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+	for _, step := range result.Steps {
+		if step.Error != "" {
+			message := fmt.Sprintf("routine %q failed at step %d: %s", result.Routine, step.Index, step.Error)
+			handler.writeErrorCode(writer, http.StatusInternalServerError, "routine_failed", message)
+			return
+		}
+	}
+}
+
+// allowRoutine checks that the request's token may control every light, room and zone the routine touches.
+func allowRoutine(request *http.Request, configured config.Routine) error {
+	for i, step := range configured.Steps {
+		var err error
+		switch {
+		case step.Light != 0:
+			err = allowLight(request, step.Light)
+		case step.Room != "":
+			err = allowRoom(request, step.Room)
+		case step.Zone != "":
+			err = allowRoom(request, step.Zone)
+		}
+		if err != nil {
+			return fmt.Errorf("step %d (%s): %w", i, step.Target(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package huehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"hueshelly/config"
+	"hueshelly/hue"
+)
+
+func TestRunRoutine(t *testing.T) {
+	t.Parallel()
+
+	target := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path == "/fail" {
+			writer.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	t.Cleanup(target.Close)
+
+	handler, err := New(&hue.Service{}, config.Config{
+		Auth: config.Auth{Tokens: []config.APIToken{
+			{Name: "admin", Token: "admin-token"},
+			{Name: "desk", Token: "desk-token", Lights: []int{3}},
+		}},
+		Routines: []config.Routine{
+			{Name: "notify", Steps: []config.RoutineStep{{Action: config.RoutineActionURL, URL: target.URL + "/ok"}}},
+			{Name: "broken", Steps: []config.RoutineStep{{Action: config.RoutineActionURL, URL: target.URL + "/fail"}}},
+			{Name: "kitchen off", Steps: []config.RoutineStep{{Action: config.RoutineActionOff, Room: "Kitchen"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v, want nil", err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+	}{
+		{name: "success", method: http.MethodGet, target: "/routine/notify?token=admin-token", wantStatus: http.StatusNoContent},
+		{name: "result requested", method: http.MethodPost, target: "/routine/broken?token=admin-token&return=state", wantStatus: http.StatusOK},
+		{name: "failed step", method: http.MethodPost, target: "/routine/broken?token=admin-token", wantStatus: http.StatusInternalServerError},
+		{name: "unknown routine", method: http.MethodGet, target: "/routine/missing?token=admin-token", wantStatus: http.StatusNotFound},
+		{name: "escaped name", method: http.MethodGet, target: "/routine/kitchen%20off?token=desk-token", wantStatus: http.StatusForbidden},
+		{name: "wrong method", method: http.MethodPut, target: "/routine/notify?token=admin-token", wantStatus: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			recorder := httptest.NewRecorder()
+			handler.mux.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.target, nil))
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("%s %s status = %d, want %d (body %q)", tt.method, tt.target, recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package huehttp
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"hueshelly/config"
+	"hueshelly/schedule"
+)
+
+// schedules lists the configured schedules the token may control with their
+// upcoming runs and last result.
+func (handler *Handler) schedules(writer http.ResponseWriter, request *http.Request) {
+	statuses := slices.DeleteFunc(handler.scheduler.Statuses(), func(status schedule.Status) bool {
+		return handler.allowSchedule(request, status.Name) != nil
+	})
+	handler.writeJSON(writer, http.StatusOK, statuses)
+}
+
+func (handler *Handler) pauseSchedule(writer http.ResponseWriter, request *http.Request) {
+	name := request.PathValue("name")
+	if err := handler.allowSchedule(request, name); err != nil {
+		handler.writeError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+	status, err := handler.scheduler.Pause(name)
+	handler.writeScheduleStatus(writer, status, err)
+}
+
+func (handler *Handler) resumeSchedule(writer http.ResponseWriter, request *http.Request) {
+	name := request.PathValue("name")
+	if err := handler.allowSchedule(request, name); err != nil {
+		handler.writeError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+	status, err := handler.scheduler.Resume(name)
+	handler.writeScheduleStatus(writer, status, err)
+}
+
+// allowSchedule checks that the request's token may control every target the
+// schedule runs. Unknown schedules are left to the scheduler to report.
+func (handler *Handler) allowSchedule(request *http.Request, name string) error {
+	configured, ok := handler.scheduler.Schedule(name)
+	if !ok {
+		return nil
+	}
+	if configured.Action != nil {
+		return allowRoutine(request, config.Routine{Name: configured.Name, Steps: []config.RoutineStep{*configured.Action}})
+	}
+	routine, ok := handler.routines.Routine(configured.Routine)
+	if !ok {
+		if targetScoped(tokenFromContext(request.Context())) {
+			return errTargetDenied
+		}
+		return nil
+	}
+	return allowRoutine(request, routine)
+}
+
+func (handler *Handler) writeScheduleStatus(writer http.ResponseWriter, status schedule.Status, err error) {
+	if errors.Is(err, schedule.ErrUnknownSchedule) {
+		handler.writeError(writer, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		handler.writeError(writer, http.StatusInternalServerError, err.Error())
+		return
+	}
+	handler.writeJSON(writer, http.StatusOK, status)
+}
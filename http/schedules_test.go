@@ -0,0 +1,83 @@
+package huehttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"hueshelly/config"
+	"hueshelly/hue"
+	"hueshelly/schedule"
+)
+
+func TestScheduleRoutes(t *testing.T) {
+	t.Parallel()
+
+	handler, err := New(&hue.Service{}, config.Config{
+		Auth: config.Auth{Tokens: []config.APIToken{
+			{Name: "admin", Token: "admin-token"},
+			{Name: "guest", Token: "guest-token", Rooms: []string{"Guest room"}},
+		}},
+		Routines: []config.Routine{
+			{Name: "house off", Steps: []config.RoutineStep{
+				{Action: config.RoutineActionOff, Room: "Guest room"},
+				{Action: config.RoutineActionOff, Room: "Living room"},
+			}},
+		},
+		Schedules: []config.Schedule{
+			{Name: "night", Cron: "0 23 * * *", Routine: "house off"},
+			{Name: "guest wake-up", Cron: "0 7 * * *", Action: &config.RoutineStep{Action: config.RoutineActionOn, Room: "Guest room"}},
+			{Name: "porch", Cron: "0 20 * * *", Action: &config.RoutineStep{Action: config.RoutineActionOn, Light: 7}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v, want nil", err)
+	}
+	t.Cleanup(func() { handler.scheduler.Close(t.Context()) })
+
+	recorder := httptest.NewRecorder()
+	handler.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/schedules?token=guest-token", nil))
+	var listed []schedule.Status
+	if err := json.Unmarshal(recorder.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("decode schedules: %v", err)
+	}
+	if len(listed) != 1 || listed[0].Name != "guest wake-up" {
+		t.Fatalf("schedules for the guest token = %+v, want only guest wake-up", listed)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		wantStatus int
+		wantPaused bool
+	}{
+		{name: "list", method: http.MethodGet, target: "/schedules?token=guest-token", wantStatus: http.StatusOK},
+		{name: "pause own room", method: http.MethodPost, target: "/schedules/guest%20wake-up/pause?token=guest-token", wantStatus: http.StatusOK, wantPaused: true},
+		{name: "pause routine with other rooms", method: http.MethodPost, target: "/schedules/night/pause?token=guest-token", wantStatus: http.StatusForbidden},
+		{name: "resume other light", method: http.MethodPost, target: "/schedules/porch/resume?token=guest-token", wantStatus: http.StatusForbidden},
+		{name: "unscoped token", method: http.MethodPost, target: "/schedules/night/resume?token=admin-token", wantStatus: http.StatusOK},
+		{name: "unknown schedule", method: http.MethodPost, target: "/schedules/garden/pause?token=admin-token", wantStatus: http.StatusNotFound},
+	}
+	// The rows share the scheduler, so they run in order.
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.mux.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.target, nil))
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("%s %s status = %d, want %d (body %q)", tt.method, tt.target, recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+			if tt.method != http.MethodPost || recorder.Code != http.StatusOK {
+				return
+			}
+			var status schedule.Status
+			if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+				t.Fatalf("decode status: %v", err)
+			}
+			if status.Paused != tt.wantPaused {
+				t.Fatalf("status = %+v, want paused %v", status, tt.wantPaused)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package huehttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"hueshelly/config"
+	"hueshelly/hue"
+)
+
+func TestShutdownStopsRunningServer(t *testing.T) {
+	t.Parallel()
+
+	handler, err := New(&hue.Service{}, config.Config{})
+	if err != nil {
+		t.Fatalf("New() error = %v, want nil", err)
+	}
+
+	started := make(chan error, 1)
+	go func() {
+		started <- handler.Start("127.0.0.1:0")
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		handler.serverMu.Lock()
+		running := len(handler.servers) > 0
+		handler.serverMu.Unlock()
+		if running || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := handler.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v, want nil", err)
+	}
+	if err := <-started; !errors.Is(err, http.ErrServerClosed) {
+		t.Fatalf("Start() error = %v, want %v", err, http.ErrServerClosed)
+	}
+}
+
+func TestStartAfterShutdown(t *testing.T) {
+	t.Parallel()
+
+	handler, err := New(&hue.Service{}, config.Config{})
+	if err != nil {
+		t.Fatalf("New() error = %v, want nil", err)
+	}
+	if err := handler.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v, want nil", err)
+	}
+	if err := handler.Start("127.0.0.1:0"); !errors.Is(err, http.ErrServerClosed) {
+		t.Fatalf("Start() error = %v, want %v", err, http.ErrServerClosed)
+	}
+}
+
+func TestStartTLSWithSelfSignedCertificate(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	cfg := config.Config{TLS: config.TLS{
+		Port:       8443,
+		SelfSigned: true,
+		CertFile:   filepath.Join(dir, "cert.pem"),
+		KeyFile:    filepath.Join(dir, "key.pem"),
+	}}
+	handler, err := New(&hue.Service{}, cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v, want nil", err)
+	}
+
+	started := make(chan error, 1)
+	go func() {
+		started <- handler.StartTLS("127.0.0.1:0")
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		handler.serverMu.Lock()
+		running := len(handler.servers) > 0
+		handler.serverMu.Unlock()
+		if running || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := handler.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v, want nil", err)
+	}
+	if err := <-started; !errors.Is(err, http.ErrServerClosed) {
+		t.Fatalf("StartTLS() error = %v, want %v", err, http.ErrServerClosed)
+	}
+	if _, err := loadCertificate(cfg.TLS); err != nil {
+		t.Fatalf("loadCertificate() error = %v, want generated certificate to be reusable", err)
+	}
+}
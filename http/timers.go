@@ -0,0 +1,41 @@
+package huehttp
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"hueshelly/hue"
+)
+
+// parseFor returns the auto-off duration of a toggle from ?for=, or 0 when it is absent.
+func parseFor(request *http.Request) (time.Duration, error) {
+	raw := request.URL.Query().Get("for")
+	if raw == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(raw)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("for must be a positive duration like 10m, got %q", raw)
+	}
+	return duration, nil
+}
+
+// timers lists the pending auto-off timers of the targets the token may control.
+func (handler *Handler) timers(writer http.ResponseWriter, request *http.Request) {
+	members, err := handler.scopedRoomLights(request)
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	timers := slices.DeleteFunc(handler.hueService.Timers(), func(timer hue.Timer) bool {
+		if timer.TargetType == "room" {
+			return allowRoom(request, timer.Target) != nil
+		}
+		lightID, err := strconv.Atoi(timer.Target)
+		return err != nil || !members[lightID] && allowLight(request, lightID) != nil
+	})
+	handler.writeJSON(writer, http.StatusOK, timers)
+}
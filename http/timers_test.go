@@ -0,0 +1,51 @@
+package huehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTimerRoutes(t *testing.T) {
+	t.Parallel()
+
+	runRouteTests(t, nil, []routeTest{
+		{name: "light for 10m", method: http.MethodGet, target: "/toggle/light/3?for=10m&return=state&token=admin-token", wantStatus: http.StatusOK, wantBody: `"targetType":"light","target":"3","on":true`, wantUpdate: `light/light-3 {"dimming":{"brightness":100},"on":{"on":true}}`},
+		{name: "room for 5m", method: http.MethodPost, target: "/toggle/lights/group/Office?for=5m&return=state&token=admin-token", wantStatus: http.StatusOK, wantBody: `"targetType":"room","target":"Office","on":true`, wantUpdate: `grouped_light/grouped-1 {"dimming":{"brightness":100},"on":{"on":true}}`},
+		{name: "invalid duration", method: http.MethodGet, target: "/toggle/light/3?for=soon&token=admin-token", wantStatus: http.StatusBadRequest, wantBody: `for must be a positive duration`},
+		{name: "negative duration", method: http.MethodPost, target: "/toggle/lights/group/Office?for=-5m&token=admin-token", wantStatus: http.StatusBadRequest, wantBody: `for must be a positive duration`},
+		{name: "longer than a day", method: http.MethodPost, target: "/toggle/light/3?for=25h&token=admin-token", wantStatus: http.StatusBadRequest, wantBody: `timer duration must be between`},
+		{name: "no timers", method: http.MethodGet, target: "/timers?token=admin-token", wantStatus: http.StatusOK, wantBody: `[]`},
+	})
+}
+
+func TestTimersListed(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-3", 3, "Desk", false)
+	fake.addRoom("room-1", "Office", "grouped-1", false, "light-3")
+	fake.addLight("light-4", 4, "Hall lamp", false)
+	fake.addRoom("room-2", "Hall", "grouped-2", false, "light-4")
+	handler := newAPITestHandler(t, fake)
+
+	for _, target := range []string{"/toggle/light/3?for=10m&token=admin-token", "/toggle/lights/group/Hall?for=10m&token=admin-token"} {
+		recorder := httptest.NewRecorder()
+		handler.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, target, nil))
+		if recorder.Code != http.StatusNoContent {
+			t.Fatalf("toggle status = %d, want %d (body %q)", recorder.Code, http.StatusNoContent, recorder.Body.String())
+		}
+	}
+
+	for _, token := range []string{"admin-token", "office-token", "desk-token"} {
+		recorder := httptest.NewRecorder()
+		handler.mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/timers?token="+token, nil))
+		if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"targetType":"light","target":"3","offAt"`) {
+			t.Fatalf("timers for %s = %d %q, want the timer of light 3", token, recorder.Code, recorder.Body.String())
+		}
+		if hall := strings.Contains(recorder.Body.String(), `"target":"Hall"`); hall != (token == "admin-token") {
+			t.Fatalf("timers for %s = %q, want the Hall timer only for the unscoped token", token, recorder.Body.String())
+		}
+	}
+}
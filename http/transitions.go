@@ -0,0 +1,91 @@
+package huehttp
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// parseTransition returns the transition of an action from ?transition=, or nil when it is absent.
+func parseTransition(request *http.Request) (*time.Duration, error) {
+	raw := request.URL.Query().Get("transition")
+	if raw == "" {
+		return nil, nil
+	}
+	transition, err := time.ParseDuration(raw)
+	if err != nil || transition < 0 {
+		return nil, fmt.Errorf("transition must be a duration like 2s, got %q", raw)
+	}
+	return &transition, nil
+}
+
+// parseOver returns the fade-off duration from ?over=, or 0 for the configured default.
+func parseOver(request *http.Request) (time.Duration, error) {
+	raw := request.URL.Query().Get("over")
+	if raw == "" {
+		return 0, nil
+	}
+	over, err := time.ParseDuration(raw)
+	if err != nil || over <= 0 {
+		return 0, fmt.Errorf("over must be a positive duration like 60s, got %q", raw)
+	}
+	return over, nil
+}
+
+// fadeOffLight switches a light off slowly, e.g. from a bedtime button.
+func (handler *Handler) fadeOffLight(writer http.ResponseWriter, request *http.Request) {
+	if !isToggleMethod(request.Method) {
+		handler.writeError(writer, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	lightID, err := lightIDFromPath(request)
+	if err != nil {
+		handler.writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	over, err := parseOver(request)
+	if err != nil {
+		handler.writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := allowLight(request, lightID); err != nil {
+		handler.writeError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+
+	started := time.Now()
+	state, err := handler.hueService.FadeOffLight(request.Context(), lightID, over)
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	handler.writeActionResult(writer, request, state, started)
+}
+
+// fadeOffRoom switches the lights of a room off slowly.
+func (handler *Handler) fadeOffRoom(writer http.ResponseWriter, request *http.Request) {
+	if !isToggleMethod(request.Method) {
+		handler.writeError(writer, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	room := request.PathValue("name")
+	over, err := parseOver(request)
+	if err != nil {
+		handler.writeError(writer, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := allowRoom(request, room); err != nil {
+		handler.writeError(writer, http.StatusForbidden, err.Error())
+		return
+	}
+
+	started := time.Now()
+	state, err := handler.hueService.FadeOffRoom(request.Context(), room, over)
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+	handler.writeActionResult(writer, request, state, started)
+}
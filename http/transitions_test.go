@@ -0,0 +1,23 @@
+package huehttp
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestTransitionRoutes(t *testing.T) {
+	t.Parallel()
+
+	switchOn := func(fake *fakeBridge) {
+		fake.set("light", "light-3", "on", map[string]any{"on": true})
+		fake.set("grouped_light", "grouped-1", "on", map[string]any{"on": true})
+	}
+	runRouteTests(t, switchOn, []routeTest{
+		{name: "toggle with transition", method: http.MethodGet, target: "/toggle/light/3?transition=2s&return=state&token=admin-token", wantStatus: http.StatusOK, wantBody: `"on":false`, wantUpdate: `light/light-3 {"dynamics":{"duration":2000},"on":{"on":false}}`},
+		{name: "fade off light", method: http.MethodPost, target: "/fade-off/light/3?return=state&token=desk-token", wantStatus: http.StatusOK, wantBody: `"targetType":"light","target":"3","on":false`, wantUpdate: `light/light-3 {"dynamics":{"duration":60000},"on":{"on":false}}`},
+		{name: "fade off room", method: http.MethodGet, target: "/fade-off/room/Office?over=30s&token=admin-token", wantStatus: http.StatusNoContent, wantUpdate: `grouped_light/grouped-1 {"dynamics":{"duration":30000},"on":{"on":false}}`},
+		{name: "invalid transition", method: http.MethodGet, target: "/toggle/light/3?transition=slow&token=admin-token", wantStatus: http.StatusBadRequest, wantBody: `transition must be a duration`},
+		{name: "invalid fade-off duration", method: http.MethodGet, target: "/fade-off/room/Office?over=0s&token=admin-token", wantStatus: http.StatusBadRequest, wantBody: `over must be a positive duration`},
+		{name: "fade off light outside scope", method: http.MethodPost, target: "/fade-off/light/4?token=desk-token", wantStatus: http.StatusForbidden},
+	})
+}
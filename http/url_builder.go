@@ -0,0 +1,89 @@
+package huehttp
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+
+	"hueshelly/logging"
+)
+
+//go:embed url_builder.html
+var urlBuilderSource string
+
+var urlBuilderTemplate = template.Must(template.New("url-builder").Parse(urlBuilderSource))
+
+type urlBuilderData struct {
+	// BaseURL is the address the page was requested on, e.g. http://192.168.1.10:8080.
+	BaseURL        string
+	TokensRequired bool
+	MaxRoomName    int
+	Rooms          []builderRoom
+	Lights         []lightResponse
+	Routines       []builderRoutine
+}
+
+// builderRoom is a room with its name escaped for URL paths.
+type builderRoom struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// TooLong marks names the toggle route rejects, see parseRoomName.
+	TooLong bool `json:"tooLong"`
+}
+
+type builderRoutine struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// urlBuilder serves a page that turns a target and action into the absolute
+// URL and the Shelly Gen1 and Gen2 settings for it.
+func (handler *Handler) urlBuilder(writer http.ResponseWriter, request *http.Request) {
+	groups, err := handler.hueService.AvailableGroups(request.Context())
+	if err != nil {
+		handler.writeServiceError(writer, err)
+		return
+	}
+
+	scheme := "http"
+	if request.TLS != nil {
+		scheme = "https"
+	}
+	pageData := urlBuilderData{
+		BaseURL:        scheme + "://" + request.Host,
+		TokensRequired: handler.auth.tokensRequired(),
+		MaxRoomName:    maxRoomNameLength,
+		Rooms:          builderRooms(collectRooms(groups)),
+		Lights:         collectLights(groups),
+	}
+	for _, routine := range handler.routines.Routines() {
+		pageData.Routines = append(pageData.Routines, builderRoutine{Name: routine.Name, Path: url.PathEscape(routine.Name)})
+	}
+
+	var page bytes.Buffer
+	if err := urlBuilderTemplate.Execute(&page, pageData); err != nil {
+		handler.writeError(writer, http.StatusInternalServerError, "failed to render URL builder")
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.WriteHeader(http.StatusOK)
+	if _, err := writer.Write(page.Bytes()); err != nil {
+		logging.Logger.Println(fmt.Errorf("write URL builder: %w", err))
+	}
+}
+
+func builderRooms(rooms []roomResponse) []builderRoom {
+	result := make([]builderRoom, 0, len(rooms))
+	for _, room := range rooms {
+		result = append(result, builderRoom{
+			Name:    room.Name,
+			Path:    url.PathEscape(room.Name),
+			TooLong: len(room.Name) > maxRoomNameLength,
+		})
+	}
+	return result
+}
@@ -0,0 +1,361 @@
+package hue
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"time"
+
+	"hueshelly/metrics"
+
+	"github.com/openhue/openhue-go"
+)
+
+// bridge is the subset of the Hue CLIP v2 API used by the service.
+type bridge interface {
+	GetBridgeHome(ctx context.Context) error
+	GetRooms(ctx context.Context) (map[string]openhue.RoomGet, error)
+	GetZones(ctx context.Context) (map[string]openhue.RoomGet, error)
+	GetLights(ctx context.Context) (map[string]openhue.LightGet, error)
+	GetDevice(ctx context.Context, deviceID string) (*openhue.DeviceGet, error)
+	GetGroupedLight(ctx context.Context, groupedLightID string) (*openhue.GroupedLightGet, error)
+	GetGroupedLights(ctx context.Context) (map[string]openhue.GroupedLightGet, error)
+	GetScenes(ctx context.Context) (map[string]openhue.SceneGet, error)
+	UpdateLight(ctx context.Context, lightID string, body openhue.LightPut) error
+	UpdateGroupedLight(ctx context.Context, groupedLightID string, body openhue.GroupedLightPut) error
+	UpdateScene(ctx context.Context, sceneID string, body openhue.ScenePut) error
+}
+
+// clipBridge talks to the bridge through the generated openhue client. Unlike
+// openhue.Home it passes the caller's context to every request.
+type clipBridge struct {
+	api openhue.ClientWithResponsesInterface
+}
+
+func newClipBridge(bridgeIP, apiKey string) (*clipBridge, error) {
+	if bridgeIP == "" || apiKey == "" {
+		return nil, errors.New("bridge IP and API key must be set")
+	}
+
+	// The bridge serves a self-signed certificate.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+
+	api, err := openhue.NewClientWithResponses(
+		"https://"+bridgeIP,
+		openhue.WithHTTPClient(&http.Client{Transport: transport}),
+		openhue.WithRequestEditorFn(func(ctx context.Context, request *http.Request) error {
+			request.Header.Set("hue-application-key", apiKey)
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &clipBridge{api: api}, nil
+}
+
+func (client *clipBridge) GetBridgeHome(ctx context.Context) error {
+	response, err := client.api.GetBridgeHomesWithResponse(ctx)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return &openhue.ApiError{StatusCode: response.StatusCode()}
+	}
+	return nil
+}
+
+func (client *clipBridge) GetRooms(ctx context.Context) (map[string]openhue.RoomGet, error) {
+	response, err := client.api.GetRoomsWithResponse(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK || response.JSON200 == nil || response.JSON200.Data == nil {
+		return nil, &openhue.ApiError{StatusCode: response.StatusCode()}
+	}
+
+	rooms := make(map[string]openhue.RoomGet, len(*response.JSON200.Data))
+	for _, room := range *response.JSON200.Data {
+		if room.Id != nil {
+			rooms[*room.Id] = room
+		}
+	}
+	return rooms, nil
+}
+
+func (client *clipBridge) GetZones(ctx context.Context) (map[string]openhue.RoomGet, error) {
+	response, err := client.api.GetZonesWithResponse(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK || response.JSON200 == nil || response.JSON200.Data == nil {
+		return nil, &openhue.ApiError{StatusCode: response.StatusCode()}
+	}
+
+	zones := make(map[string]openhue.RoomGet, len(*response.JSON200.Data))
+	for _, zone := range *response.JSON200.Data {
+		if zone.Id != nil {
+			zones[*zone.Id] = zone
+		}
+	}
+	return zones, nil
+}
+
+func (client *clipBridge) GetLights(ctx context.Context) (map[string]openhue.LightGet, error) {
+	response, err := client.api.GetLightsWithResponse(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK || response.JSON200 == nil || response.JSON200.Data == nil {
+		return nil, &openhue.ApiError{StatusCode: response.StatusCode()}
+	}
+
+	lights := make(map[string]openhue.LightGet, len(*response.JSON200.Data))
+	for _, light := range *response.JSON200.Data {
+		if light.Id != nil {
+			lights[*light.Id] = light
+		}
+	}
+	return lights, nil
+}
+
+func (client *clipBridge) GetDevice(ctx context.Context, deviceID string) (*openhue.DeviceGet, error) {
+	response, err := client.api.GetDeviceWithResponse(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK || response.JSON200 == nil || response.JSON200.Data == nil {
+		return nil, &openhue.ApiError{StatusCode: response.StatusCode()}
+	}
+	if len(*response.JSON200.Data) == 0 {
+		return nil, errorf(ErrNotFound, "device %q not returned by bridge", deviceID)
+	}
+	return &(*response.JSON200.Data)[0], nil
+}
+
+func (client *clipBridge) GetGroupedLight(ctx context.Context, groupedLightID string) (*openhue.GroupedLightGet, error) {
+	response, err := client.api.GetGroupedLightWithResponse(ctx, groupedLightID)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK || response.JSON200 == nil || response.JSON200.Data == nil {
+		return nil, &openhue.ApiError{StatusCode: response.StatusCode()}
+	}
+	if len(*response.JSON200.Data) == 0 {
+		return nil, errorf(ErrNotFound, "grouped light %q not returned by bridge", groupedLightID)
+	}
+	return &(*response.JSON200.Data)[0], nil
+}
+
+func (client *clipBridge) GetGroupedLights(ctx context.Context) (map[string]openhue.GroupedLightGet, error) {
+	response, err := client.api.GetGroupedLightsWithResponse(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK || response.JSON200 == nil || response.JSON200.Data == nil {
+		return nil, &openhue.ApiError{StatusCode: response.StatusCode()}
+	}
+
+	groupedLights := make(map[string]openhue.GroupedLightGet, len(*response.JSON200.Data))
+	for _, groupedLight := range *response.JSON200.Data {
+		if groupedLight.Id != nil {
+			groupedLights[*groupedLight.Id] = groupedLight
+		}
+	}
+	return groupedLights, nil
+}
+
+func (client *clipBridge) GetScenes(ctx context.Context) (map[string]openhue.SceneGet, error) {
+	response, err := client.api.GetScenesWithResponse(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode() != http.StatusOK || response.JSON200 == nil || response.JSON200.Data == nil {
+		return nil, &openhue.ApiError{StatusCode: response.StatusCode()}
+	}
+
+	scenes := make(map[string]openhue.SceneGet, len(*response.JSON200.Data))
+	for _, scene := range *response.JSON200.Data {
+		if scene.Id != nil {
+			scenes[*scene.Id] = scene
+		}
+	}
+	return scenes, nil
+}
+
+func (client *clipBridge) UpdateLight(ctx context.Context, lightID string, body openhue.LightPut) error {
+	response, err := client.api.UpdateLightWithResponse(ctx, lightID, body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return &openhue.ApiError{StatusCode: response.StatusCode()}
+	}
+	return nil
+}
+
+func (client *clipBridge) UpdateGroupedLight(ctx context.Context, groupedLightID string, body openhue.GroupedLightPut) error {
+	response, err := client.api.UpdateGroupedLightWithResponse(ctx, groupedLightID, body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return &openhue.ApiError{StatusCode: response.StatusCode()}
+	}
+	return nil
+}
+
+func (client *clipBridge) UpdateScene(ctx context.Context, sceneID string, body openhue.ScenePut) error {
+	response, err := client.api.UpdateSceneWithResponse(ctx, sceneID, body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode() != http.StatusOK {
+		return &openhue.ApiError{StatusCode: response.StatusCode()}
+	}
+	return nil
+}
+
+// observeBridgeCall runs a single bridge request bounded by the configured
+// timeout, tracks it for shutdown draining and records its outcome and latency.
+func (service *Service) observeBridgeCall(ctx context.Context, operation string, call func(ctx context.Context) error) error {
+	done, err := service.lifecycle.begin()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	callCtx := ctx
+	if service.bridgeTimeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, service.bridgeTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err = call(callCtx)
+	metrics.BridgeCallDuration.Observe(time.Since(start).Seconds(), operation)
+	metrics.BridgeCalls.Inc(operation, bridgeCallOutcome(err))
+	return err
+}
+
+func bridgeCallOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "error"
+	}
+}
+
+func (service *Service) getRooms(ctx context.Context) (map[string]openhue.RoomGet, error) {
+	var rooms map[string]openhue.RoomGet
+	err := service.callBridge(ctx, "get_rooms", func(ctx context.Context) error {
+		var err error
+		rooms, err = service.bridge.GetRooms(ctx)
+		return err
+	})
+	return rooms, err
+}
+
+func (service *Service) getZones(ctx context.Context) (map[string]openhue.RoomGet, error) {
+	var zones map[string]openhue.RoomGet
+	err := service.callBridge(ctx, "get_zones", func(ctx context.Context) error {
+		var err error
+		zones, err = service.bridge.GetZones(ctx)
+		return err
+	})
+	return zones, err
+}
+
+func (service *Service) getLights(ctx context.Context) (map[string]openhue.LightGet, error) {
+	var lights map[string]openhue.LightGet
+	err := service.callBridge(ctx, "get_lights", func(ctx context.Context) error {
+		var err error
+		lights, err = service.bridge.GetLights(ctx)
+		return err
+	})
+	return lights, err
+}
+
+func (service *Service) getDeviceByID(ctx context.Context, deviceID string) (*openhue.DeviceGet, error) {
+	var device *openhue.DeviceGet
+	err := service.callBridge(ctx, "get_device", func(ctx context.Context) error {
+		var err error
+		device, err = service.bridge.GetDevice(ctx, deviceID)
+		return err
+	})
+	return device, err
+}
+
+func (service *Service) getGroupedLightByID(ctx context.Context, groupedLightID string) (*openhue.GroupedLightGet, error) {
+	var groupedLight *openhue.GroupedLightGet
+	err := service.callBridge(ctx, "get_grouped_light", func(ctx context.Context) error {
+		var err error
+		groupedLight, err = service.bridge.GetGroupedLight(ctx, groupedLightID)
+		return err
+	})
+	return groupedLight, err
+}
+
+func (service *Service) getGroupedLights(ctx context.Context) (map[string]openhue.GroupedLightGet, error) {
+	var groupedLights map[string]openhue.GroupedLightGet
+	err := service.callBridge(ctx, "get_grouped_lights", func(ctx context.Context) error {
+		var err error
+		groupedLights, err = service.bridge.GetGroupedLights(ctx)
+		return err
+	})
+	return groupedLights, err
+}
+
+func (service *Service) getScenes(ctx context.Context) (map[string]openhue.SceneGet, error) {
+	var scenes map[string]openhue.SceneGet
+	err := service.callBridge(ctx, "get_scenes", func(ctx context.Context) error {
+		var err error
+		scenes, err = service.bridge.GetScenes(ctx)
+		return err
+	})
+	return scenes, err
+}
+
+// updateLight sends a light command through the rate limited command queue.
+func (service *Service) updateLight(ctx context.Context, lightID string, body openhue.LightPut) error {
+	return service.sendCommand(ctx, lightCommand, lightID, "update_light", retryTransient, func(ctx context.Context) error {
+		return service.bridge.UpdateLight(ctx, lightID, body)
+	})
+}
+
+// updateGroupedLight sends a group command through the rate limited command queue.
+func (service *Service) updateGroupedLight(ctx context.Context, groupedLightID string, body openhue.GroupedLightPut) error {
+	return service.sendCommand(ctx, groupCommand, groupedLightID, "update_grouped_light", retryTransient, func(ctx context.Context) error {
+		return service.bridge.UpdateGroupedLight(ctx, groupedLightID, body)
+	})
+}
+
+// updateScene recalls a scene through the group lane of the command queue, since
+// a recall addresses all lights of the scene's room or zone.
+func (service *Service) updateScene(ctx context.Context, sceneID string, body openhue.ScenePut) error {
+	return service.sendCommand(ctx, groupCommand, "scene/"+sceneID, "update_scene", retryTransient, func(ctx context.Context) error {
+		return service.bridge.UpdateScene(ctx, sceneID, body)
+	})
+}
+
+// sendCommand queues a state change for target. Without a queue, e.g. in
+// tests, it calls the bridge directly.
+func (service *Service) sendCommand(ctx context.Context, kind commandKind, target, operation string, mode retryMode, call func(ctx context.Context) error) error {
+	if service.commands == nil {
+		if mode == sendOnce {
+			return service.callBridgeOnce(ctx, operation, call)
+		}
+		return service.callBridge(ctx, operation, call)
+	}
+	return service.commands.submit(ctx, kind, target, operation, mode, func(ctx context.Context) error {
+		return service.observeBridgeCall(ctx, operation, call)
+	})
+}
@@ -0,0 +1,51 @@
+package hue
+
+import (
+	"time"
+
+	"hueshelly/config"
+	"hueshelly/sun"
+)
+
+// daylight picks the brightness that toggles switch a room or light on with,
+// by whether the sun is up. A nil daylight configures nothing.
+type daylight struct {
+	levels      config.Daylight
+	coordinates config.Coordinates
+	now         func() time.Time
+}
+
+func newDaylight(cfg config.Config) *daylight {
+	if cfg.Coordinates == nil || (len(cfg.Daylight.Rooms) == 0 && len(cfg.Daylight.Lights) == 0) {
+		return nil
+	}
+	return &daylight{levels: cfg.Daylight, coordinates: *cfg.Coordinates, now: time.Now}
+}
+
+// level returns the brightness configured for a target at the current time of day.
+func (daylight *daylight) level(targetType, target string) (float64, bool) {
+	if daylight == nil {
+		return 0, false
+	}
+
+	var levels config.DaylightLevels
+	var exists bool
+	switch targetType {
+	case "light":
+		levels, exists = daylight.levels.Lights[target]
+	case "room":
+		levels, exists = daylight.levels.Rooms[target]
+	}
+	if !exists {
+		return 0, false
+	}
+
+	level := levels.Night
+	if sun.IsUp(daylight.now(), daylight.coordinates.Latitude, daylight.coordinates.Longitude) {
+		level = levels.Day
+	}
+	if level == nil {
+		return 0, false
+	}
+	return *level, true
+}
@@ -0,0 +1,68 @@
+package hue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"hueshelly/config"
+)
+
+func TestToggleUsesDaylightLevels(t *testing.T) {
+	t.Parallel()
+
+	night := time.Date(2026, 6, 21, 23, 0, 0, 0, time.UTC)
+	day := time.Date(2026, 6, 21, 12, 0, 0, 0, time.UTC)
+	twenty, full := 20.0, 100.0
+	tests := []struct {
+		name           string
+		now            time.Time
+		restore        bool
+		wantBrightness *float64
+	}{
+		{name: "night level", now: night, wantBrightness: &twenty},
+		{name: "night level wins over restore", now: night, restore: true, wantBrightness: &twenty},
+		{name: "no day level falls back to full brightness", now: day, wantBrightness: &full},
+		{name: "no day level restores", now: day, restore: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake := newFakeBridge()
+			fake.addLight("light-1", 3, "Hallway spot", false)
+			fake.addRoom("room-1", "Hallway", "grouped-1", false)
+			service := newTestService(fake)
+			service.restorePreviousLightState = tt.restore
+			service.daylight = &daylight{
+				levels: config.Daylight{
+					Rooms:  map[string]config.DaylightLevels{"Hallway": {Night: &twenty}},
+					Lights: map[string]config.DaylightLevels{"3": {Night: &twenty}},
+				},
+				coordinates: config.Coordinates{Latitude: 52.52, Longitude: 13.405},
+				now:         func() time.Time { return tt.now },
+			}
+
+			light, err := service.ToggleLight(context.Background(), 3)
+			if err != nil {
+				t.Fatalf("ToggleLight() error = %v, want nil", err)
+			}
+			room, err := service.ToggleLightsInRoom(context.Background(), "Hallway")
+			if err != nil {
+				t.Fatalf("ToggleLightsInRoom() error = %v, want nil", err)
+			}
+			for _, state := range []State{light, room} {
+				if !equalBrightness(state.Brightness, tt.wantBrightness) {
+					t.Fatalf("%s brightness = %v, want %v", state.TargetType, state.Brightness, tt.wantBrightness)
+				}
+			}
+		})
+	}
+}
+
+func equalBrightness(got, want *float64) bool {
+	if got == nil || want == nil {
+		return got == want
+	}
+	return *got == *want
+}
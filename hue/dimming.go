@@ -0,0 +1,308 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hueshelly/config"
+	"hueshelly/logging"
+
+	"github.com/openhue/openhue-go"
+)
+
+// Directions of a dim-while-held ramp. DimAuto goes up from off or low
+// brightness and otherwise reverses the target's previous ramp, like a Hue dimmer switch.
+const (
+	DimAuto = ""
+	DimUp   = "up"
+	DimDown = "down"
+)
+
+// dimmer tracks the brightness ramps started by long presses. The bridge runs
+// a ramp on its own, so a press and its release cost one command each; a
+// safety timer stops ramps whose release never arrived.
+type dimmer struct {
+	ramp        time.Duration
+	maxDuration time.Duration
+
+	mu    sync.Mutex
+	ramps map[string]*dimRamp
+	last  map[string]string
+}
+
+type dimRamp struct {
+	stop   func(ctx context.Context) error
+	safety *time.Timer
+	// started is closed once the start command returned; failed is set before.
+	started chan struct{}
+	failed  bool
+}
+
+// rampSender sends a ramp in direction, or stops the running ramp for
+// openhue.DimmingDeltaActionStop. Ramps are relative, so they are sent once.
+type rampSender func(ctx context.Context, action openhue.DimmingDeltaAction, switchOn bool) error
+
+func newDimmer(cfg config.Dimming) *dimmer {
+	return &dimmer{
+		ramp:        cfg.RampDuration.Duration(),
+		maxDuration: cfg.MaxDuration.Duration(),
+		ramps:       map[string]*dimRamp{},
+		last:        map[string]string{},
+	}
+}
+
+// StartDimmingLight starts ramping the brightness of a light until StopDimmingLight,
+// the end of the range or the configured maximum duration.
+func (service *Service) StartDimmingLight(ctx context.Context, lightID int, direction string) (State, error) {
+	if err := service.ensureInitialized(); err != nil {
+		return State{}, err
+	}
+	if err := validateDirection(direction); err != nil {
+		return State{}, err
+	}
+
+	light, err := service.findLightByID(ctx, lightID)
+	if err != nil {
+		return State{}, err
+	}
+	if light.Id == nil {
+		return State{}, errors.New("light has no id")
+	}
+	var brightness *float64
+	if light.Dimming != nil {
+		brightness = brightnessValue(light.Dimming.Brightness)
+	}
+
+	send := func(ctx context.Context, action openhue.DimmingDeltaAction, switchOn bool) error {
+		body := openhue.LightPut{DimmingDelta: dimmingDelta(action)}
+		if action != openhue.DimmingDeltaActionStop {
+			duration := int(service.dimmer.ramp.Milliseconds())
+			body.Dynamics = &openhue.LightDynamics{Duration: &duration}
+		}
+		if switchOn {
+			body.On = &openhue.On{On: &switchOn}
+		}
+		return service.sendCommand(ctx, lightCommand, *light.Id, "update_light", sendOnce, func(ctx context.Context) error {
+			return service.bridge.UpdateLight(ctx, *light.Id, body)
+		})
+	}
+	return service.startRamp(ctx, "light", strconv.Itoa(lightID), light.IsOn(), brightness, direction, send)
+}
+
+// StartDimmingRoom starts ramping the brightness of a room until StopDimmingRoom,
+// the end of the range or the configured maximum duration.
+func (service *Service) StartDimmingRoom(ctx context.Context, roomName, direction string) (State, error) {
+	if err := service.ensureInitialized(); err != nil {
+		return State{}, err
+	}
+	if strings.TrimSpace(roomName) == "" {
+		return State{}, errorf(ErrInvalidParameter, "room name must not be empty")
+	}
+	if err := validateDirection(direction); err != nil {
+		return State{}, err
+	}
+
+	room, err := service.findRoomByName(ctx, roomName)
+	if err != nil {
+		return State{}, err
+	}
+	groupedLightID, ok := groupedLightIDFromRoom(*room)
+	if !ok {
+		return State{}, errors.New("group has no grouped_light service")
+	}
+	groupedLight, err := service.getGroupedLightByID(ctx, groupedLightID)
+	if err != nil {
+		return State{}, err
+	}
+	var brightness *float64
+	if groupedLight.Dimming != nil {
+		brightness = brightnessValue(groupedLight.Dimming.Brightness)
+	}
+
+	send := func(ctx context.Context, action openhue.DimmingDeltaAction, switchOn bool) error {
+		body := openhue.GroupedLightPut{DimmingDelta: dimmingDelta(action)}
+		if action != openhue.DimmingDeltaActionStop {
+			duration := int(service.dimmer.ramp.Milliseconds())
+			body.Dynamics = &openhue.Dynamics{Duration: &duration}
+		}
+		if switchOn {
+			body.On = &openhue.On{On: &switchOn}
+		}
+		return service.sendCommand(ctx, groupCommand, groupedLightID, "update_grouped_light", sendOnce, func(ctx context.Context) error {
+			return service.bridge.UpdateGroupedLight(ctx, groupedLightID, body)
+		})
+	}
+	return service.startRamp(ctx, "room", roomName, groupedLight.IsOn(), brightness, direction, send)
+}
+
+// StopDimmingLight stops the ramp of a light. It does nothing when no ramp is running.
+func (service *Service) StopDimmingLight(ctx context.Context, lightID int) error {
+	return service.stopRamp(ctx, "light", strconv.Itoa(lightID))
+}
+
+// StopDimmingRoom stops the ramp of a room. It does nothing when no ramp is running.
+func (service *Service) StopDimmingRoom(ctx context.Context, roomName string) error {
+	return service.stopRamp(ctx, "room", roomName)
+}
+
+func validateDirection(direction string) error {
+	switch direction {
+	case DimAuto, DimUp, DimDown:
+		return nil
+	}
+	return errorf(ErrInvalidParameter, "direction must be up or down, got %q", direction)
+}
+
+func dimmingDelta(action openhue.DimmingDeltaAction) *openhue.DimmingDelta {
+	if action == openhue.DimmingDeltaActionStop {
+		return &openhue.DimmingDelta{Action: &action}
+	}
+	fullRange := float32(100)
+	return &openhue.DimmingDelta{Action: &action, BrightnessDelta: &fullRange}
+}
+
+func (service *Service) startRamp(ctx context.Context, targetType, target string, on bool, brightness *float64, direction string, send rampSender) (State, error) {
+	state := State{TargetType: targetType, Target: target, On: on, Brightness: brightness}
+	key := targetType + "/" + target
+	direction = service.dimmer.direction(key, direction, on, brightness)
+	if !on && direction == DimDown {
+		return state, nil
+	}
+
+	action := openhue.DimmingDeltaActionUp
+	if direction == DimDown {
+		action = openhue.DimmingDeltaActionDown
+	}
+	// The ramp is registered before it is sent, so a release that arrives while
+	// the start is still on its way finds it and stops it.
+	ramp := service.dimmer.begin(service, key, func(ctx context.Context) error {
+		return send(ctx, openhue.DimmingDeltaActionStop, false)
+	})
+	err := send(ctx, action, !on)
+	service.dimmer.started(key, ramp, err)
+	if err != nil {
+		return State{}, err
+	}
+	state.On = true
+	if !on {
+		state.Brightness = nil
+	}
+	return state, nil
+}
+
+func (service *Service) stopRamp(ctx context.Context, targetType, target string) error {
+	if err := service.ensureInitialized(); err != nil {
+		return err
+	}
+	ramp := service.dimmer.end(targetType + "/" + target)
+	if ramp == nil {
+		return nil
+	}
+	return ramp.halt(ctx)
+}
+
+// halt stops the ramp once its start command returned, so the stop cannot
+// overtake the start. A ramp that failed to start needs no stop.
+func (ramp *dimRamp) halt(ctx context.Context) error {
+	<-ramp.started
+	if ramp.failed {
+		return nil
+	}
+	return ramp.stop(ctx)
+}
+
+// direction resolves DimAuto for a target and remembers the result.
+func (dimmer *dimmer) direction(key, direction string, on bool, brightness *float64) string {
+	dimmer.mu.Lock()
+	defer dimmer.mu.Unlock()
+
+	if direction == DimAuto {
+		switch {
+		case !on:
+			direction = DimUp
+		case dimmer.last[key] == DimUp:
+			direction = DimDown
+		case dimmer.last[key] == DimDown:
+			direction = DimUp
+		case brightness != nil && *brightness >= 50:
+			direction = DimDown
+		default:
+			direction = DimUp
+		}
+	}
+	dimmer.last[key] = direction
+	return direction
+}
+
+// begin registers a ramp that is about to start and arms its safety stop,
+// replacing an earlier ramp of the target.
+func (dimmer *dimmer) begin(service *Service, key string, stop func(ctx context.Context) error) *dimRamp {
+	ramp := &dimRamp{stop: stop, started: make(chan struct{})}
+
+	dimmer.mu.Lock()
+	defer dimmer.mu.Unlock()
+	if existing, exists := dimmer.ramps[key]; exists {
+		existing.safety.Stop()
+	}
+	ramp.safety = time.AfterFunc(dimmer.maxDuration, func() {
+		dimmer.mu.Lock()
+		current := dimmer.ramps[key] == ramp
+		if current {
+			delete(dimmer.ramps, key)
+		}
+		dimmer.mu.Unlock()
+		if !current {
+			return
+		}
+		if err := ramp.halt(service.lifecycle.background); err != nil {
+			logging.Logger.Println(fmt.Errorf("stop dimming %s after %s: %w", key, dimmer.maxDuration, err))
+		}
+	})
+	dimmer.ramps[key] = ramp
+	return ramp
+}
+
+// started records the result of the start command of ramp. A ramp that failed
+// to start is dropped unless it was already replaced or released.
+func (dimmer *dimmer) started(key string, ramp *dimRamp, err error) {
+	if err != nil {
+		ramp.failed = true
+		dimmer.mu.Lock()
+		if dimmer.ramps[key] == ramp {
+			ramp.safety.Stop()
+			delete(dimmer.ramps, key)
+		}
+		dimmer.mu.Unlock()
+	}
+	close(ramp.started)
+}
+
+// end removes the running ramp of a target and returns it, or nil when none is running.
+func (dimmer *dimmer) end(key string) *dimRamp {
+	dimmer.mu.Lock()
+	defer dimmer.mu.Unlock()
+	ramp, exists := dimmer.ramps[key]
+	if !exists {
+		return nil
+	}
+	ramp.safety.Stop()
+	delete(dimmer.ramps, key)
+	return ramp
+}
+
+// stop disarms all safety stops.
+func (dimmer *dimmer) stop() {
+	if dimmer == nil {
+		return
+	}
+	dimmer.mu.Lock()
+	defer dimmer.mu.Unlock()
+	for _, ramp := range dimmer.ramps {
+		ramp.safety.Stop()
+	}
+}
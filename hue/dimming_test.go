@@ -0,0 +1,163 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"hueshelly/config"
+
+	"github.com/openhue/openhue-go"
+)
+
+func TestDimWhileHeld(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-1", 3, "Bedside", false)
+	service := newTestService(fake)
+	service.dimmer = newDimmer(config.Dimming{RampDuration: config.Duration(5 * time.Second), MaxDuration: config.Duration(time.Minute)})
+	ctx := context.Background()
+
+	state, err := service.StartDimmingLight(ctx, 3, DimAuto)
+	if err != nil {
+		t.Fatalf("StartDimmingLight() error = %v, want nil", err)
+	}
+	if !state.On {
+		t.Fatalf("StartDimmingLight() = %+v, want light switched on", state)
+	}
+	if err := service.StopDimmingLight(ctx, 3); err != nil {
+		t.Fatalf("StopDimmingLight() error = %v, want nil", err)
+	}
+	// A release without a running ramp sends nothing.
+	if err := service.StopDimmingLight(ctx, 3); err != nil {
+		t.Fatalf("StopDimmingLight() error = %v, want nil", err)
+	}
+
+	if _, err := service.StartDimmingLight(ctx, 3, DimAuto); err != nil {
+		t.Fatalf("StartDimmingLight() error = %v, want nil", err)
+	}
+
+	tests := []struct {
+		name       string
+		action     openhue.DimmingDeltaAction
+		wantOn     bool
+		wantRampMs int
+	}{
+		{name: "ramp up from off", action: openhue.DimmingDeltaActionUp, wantOn: true, wantRampMs: 5000},
+		{name: "release", action: openhue.DimmingDeltaActionStop},
+		{name: "next press reverses", action: openhue.DimmingDeltaActionDown, wantRampMs: 5000},
+	}
+	if len(fake.lightUpdates) != len(tests) {
+		t.Fatalf("light updates = %d, want %d", len(fake.lightUpdates), len(tests))
+	}
+	for i, tt := range tests {
+		body := fake.lightUpdates[i].body
+		if *body.DimmingDelta.Action != tt.action || (body.On != nil) != tt.wantOn {
+			t.Fatalf("%s: update = %#v, want %s with on set %v", tt.name, body, tt.action, tt.wantOn)
+		}
+		if tt.wantRampMs != 0 && (body.Dynamics == nil || *body.Dynamics.Duration != tt.wantRampMs) {
+			t.Fatalf("%s: dynamics = %#v, want %d ms", tt.name, body.Dynamics, tt.wantRampMs)
+		}
+	}
+
+	if _, err := service.StartDimmingLight(ctx, 3, "sideways"); !errors.Is(err, ErrInvalidParameter) {
+		t.Fatalf("StartDimmingLight() error = %v, want ErrInvalidParameter", err)
+	}
+}
+
+func TestDimmingSafetyStop(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addRoom("room-1", "Living room", "grouped-1", true)
+	service := newTestService(fake)
+	service.dimmer = newDimmer(config.Dimming{RampDuration: config.Duration(5 * time.Second), MaxDuration: config.Duration(20 * time.Millisecond)})
+
+	if _, err := service.StartDimmingRoom(context.Background(), "Living room", DimUp); err != nil {
+		t.Fatalf("StartDimmingRoom() error = %v, want nil", err)
+	}
+	waitFor(t, func() bool {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return len(fake.groupedLightUpdates) == 2
+	})
+	if action := *fake.groupedLightUpdates[1].body.DimmingDelta.Action; action != openhue.DimmingDeltaActionStop {
+		t.Fatalf("safety update action = %s, want stop", action)
+	}
+}
+
+func TestDimmingIsNotRetried(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-1", 3, "Bedside", true)
+	service := newTestService(fake)
+	service.retry = retryPolicy{maxAttempts: 3}
+	service.dimmer = newDimmer(config.Dimming{RampDuration: config.Duration(5 * time.Second), MaxDuration: config.Duration(time.Minute)})
+	ctx := context.Background()
+
+	// The light is read first, then the ramp fails.
+	fake.failures = []error{nil, fmt.Errorf("update: %w", syscall.ECONNRESET)}
+	var bridgeErr *BridgeError
+	if _, err := service.StartDimmingLight(ctx, 3, DimUp); !errors.As(err, &bridgeErr) || bridgeErr.Attempts != 1 {
+		t.Fatalf("StartDimmingLight() error = %v, want a bridge error after 1 attempt", err)
+	}
+	if len(fake.lightUpdates) != 0 {
+		t.Fatalf("light updates = %d, want the ramp not to be repeated", len(fake.lightUpdates))
+	}
+}
+
+func TestReleaseRacingDimmingStart(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-1", 3, "Bedside", true)
+	fake.hold = make(chan struct{})
+	service := newTestService(fake)
+	service.dimmer = newDimmer(config.Dimming{RampDuration: config.Duration(5 * time.Second), MaxDuration: config.Duration(time.Minute)})
+	ctx := context.Background()
+
+	started := make(chan error, 1)
+	go func() {
+		_, err := service.StartDimmingLight(ctx, 3, DimUp)
+		started <- err
+	}()
+	waitFor(t, func() bool {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return fake.held == 1
+	})
+
+	service.dimmer.mu.Lock()
+	registered := len(service.dimmer.ramps) == 1
+	service.dimmer.mu.Unlock()
+	if !registered {
+		t.Fatal("ramp was not registered before its start was sent")
+	}
+
+	// The release arrives while the start is still on its way to the bridge.
+	stopped := make(chan error, 1)
+	go func() { stopped <- service.StopDimmingLight(ctx, 3) }()
+	waitFor(t, func() bool {
+		service.dimmer.mu.Lock()
+		defer service.dimmer.mu.Unlock()
+		return len(service.dimmer.ramps) == 0
+	})
+	close(fake.hold)
+
+	if err := <-started; err != nil {
+		t.Fatalf("StartDimmingLight() error = %v, want nil", err)
+	}
+	if err := <-stopped; err != nil {
+		t.Fatalf("StopDimmingLight() error = %v, want nil", err)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.lightUpdates) != 2 || *fake.lightUpdates[1].body.DimmingDelta.Action != openhue.DimmingDeltaActionStop {
+		t.Fatalf("light updates = %#v, want the ramp followed by a stop", fake.lightUpdates)
+	}
+}
@@ -0,0 +1,210 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/openhue/openhue-go"
+)
+
+// EffectNone stops a running effect. The bridge calls it no_effect.
+const EffectNone = "none"
+
+const alertBreathe = "breathe"
+
+// IdentifyLight makes a light breathe briefly, to tell which light an id
+// belongs to. Lights without the breathe alert are rejected.
+func (service *Service) IdentifyLight(ctx context.Context, lightID int) (State, error) {
+	if err := service.ensureInitialized(); err != nil {
+		return State{}, err
+	}
+	light, err := service.findLightByID(ctx, lightID)
+	if err != nil {
+		return State{}, err
+	}
+	if light.Id == nil {
+		return State{}, errors.New("light has no id")
+	}
+	if !canBreathe(*light) {
+		return State{}, errorf(ErrInvalidParameter, "light %d does not support the breathe alert", lightID)
+	}
+
+	action := alertBreathe
+	if err := service.updateLight(ctx, *light.Id, openhue.LightPut{Alert: &openhue.Alert{Action: &action}}); err != nil {
+		return State{}, err
+	}
+	return State{TargetType: "light", Target: strconv.Itoa(lightID), On: light.IsOn()}, nil
+}
+
+// IdentifyRoom makes all lights of a room breathe briefly. It fails when no
+// light of the room supports the breathe alert.
+func (service *Service) IdentifyRoom(ctx context.Context, roomName string) (State, error) {
+	if err := service.ensureInitialized(); err != nil {
+		return State{}, err
+	}
+	if strings.TrimSpace(roomName) == "" {
+		return State{}, errorf(ErrInvalidParameter, "room name must not be empty")
+	}
+	room, err := service.findRoomByName(ctx, roomName)
+	if err != nil {
+		return State{}, err
+	}
+	groupedLightID, ok := groupedLightIDFromRoom(*room)
+	if !ok {
+		return State{}, errors.New("group has no grouped_light service")
+	}
+	groupedLight, err := service.getGroupedLightByID(ctx, groupedLightID)
+	if err != nil {
+		return State{}, err
+	}
+	lights, err := service.getLights(ctx)
+	if err != nil {
+		return State{}, fmt.Errorf("get lights: %w", err)
+	}
+	if !slices.ContainsFunc(service.lightIDsFromRoom(ctx, *room), func(lightID string) bool {
+		light, exists := lights[lightID]
+		return exists && canBreathe(light)
+	}) {
+		return State{}, errorf(ErrInvalidParameter, "no light in room %q supports the breathe alert", roomName)
+	}
+
+	action := alertBreathe
+	if err := service.updateGroupedLight(ctx, groupedLightID, openhue.GroupedLightPut{Alert: &openhue.Alert{Action: &action}}); err != nil {
+		return State{}, err
+	}
+	return State{TargetType: "room", Target: roomName, On: groupedLight.IsOn()}, nil
+}
+
+// SetLightEffect starts an effect such as candle or sparkle on a light, or
+// stops it with EffectNone. Starting an effect switches the light on.
+func (service *Service) SetLightEffect(ctx context.Context, lightID int, effect string) (State, error) {
+	if err := service.ensureInitialized(); err != nil {
+		return State{}, err
+	}
+	light, err := service.findLightByID(ctx, lightID)
+	if err != nil {
+		return State{}, err
+	}
+	if light.Id == nil {
+		return State{}, errors.New("light has no id")
+	}
+	if !canPlay(*light, effect) {
+		supported := supportedEffects(*light)
+		if len(supported) == 0 {
+			return State{}, errorf(ErrInvalidParameter, "light %d does not support effects", lightID)
+		}
+		return State{}, errorf(ErrInvalidParameter, "light %d does not support effect %q, want one of %s", lightID, effect, strings.Join(supported, ", "))
+	}
+
+	if err := service.updateLight(ctx, *light.Id, effectBody(effect)); err != nil {
+		return State{}, err
+	}
+	return effectState("light", strconv.Itoa(lightID), light.IsOn(), effect), nil
+}
+
+// SetRoomEffect starts an effect on every light of a room that supports it, or
+// stops effects with EffectNone. It fails when no light of the room supports the
+// effect or every update failed; otherwise State.Lights reports each light.
+func (service *Service) SetRoomEffect(ctx context.Context, roomName, effect string) (State, error) {
+	if err := service.ensureInitialized(); err != nil {
+		return State{}, err
+	}
+	if strings.TrimSpace(roomName) == "" {
+		return State{}, errorf(ErrInvalidParameter, "room name must not be empty")
+	}
+	room, err := service.findRoomByName(ctx, roomName)
+	if err != nil {
+		return State{}, err
+	}
+	lights, err := service.getLights(ctx)
+	if err != nil {
+		return State{}, fmt.Errorf("get lights: %w", err)
+	}
+
+	// A failed light does not stop the others; the result says which lights changed.
+	var results []LightResult
+	var errs []error
+	on := false
+	for _, lightID := range service.lightIDsFromRoom(ctx, *room) {
+		light, exists := lights[lightID]
+		if !exists || !canPlay(light, effect) {
+			continue
+		}
+		id, err := lightIDV1ToInt(light.IdV1)
+		if err != nil {
+			continue
+		}
+		result := LightResult{ID: id}
+		if err := service.updateLight(ctx, lightID, effectBody(effect)); err != nil {
+			result.Error = err.Error()
+			errs = append(errs, fmt.Errorf("light %d: %w", id, err))
+		} else {
+			on = on || light.IsOn()
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		return State{}, errorf(ErrInvalidParameter, "no light in room %q supports effect %q", roomName, effect)
+	}
+	if len(errs) == len(results) {
+		return State{}, errors.Join(errs...)
+	}
+	slices.SortFunc(results, func(a, b LightResult) int { return a.ID - b.ID })
+
+	state := effectState("room", roomName, on, effect)
+	state.Lights = results
+	return state, nil
+}
+
+// canBreathe reports whether a light lists the breathe alert among its actions.
+func canBreathe(light openhue.LightGet) bool {
+	if light.Alert == nil {
+		return false
+	}
+	actions, _ := (*light.Alert)["action_values"].([]any)
+	return slices.Contains(actions, any(alertBreathe))
+}
+
+// supportedEffects lists the effects a light can play, without no_effect.
+func supportedEffects(light openhue.LightGet) []string {
+	if light.Effects == nil || light.Effects.EffectValues == nil {
+		return nil
+	}
+	effects := make([]string, 0, len(*light.Effects.EffectValues))
+	for _, effect := range *light.Effects.EffectValues {
+		if effect != openhue.SupportedEffectsNoEffect {
+			effects = append(effects, string(effect))
+		}
+	}
+	return effects
+}
+
+// canPlay reports whether a light supports an effect. Any light with effects can stop them.
+func canPlay(light openhue.LightGet, effect string) bool {
+	supported := supportedEffects(light)
+	if effect == EffectNone {
+		return len(supported) > 0
+	}
+	return slices.Contains(supported, effect)
+}
+
+func effectBody(effect string) openhue.LightPut {
+	if effect == EffectNone {
+		noEffect := openhue.SupportedEffectsNoEffect
+		return openhue.LightPut{Effects: &openhue.Effects{Effect: &noEffect}}
+	}
+	on := true
+	value := openhue.SupportedEffects(effect)
+	return openhue.LightPut{On: &openhue.On{On: &on}, Effects: &openhue.Effects{Effect: &value}}
+}
+
+func effectState(targetType, target string, on bool, effect string) State {
+	if effect == EffectNone {
+		return State{TargetType: targetType, Target: target, On: on}
+	}
+	return State{TargetType: targetType, Target: target, On: true, Effect: effect}
+}
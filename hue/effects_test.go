@@ -0,0 +1,175 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/openhue/openhue-go"
+)
+
+func (fake *fakeBridge) setEffects(id string, effects ...openhue.SupportedEffects) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	light := fake.lights[id]
+	light.Effects = &struct {
+		Effect       *openhue.SupportedEffects   `json:"effect,omitempty"`
+		EffectValues *[]openhue.SupportedEffects `json:"effect_values,omitempty"`
+		Status       *openhue.SupportedEffects   `json:"status,omitempty"`
+		StatusValues *[]openhue.SupportedEffects `json:"status_values,omitempty"`
+	}{EffectValues: &effects}
+	fake.lights[id] = light
+}
+
+func (fake *fakeBridge) setAlerts(id string, actions ...any) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	light := fake.lights[id]
+	light.Alert = &map[string]any{"action_values": actions}
+	fake.lights[id] = light
+}
+
+func TestSetLightEffect(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		effect     string
+		wantErr    error
+		wantEffect openhue.SupportedEffects
+		wantOn     bool
+	}{
+		{name: "supported", effect: "candle", wantEffect: openhue.SupportedEffectsCandle, wantOn: true},
+		{name: "stop", effect: EffectNone, wantEffect: openhue.SupportedEffectsNoEffect},
+		{name: "unsupported", effect: "sparkle", wantErr: ErrInvalidParameter},
+		{name: "no_effect is spelled none", effect: "no_effect", wantErr: ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake := newFakeBridge()
+			fake.addLight("light-1", 3, "Lantern", false)
+			fake.setEffects("light-1", openhue.SupportedEffectsNoEffect, openhue.SupportedEffectsCandle, openhue.SupportedEffectsFire)
+			service := newTestService(fake)
+
+			state, err := service.SetLightEffect(context.Background(), 3, tt.effect)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("SetLightEffect() error = %v, want %v", err, tt.wantErr)
+				}
+				if len(fake.lightUpdates) != 0 {
+					t.Fatalf("light updates = %#v, want none", fake.lightUpdates)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetLightEffect() error = %v, want nil", err)
+			}
+			if state.On != tt.wantOn {
+				t.Fatalf("SetLightEffect() = %+v, want on %v", state, tt.wantOn)
+			}
+			if len(fake.lightUpdates) != 1 {
+				t.Fatalf("light updates = %d, want 1", len(fake.lightUpdates))
+			}
+			body := fake.lightUpdates[0].body
+			if *body.Effects.Effect != tt.wantEffect || (body.On != nil) != tt.wantOn {
+				t.Fatalf("update = %#v, want effect %s with on set %v", body, tt.wantEffect, tt.wantOn)
+			}
+		})
+	}
+}
+
+func TestSetRoomEffect(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-1", 1, "Lantern", true)
+	fake.addLight("light-2", 2, "Ceiling", true)
+	fake.addRoom("room-1", "Patio", "grouped-1", true, "light-1", "light-2")
+	fake.setEffects("light-1", openhue.SupportedEffectsNoEffect, openhue.SupportedEffectsFire)
+	service := newTestService(fake)
+	ctx := context.Background()
+
+	state, err := service.SetRoomEffect(ctx, "Patio", "fire")
+	if err != nil {
+		t.Fatalf("SetRoomEffect() error = %v, want nil", err)
+	}
+	if state.Effect != "fire" {
+		t.Fatalf("SetRoomEffect() = %+v, want effect fire", state)
+	}
+	if len(fake.lightUpdates) != 1 || fake.lightUpdates[0].id != "light-1" {
+		t.Fatalf("light updates = %#v, want light-1 alone", fake.lightUpdates)
+	}
+	if _, err := service.SetRoomEffect(ctx, "Patio", "prism"); !errors.Is(err, ErrInvalidParameter) {
+		t.Fatalf("SetRoomEffect() error = %v, want ErrInvalidParameter", err)
+	}
+}
+
+func TestSetRoomEffectReportsFailedLights(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-1", 1, "Lantern", true)
+	fake.addLight("light-2", 2, "Torch", true)
+	fake.addRoom("room-1", "Patio", "grouped-1", true, "light-1", "light-2")
+	fake.setEffects("light-1", openhue.SupportedEffectsNoEffect, openhue.SupportedEffectsFire)
+	fake.setEffects("light-2", openhue.SupportedEffectsNoEffect, openhue.SupportedEffectsFire)
+	// The room and light lookups succeed, then the first update fails.
+	fake.failures = []error{nil, nil, errors.New("boom")}
+	service := newTestService(fake)
+
+	state, err := service.SetRoomEffect(context.Background(), "Patio", "fire")
+	if err != nil {
+		t.Fatalf("SetRoomEffect() error = %v, want nil when one light changed", err)
+	}
+	if len(fake.lightUpdates) != 1 {
+		t.Fatalf("light updates = %#v, want the second light updated after the first failed", fake.lightUpdates)
+	}
+	failed := 0
+	for _, result := range state.Lights {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if len(state.Lights) != 2 || failed != 1 {
+		t.Fatalf("SetRoomEffect() lights = %+v, want two results with one failure", state.Lights)
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-1", 3, "Desk", false)
+	fake.addLight("light-2", 4, "Plug", false)
+	fake.addRoom("room-1", "Office", "grouped-1", true, "light-1")
+	fake.addRoom("room-2", "Hall", "grouped-2", true, "light-2")
+	fake.setAlerts("light-1", alertBreathe)
+	service := newTestService(fake)
+	ctx := context.Background()
+
+	if _, err := service.IdentifyLight(ctx, 4); !errors.Is(err, ErrInvalidParameter) {
+		t.Fatalf("IdentifyLight() of a light without alerts error = %v, want ErrInvalidParameter", err)
+	}
+	if _, err := service.IdentifyRoom(ctx, "Hall"); !errors.Is(err, ErrInvalidParameter) {
+		t.Fatalf("IdentifyRoom() of a room without alerts error = %v, want ErrInvalidParameter", err)
+	}
+	state, err := service.IdentifyLight(ctx, 3)
+	if err != nil {
+		t.Fatalf("IdentifyLight() error = %v, want nil", err)
+	}
+	if state.On {
+		t.Fatalf("IdentifyLight() = %+v, want the light left off", state)
+	}
+	if _, err := service.IdentifyRoom(ctx, "Office"); err != nil {
+		t.Fatalf("IdentifyRoom() error = %v, want nil", err)
+	}
+
+	if len(fake.lightUpdates) != 1 || *fake.lightUpdates[0].body.Alert.Action != alertBreathe || fake.lightUpdates[0].body.On != nil {
+		t.Fatalf("light updates = %#v, want one breathe alert", fake.lightUpdates)
+	}
+	if len(fake.groupedLightUpdates) != 1 || *fake.groupedLightUpdates[0].body.Alert.Action != alertBreathe {
+		t.Fatalf("grouped light updates = %#v, want one breathe alert", fake.groupedLightUpdates)
+	}
+}
@@ -0,0 +1,39 @@
+package hue
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error kinds returned by the service. Use errors.Is to classify an error.
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrAmbiguous        = errors.New("ambiguous")
+	ErrInvalidParameter = errors.New("invalid parameter")
+	ErrRateLimited      = errors.New("rate limited")
+	// ErrUnauthorized means the bridge rejected the configured application key.
+	ErrUnauthorized = errors.New("hue bridge rejected the application key")
+	// ErrBridgeUnreachable means the bridge could not be reached or did not answer in time.
+	ErrBridgeUnreachable = errors.New("hue bridge is unreachable")
+	// ErrBridgeUnavailable is matched by errors from calls that kept failing with
+	// transient errors (timeouts, resets, 5xx) after all retries were spent.
+	ErrBridgeUnavailable = errors.New("hue bridge is unavailable")
+)
+
+// serviceError carries a human readable message while matching one of the error kinds.
+type serviceError struct {
+	kind    error
+	message string
+}
+
+func (serviceErr *serviceError) Error() string {
+	return serviceErr.message
+}
+
+func (serviceErr *serviceError) Unwrap() error {
+	return serviceErr.kind
+}
+
+func errorf(kind error, format string, args ...any) error {
+	return &serviceError{kind: kind, message: fmt.Sprintf(format, args...)}
+}
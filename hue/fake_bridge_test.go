@@ -0,0 +1,293 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/openhue/openhue-go"
+)
+
+// fakeBridge is an in-memory bridge. Updates are applied to the stored resources
+// so that consecutive toggles observe each other.
+type fakeBridge struct {
+	mu            sync.Mutex
+	rooms         map[string]openhue.RoomGet
+	zones         map[string]openhue.RoomGet
+	lights        map[string]openhue.LightGet
+	groupedLights map[string]openhue.GroupedLightGet
+	scenes        map[string]openhue.SceneGet
+
+	lightUpdates        []lightUpdate
+	groupedLightUpdates []groupedLightUpdate
+	sceneUpdates        []sceneUpdate
+
+	// err is returned from every call when set.
+	err error
+	// failures are returned by the next calls, one per call, before err is considered.
+	failures []error
+	calls    int
+	// blockUntilDone makes every call wait for its context to be done.
+	blockUntilDone bool
+	// hold makes light and grouped light updates wait until it is closed;
+	// held counts the updates that started waiting.
+	hold chan struct{}
+	held int
+}
+
+type lightUpdate struct {
+	id   string
+	body openhue.LightPut
+}
+
+type groupedLightUpdate struct {
+	id   string
+	body openhue.GroupedLightPut
+}
+
+type sceneUpdate struct {
+	id   string
+	body openhue.ScenePut
+}
+
+func newFakeBridge() *fakeBridge {
+	return &fakeBridge{
+		rooms:         map[string]openhue.RoomGet{},
+		zones:         map[string]openhue.RoomGet{},
+		lights:        map[string]openhue.LightGet{},
+		groupedLights: map[string]openhue.GroupedLightGet{},
+		scenes:        map[string]openhue.SceneGet{},
+	}
+}
+
+func newTestService(fake *fakeBridge) *Service {
+	return &Service{bridge: fake, lifecycle: newLifecycle()}
+}
+
+func (fake *fakeBridge) addLight(id string, v1ID int, name string, on bool) {
+	idV1 := fmt.Sprintf("/lights/%d", v1ID)
+	light := openhue.LightGet{Id: &id, IdV1: &idV1, On: &openhue.On{On: &on}}
+	light.Metadata = &struct {
+		Archetype  *openhue.LightArchetype `json:"archetype,omitempty"`
+		FixedMired *int                    `json:"fixed_mired,omitempty"`
+		Name       *string                 `json:"name,omitempty"`
+	}{Name: &name}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.lights[id] = light
+}
+
+func (fake *fakeBridge) addRoom(id, name, groupedLightID string, on bool, lightIDs ...string) {
+	room := newFakeGroup(id, name, groupedLightID, lightIDs)
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.rooms[id] = room
+	fake.groupedLights[groupedLightID] = openhue.GroupedLightGet{Id: &groupedLightID, On: &openhue.On{On: &on}}
+}
+
+func (fake *fakeBridge) addZone(id, name, groupedLightID string, on bool, lightIDs ...string) {
+	zone := newFakeGroup(id, name, groupedLightID, lightIDs)
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.zones[id] = zone
+	fake.groupedLights[groupedLightID] = openhue.GroupedLightGet{Id: &groupedLightID, On: &openhue.On{On: &on}}
+}
+
+func (fake *fakeBridge) addScene(id, name, groupID string, groupType openhue.ResourceIdentifierRtype) {
+	scene := openhue.SceneGet{
+		Id:       &id,
+		Metadata: &openhue.SceneMetadata{Name: &name},
+		Group:    &openhue.ResourceIdentifier{Rid: &groupID, Rtype: &groupType},
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.scenes[id] = scene
+}
+
+func newFakeGroup(id, name, groupedLightID string, lightIDs []string) openhue.RoomGet {
+	lightType := openhue.ResourceIdentifierRtypeLight
+	groupedLightType := openhue.ResourceIdentifierRtypeGroupedLight
+
+	children := make([]openhue.ResourceIdentifier, 0, len(lightIDs))
+	for _, lightID := range lightIDs {
+		children = append(children, openhue.ResourceIdentifier{Rid: &lightID, Rtype: &lightType})
+	}
+	services := []openhue.ResourceIdentifier{{Rid: &groupedLightID, Rtype: &groupedLightType}}
+	room := openhue.RoomGet{Id: &id, Children: &children, Services: &services}
+	room.Metadata = &struct {
+		Archetype *openhue.RoomArchetype `json:"archetype,omitempty"`
+		Name      *string                `json:"name,omitempty"`
+	}{Name: &name}
+	return room
+}
+
+func (fake *fakeBridge) wait(ctx context.Context) error {
+	fake.mu.Lock()
+	fake.calls++
+	block, err := fake.blockUntilDone, fake.err
+	if len(fake.failures) > 0 {
+		err, fake.failures = fake.failures[0], fake.failures[1:]
+	}
+	fake.mu.Unlock()
+
+	if block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return err
+}
+
+func (fake *fakeBridge) waitUpdate(ctx context.Context) error {
+	if err := fake.wait(ctx); err != nil {
+		return err
+	}
+	fake.mu.Lock()
+	hold := fake.hold
+	if hold != nil {
+		fake.held++
+	}
+	fake.mu.Unlock()
+
+	if hold == nil {
+		return nil
+	}
+	select {
+	case <-hold:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (fake *fakeBridge) GetBridgeHome(ctx context.Context) error {
+	return fake.wait(ctx)
+}
+
+func (fake *fakeBridge) GetRooms(ctx context.Context) (map[string]openhue.RoomGet, error) {
+	if err := fake.wait(ctx); err != nil {
+		return nil, err
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	rooms := make(map[string]openhue.RoomGet, len(fake.rooms))
+	for id, room := range fake.rooms {
+		rooms[id] = room
+	}
+	return rooms, nil
+}
+
+func (fake *fakeBridge) GetZones(ctx context.Context) (map[string]openhue.RoomGet, error) {
+	if err := fake.wait(ctx); err != nil {
+		return nil, err
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	zones := make(map[string]openhue.RoomGet, len(fake.zones))
+	for id, zone := range fake.zones {
+		zones[id] = zone
+	}
+	return zones, nil
+}
+
+func (fake *fakeBridge) GetLights(ctx context.Context) (map[string]openhue.LightGet, error) {
+	if err := fake.wait(ctx); err != nil {
+		return nil, err
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	lights := make(map[string]openhue.LightGet, len(fake.lights))
+	for id, light := range fake.lights {
+		lights[id] = light
+	}
+	return lights, nil
+}
+
+func (fake *fakeBridge) GetDevice(ctx context.Context, deviceID string) (*openhue.DeviceGet, error) {
+	if err := fake.wait(ctx); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("device %q not found", deviceID)
+}
+
+func (fake *fakeBridge) GetGroupedLight(ctx context.Context, groupedLightID string) (*openhue.GroupedLightGet, error) {
+	if err := fake.wait(ctx); err != nil {
+		return nil, err
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	groupedLight, exists := fake.groupedLights[groupedLightID]
+	if !exists {
+		return nil, &openhue.ApiError{StatusCode: 404}
+	}
+	return &groupedLight, nil
+}
+
+func (fake *fakeBridge) GetGroupedLights(ctx context.Context) (map[string]openhue.GroupedLightGet, error) {
+	if err := fake.wait(ctx); err != nil {
+		return nil, err
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	groupedLights := make(map[string]openhue.GroupedLightGet, len(fake.groupedLights))
+	for id, groupedLight := range fake.groupedLights {
+		groupedLights[id] = groupedLight
+	}
+	return groupedLights, nil
+}
+
+func (fake *fakeBridge) GetScenes(ctx context.Context) (map[string]openhue.SceneGet, error) {
+	if err := fake.wait(ctx); err != nil {
+		return nil, err
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	scenes := make(map[string]openhue.SceneGet, len(fake.scenes))
+	for id, scene := range fake.scenes {
+		scenes[id] = scene
+	}
+	return scenes, nil
+}
+
+func (fake *fakeBridge) UpdateLight(ctx context.Context, lightID string, body openhue.LightPut) error {
+	if err := fake.waitUpdate(ctx); err != nil {
+		return err
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.lightUpdates = append(fake.lightUpdates, lightUpdate{id: lightID, body: body})
+	if light, exists := fake.lights[lightID]; exists && body.On != nil {
+		on := *body.On.On
+		light.On = &openhue.On{On: &on}
+		fake.lights[lightID] = light
+	}
+	return nil
+}
+
+func (fake *fakeBridge) UpdateGroupedLight(ctx context.Context, groupedLightID string, body openhue.GroupedLightPut) error {
+	if err := fake.waitUpdate(ctx); err != nil {
+		return err
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.groupedLightUpdates = append(fake.groupedLightUpdates, groupedLightUpdate{id: groupedLightID, body: body})
+	if groupedLight, exists := fake.groupedLights[groupedLightID]; exists && body.On != nil {
+		on := *body.On.On
+		groupedLight.On = &openhue.On{On: &on}
+		fake.groupedLights[groupedLightID] = groupedLight
+	}
+	return nil
+}
+
+func (fake *fakeBridge) UpdateScene(ctx context.Context, sceneID string, body openhue.ScenePut) error {
+	if err := fake.wait(ctx); err != nil {
+		return err
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.sceneUpdates = append(fake.sceneUpdates, sceneUpdate{id: sceneID, body: body})
+	return nil
+}
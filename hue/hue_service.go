@@ -1,14 +1,18 @@
 package hue
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"hueshelly/config"
 	"hueshelly/logging"
+	"hueshelly/metrics"
 
 	"github.com/openhue/openhue-go"
 )
@@ -16,17 +20,30 @@ import (
 var errServiceNotInitialized = errors.New("hue service is not initialized")
 
 type Service struct {
-	home                      *openhue.Home
+	bridge                    bridge
 	restorePreviousLightState bool
+	bridgeTimeout             time.Duration
+	retry                     retryPolicy
+	commands                  *commandQueue
+	lifecycle                 *lifecycle
+	timers                    *timerSet
+	daylight                  *daylight
+	onProfiles                *onProfiles
+	transitions               config.Transitions
+	dimmer                    *dimmer
+	togglePolicies            config.TogglePolicies
+	restore                   config.Restore
+	snapshots                 *snapshotStore
 }
 
-func New(cfg config.Config) (*Service, error) {
+// New connects to the bridge. Cancelling ctx aborts bridge discovery.
+func New(ctx context.Context, cfg config.Config) (*Service, error) {
 	bridgeIP := strings.TrimSpace(cfg.HueBridgeIP)
 	if bridgeIP != "" {
 		logging.Logger.Println("Using bridge at", bridgeIP)
 	} else {
 		logging.Logger.Println("Searching for bridge")
-		discoveredBridge, err := openhue.NewBridgeDiscovery().Discover()
+		discoveredBridge, err := discoverBridge(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("discover bridge: %w", err)
 		}
@@ -37,99 +54,261 @@ func New(cfg config.Config) (*Service, error) {
 		logging.Logger.Println("Found hue bridge at", bridgeIP)
 	}
 
-	home, err := openhue.NewHome(bridgeIP, cfg.HueUser)
+	client, err := newClipBridge(bridgeIP, cfg.HueUser)
 	if err != nil {
-		return nil, fmt.Errorf("create hue home: %w", err)
+		return nil, fmt.Errorf("create bridge client: %w", err)
 	}
-	if _, err := home.GetBridgeHome(); err != nil {
+
+	retry := retryPolicy{
+		maxAttempts:    cfg.BridgeRetry.MaxAttempts,
+		initialBackoff: cfg.BridgeRetry.InitialBackoff.Duration(),
+		maxBackoff:     cfg.BridgeRetry.MaxBackoff.Duration(),
+	}
+	service := &Service{
+		bridge:                    client,
+		restorePreviousLightState: cfg.RestorePreviousLightState,
+		bridgeTimeout:             cfg.BridgeTimeout.Duration(),
+		retry:                     retry,
+		commands: newCommandQueue(
+			cfg.BridgeRateLimit.QueueSize,
+			cfg.BridgeRateLimit.LightCommandsPerSecond,
+			cfg.BridgeRateLimit.GroupCommandsPerSecond,
+			retry,
+		),
+		lifecycle:      newLifecycle(),
+		timers:         newTimerSet(cfg.TimerStateFile),
+		daylight:       newDaylight(cfg),
+		onProfiles:     newOnProfiles(cfg),
+		transitions:    cfg.Transitions,
+		dimmer:         newDimmer(cfg.Dimming),
+		togglePolicies: cfg.TogglePolicies,
+		restore:        cfg.Restore,
+		snapshots:      newSnapshotStore(),
+	}
+	if err := service.callBridge(ctx, "get_bridge_home", client.GetBridgeHome); err != nil {
 		return nil, fmt.Errorf("communicate with bridge: %w", err)
 	}
 
 	logging.Logger.Println("Logged in at hue bridge")
-	return &Service{
-		home:                      home,
-		restorePreviousLightState: cfg.RestorePreviousLightState,
-	}, nil
+	service.commands.start(service.lifecycle.background)
+	service.restoreTimers()
+	return service, nil
+}
+
+// discoverBridge runs the blocking openhue discovery but returns early when ctx is cancelled.
+func discoverBridge(ctx context.Context) (*openhue.BridgeInfo, error) {
+	type discoveryResult struct {
+		bridge *openhue.BridgeInfo
+		err    error
+	}
+
+	results := make(chan discoveryResult, 1)
+	go func() {
+		bridge, err := openhue.NewBridgeDiscovery().Discover()
+		results <- discoveryResult{bridge: bridge, err: err}
+	}()
+
+	select {
+	case result := <-results:
+		return result.bridge, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ToggleOptions adjust a toggle. The zero value toggles with the configured defaults.
+type ToggleOptions struct {
+	// For switches the target on instead of toggling it, and off again after For.
+	For time.Duration
+	// Transition overrides the configured transition time.
+	Transition *time.Duration
 }
 
-func (service *Service) ToggleLight(lightID int) error {
+func (options ToggleOptions) validate() error {
+	if options.For < 0 {
+		return errorf(ErrInvalidParameter, "timer duration must not be negative, got %s", options.For)
+	}
+	if options.Transition != nil {
+		if err := config.ValidateTransition(*options.Transition); err != nil {
+			return errorf(ErrInvalidParameter, "%v", err)
+		}
+	}
+	return nil
+}
+
+// ToggleLight switches a light off when it is on and on otherwise, and returns the state that was sent.
+// It cancels the light's auto-off timer.
+func (service *Service) ToggleLight(ctx context.Context, lightID int) (State, error) {
+	return service.ToggleLightWith(ctx, lightID, ToggleOptions{})
+}
+
+// ToggleLightWith is ToggleLight with options.
+func (service *Service) ToggleLightWith(ctx context.Context, lightID int, options ToggleOptions) (State, error) {
 	if err := service.ensureInitialized(); err != nil {
-		return err
+		return State{}, err
+	}
+	if lightID <= 0 {
+		return State{}, errorf(ErrInvalidParameter, "light id must be positive, got %d", lightID)
+	}
+	if err := options.validate(); err != nil {
+		return State{}, err
+	}
+	if options.For > 0 {
+		return service.turnOnLightFor(ctx, lightID, options)
 	}
 
-	light, err := service.findLightByID(lightID)
+	light, err := service.findLightByID(ctx, lightID)
 	if err != nil {
-		return err
+		return State{}, err
 	}
 	if light.Id == nil {
-		return errors.New("light has no id")
+		return State{}, errors.New("light has no id")
 	}
 
+	state := State{TargetType: "light", Target: strconv.Itoa(lightID)}
+	service.timers.cancel(state.TargetType, state.Target)
+	dynamics := service.lightDynamics(state.Target, options.Transition)
+	snapshotMode := service.restoreMode(state.TargetType, state.Target) == config.RestoreSnapshot
 	if light.IsOn() {
+		if snapshotMode {
+			service.snapshots.save(state.TargetType, state.Target, map[string]lightSnapshot{*light.Id: snapshotOf(*light)})
+		}
 		off := false
-		if err := service.home.UpdateLight(*light.Id, openhue.LightPut{On: &openhue.On{On: &off}}); err != nil {
-			return err
+		if err := service.updateLight(ctx, *light.Id, openhue.LightPut{On: &openhue.On{On: &off}, Dynamics: dynamics}); err != nil {
+			return State{}, err
 		}
+		metrics.ToggleActions.Inc("light", state.Target, state.label())
 		logging.Logger.Println("Light found - toggled to off")
-		return nil
+		return state, nil
 	}
 
-	on := true
-	body := openhue.LightPut{On: &openhue.On{On: &on}}
-	if !service.restorePreviousLightState {
-		brightness := openhue.Brightness(100)
-		body.Dimming = &openhue.Dimming{Brightness: &brightness}
-	}
-	if err := service.home.UpdateLight(*light.Id, body); err != nil {
-		return err
+	state.On = true
+	if snapshotMode {
+		snapshot, err := service.restoreLight(ctx, state.Target, *light.Id, dynamics)
+		if err != nil {
+			return State{}, err
+		}
+		if snapshot != nil {
+			state.Brightness = brightnessValue(snapshot.brightness)
+			metrics.ToggleActions.Inc("light", state.Target, state.label())
+			logging.Logger.Println("Light found - restored snapshot")
+			return state, nil
+		}
 	}
+
+	on := true
+	body := openhue.LightPut{On: &openhue.On{On: &on}, Dynamics: dynamics}
+	settings := service.onSettings("light", state.Target)
+	if settings.brightness != nil {
+		body.Dimming = &openhue.Dimming{Brightness: settings.brightness}
+		state.Brightness = brightnessValue(settings.brightness)
+	} else if light.Dimming != nil {
+		state.Brightness = brightnessValue(light.Dimming.Brightness)
+	}
+	if light.ColorTemperature != nil {
+		body.ColorTemperature = colorTemperature(settings.colorTemperature)
+		state.ColorTemperature = settings.colorTemperature
+	}
+	if err := service.updateLight(ctx, *light.Id, body); err != nil {
+		return State{}, err
+	}
+	metrics.ToggleActions.Inc("light", state.Target, state.label())
 	logging.Logger.Println("Light found - toggled to on")
-	return nil
+	return state, nil
 }
 
-func (service *Service) ToggleLightsInRoom(roomName string) error {
+// ToggleLightsInRoom toggles the grouped light of a room and returns the state that was sent.
+// It cancels the room's auto-off timer.
+func (service *Service) ToggleLightsInRoom(ctx context.Context, roomName string) (State, error) {
+	return service.ToggleLightsInRoomWith(ctx, roomName, ToggleOptions{})
+}
+
+// ToggleLightsInRoomWith is ToggleLightsInRoom with options.
+func (service *Service) ToggleLightsInRoomWith(ctx context.Context, roomName string, options ToggleOptions) (State, error) {
 	if err := service.ensureInitialized(); err != nil {
-		return err
+		return State{}, err
+	}
+	if strings.TrimSpace(roomName) == "" {
+		return State{}, errorf(ErrInvalidParameter, "room name must not be empty")
+	}
+	if err := options.validate(); err != nil {
+		return State{}, err
+	}
+	if options.For > 0 {
+		return service.turnOnRoomFor(ctx, roomName, options)
 	}
 
-	rooms, err := service.home.GetRooms()
+	room, err := service.findRoomByName(ctx, roomName)
 	if err != nil {
-		return fmt.Errorf("get rooms: %w", err)
+		return State{}, err
 	}
 
-	for _, room := range rooms {
-		if nameFromRoom(room) != roomName {
-			continue
-		}
+	groupedLightID, ok := groupedLightIDFromRoom(*room)
+	if !ok {
+		return State{}, errors.New("group has no grouped_light service")
+	}
+	state, err := service.toggleGroupedLightByID(ctx, groupedLightID, *room, options.Transition)
+	if err != nil {
+		return State{}, err
+	}
+	state.TargetType = "room"
+	state.Target = roomName
+	service.timers.cancel(state.TargetType, state.Target)
+	metrics.ToggleActions.Inc("room", roomName, state.label())
+	return state, nil
+}
+
+// findRoomByName returns the only room named roomName. Room names are not unique
+// on the bridge, so a name shared by several rooms is reported as ambiguous.
+func (service *Service) findRoomByName(ctx context.Context, roomName string) (*openhue.RoomGet, error) {
+	return service.findGroupByName(ctx, "room", roomName, service.getRooms)
+}
 
-		groupedLightID, ok := groupedLightIDFromRoom(room)
-		if !ok {
-			return errors.New("group has no grouped_light service")
+func (service *Service) findGroupByName(ctx context.Context, kind, name string, list groupLister) (*openhue.RoomGet, error) {
+	groups, err := list(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get %ss: %w", kind, err)
+	}
+
+	var found *openhue.RoomGet
+	matches := 0
+	for _, group := range groups {
+		if nameFromRoom(group) != name {
+			continue
 		}
-		return service.toggleGroupedLightByID(groupedLightID)
+		matches++
+		groupCopy := group
+		found = &groupCopy
 	}
 
-	return fmt.Errorf("no room with name %q found", roomName)
+	switch matches {
+	case 0:
+		return nil, errorf(ErrNotFound, "no %s with name %q found", kind, name)
+	case 1:
+		return found, nil
+	default:
+		return nil, errorf(ErrAmbiguous, "%d %ss are named %q", matches, kind, name)
+	}
 }
 
-func (service *Service) AvailableGroups() ([]Group, error) {
+func (service *Service) AvailableGroups(ctx context.Context) ([]Group, error) {
 	if err := service.ensureInitialized(); err != nil {
 		return nil, err
 	}
 
-	rooms, err := service.home.GetRooms()
+	rooms, err := service.getRooms(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("get rooms: %w", err)
 	}
-	lights, err := service.home.GetLights()
+	lights, err := service.getLights(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("get lights: %w", err)
 	}
 
 	groupList := make([]Group, 0, len(rooms))
 	for _, room := range rooms {
-		group := Group{Name: nameFromRoom(room)}
-		lightIDs := service.lightIDsFromRoom(room)
+		group := Group{Name: nameFromRoom(room), TogglePolicy: service.togglePolicies.Policy(nameFromRoom(room))}
+		lightIDs := service.lightIDsFromRoom(ctx, room)
 		lightList := make([]Light, 0, len(lightIDs))
 		for _, lightID := range lightIDs {
 			light, exists := lights[lightID]
@@ -146,12 +325,7 @@ func (service *Service) AvailableGroups() ([]Group, error) {
 			})
 		}
 
-		sort.Slice(lightList, func(i, j int) bool {
-			if lightList[i].Name == lightList[j].Name {
-				return lightList[i].ID < lightList[j].ID
-			}
-			return lightList[i].Name < lightList[j].Name
-		})
+		sortLights(lightList)
 		group.Lights = lightList
 		groupList = append(groupList, group)
 	}
@@ -162,39 +336,100 @@ func (service *Service) AvailableGroups() ([]Group, error) {
 	return groupList, nil
 }
 
-func (service *Service) toggleGroupedLightByID(groupedLightID string) error {
-	groupedLight, err := service.home.GetGroupedLightById(groupedLightID)
+// toggleGroupedLightByID toggles the grouped light of a room by the room's toggle
+// policy and returns the state that was sent. The caller fills in the target.
+func (service *Service) toggleGroupedLightByID(ctx context.Context, groupedLightID string, room openhue.RoomGet, transition *time.Duration) (State, error) {
+	roomName := nameFromRoom(room)
+	groupedLight, err := service.getGroupedLightByID(ctx, groupedLightID)
 	if err != nil {
-		return err
+		return State{}, err
 	}
 	if groupedLight.Id == nil {
-		return errors.New("grouped light has no id")
+		return State{}, errors.New("grouped light has no id")
 	}
 
-	if groupedLight.IsOn() {
+	switchOff, err := service.countsAsOn(ctx, "room", room, groupedLight)
+	if err != nil {
+		return State{}, err
+	}
+	dynamics := service.groupDynamics("room", roomName, transition)
+	snapshotMode := service.restoreMode("room", roomName) == config.RestoreSnapshot
+	if switchOff {
+		if snapshotMode {
+			if err := service.snapshotGroup(ctx, "room", room); err != nil {
+				return State{}, err
+			}
+		}
 		off := false
-		if err := service.home.UpdateGroupedLight(*groupedLight.Id, openhue.GroupedLightPut{On: &openhue.On{On: &off}}); err != nil {
-			return err
+		if err := service.updateGroupedLight(ctx, *groupedLight.Id, openhue.GroupedLightPut{On: &openhue.On{On: &off}, Dynamics: dynamics}); err != nil {
+			return State{}, err
+		}
+		logging.Logger.Println("Group found - lights on toggling to off")
+		return State{}, nil
+	}
+
+	if snapshotMode {
+		restored, err := service.restoreGroup(ctx, "room", roomName, lightDynamicsOf(dynamics))
+		if err != nil {
+			return State{}, err
+		}
+		if restored {
+			logging.Logger.Println("Group found - restored snapshot")
+			return State{On: true}, nil
 		}
-		logging.Logger.Println("Group found - any lights on toggling to off")
-		return nil
 	}
 
 	on := true
-	body := openhue.GroupedLightPut{On: &openhue.On{On: &on}}
-	if !service.restorePreviousLightState {
-		brightness := openhue.Brightness(100)
-		body.Dimming = &openhue.Dimming{Brightness: &brightness}
+	body := openhue.GroupedLightPut{On: &openhue.On{On: &on}, Dynamics: dynamics}
+	state := State{On: true}
+	settings := service.onSettings("room", roomName)
+	if settings.brightness != nil {
+		body.Dimming = &openhue.Dimming{Brightness: settings.brightness}
+		state.Brightness = brightnessValue(settings.brightness)
+	} else if groupedLight.Dimming != nil {
+		state.Brightness = brightnessValue(groupedLight.Dimming.Brightness)
+	}
+	if settings.colorTemperature != nil {
+		supported, err := service.supportsColorTemperature(ctx, room)
+		if err != nil {
+			return State{}, err
+		}
+		if supported {
+			body.ColorTemperature = colorTemperature(settings.colorTemperature)
+			state.ColorTemperature = settings.colorTemperature
+		}
 	}
-	if err := service.home.UpdateGroupedLight(*groupedLight.Id, body); err != nil {
-		return err
+	if err := service.updateGroupedLight(ctx, *groupedLight.Id, body); err != nil {
+		return State{}, err
 	}
-	logging.Logger.Println("Group found - all lights off toggling to on")
-	return nil
+	logging.Logger.Println("Group found - toggling to on")
+	return state, nil
 }
 
-func (service *Service) findLightByID(lightID int) (*openhue.LightGet, error) {
-	lights, err := service.home.GetLights()
+// supportsColorTemperature reports whether any light of a group has a
+// colour temperature, so that rooms of plain dimmable lights are not sent one.
+func (service *Service) supportsColorTemperature(ctx context.Context, group openhue.RoomGet) (bool, error) {
+	lights, err := service.getLights(ctx)
+	if err != nil {
+		return false, fmt.Errorf("get lights: %w", err)
+	}
+	return slices.ContainsFunc(service.lightIDsFromRoom(ctx, group), func(lightID string) bool {
+		light, exists := lights[lightID]
+		return exists && light.ColorTemperature != nil
+	}), nil
+}
+
+func sortLights(lights []Light) {
+	sort.Slice(lights, func(i, j int) bool {
+		if lights[i].Name == lights[j].Name {
+			return lights[i].ID < lights[j].ID
+		}
+		return lights[i].Name < lights[j].Name
+	})
+}
+
+func (service *Service) findLightByID(ctx context.Context, lightID int) (*openhue.LightGet, error) {
+	lights, err := service.getLights(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -208,7 +443,7 @@ func (service *Service) findLightByID(lightID int) (*openhue.LightGet, error) {
 			return &lightCopy, nil
 		}
 	}
-	return nil, fmt.Errorf("light with id %d not found", lightID)
+	return nil, errorf(ErrNotFound, "light with id %d not found", lightID)
 }
 
 func lightIDV1ToInt(idV1 *string) (int, error) {
@@ -251,7 +486,7 @@ func nameFromLight(light openhue.LightGet) string {
 	return *light.Metadata.Name
 }
 
-func (service *Service) lightIDsFromRoom(room openhue.RoomGet) []string {
+func (service *Service) lightIDsFromRoom(ctx context.Context, room openhue.RoomGet) []string {
 	lightMap := map[string]struct{}{}
 	if room.Children == nil {
 		return []string{}
@@ -265,7 +500,7 @@ func (service *Service) lightIDsFromRoom(room openhue.RoomGet) []string {
 		case openhue.ResourceIdentifierRtypeLight:
 			lightMap[*child.Rid] = struct{}{}
 		case openhue.ResourceIdentifierRtypeDevice:
-			device, err := service.home.GetDeviceById(*child.Rid)
+			device, err := service.getDeviceByID(ctx, *child.Rid)
 			if err != nil || device.Services == nil {
 				continue
 			}
@@ -289,18 +524,61 @@ func (service *Service) lightIDsFromRoom(room openhue.RoomGet) []string {
 }
 
 func (service *Service) ensureInitialized() error {
-	if service == nil || service.home == nil {
+	if service == nil || service.bridge == nil || service.lifecycle == nil {
 		return errServiceNotInitialized
 	}
 	return nil
 }
 
 type Group struct {
-	Name   string  `json:"name"`
-	Lights []Light `json:"lights"`
+	Name string `json:"name"`
+	// TogglePolicy decides when toggling the room switches it off.
+	TogglePolicy string  `json:"togglePolicy"`
+	Lights       []Light `json:"lights"`
 }
 
 type Light struct {
 	Name string `json:"name"`
 	ID   int    `json:"id"`
 }
+
+// State is the state a command sent to a light or room.
+type State struct {
+	// TargetType is "light", "room", "zone" or "scene".
+	TargetType string `json:"targetType"`
+	Target     string `json:"target"`
+	On         bool   `json:"on"`
+	// Brightness in percent. When the previous brightness is restored it is the
+	// last brightness reported by the bridge, and nil if the bridge reported none.
+	Brightness *float64 `json:"brightness,omitempty"`
+	// ColorTemperature in Kelvin, when the command set one.
+	ColorTemperature *int `json:"colorTemperature,omitempty"`
+	// Color, when the command set one.
+	Color *XY `json:"color,omitempty"`
+	// Effect is the effect the command started, such as candle.
+	Effect string `json:"effect,omitempty"`
+	// Lights reports each light of a room the command was sent to light by light.
+	Lights []LightResult `json:"lights,omitempty"`
+}
+
+// LightResult is the outcome of a room command for one of its lights.
+type LightResult struct {
+	ID int `json:"id"`
+	// Error is empty when the light applied the command.
+	Error string `json:"error,omitempty"`
+}
+
+func (state State) label() string {
+	if state.On {
+		return "on"
+	}
+	return "off"
+}
+
+func brightnessValue(brightness *openhue.Brightness) *float64 {
+	if brightness == nil {
+		return nil
+	}
+	value := float64(*brightness)
+	return &value
+}
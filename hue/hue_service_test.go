@@ -0,0 +1,170 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestToggleLight(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-uuid", 3, "Desk", false)
+	service := newTestService(fake)
+
+	state, err := service.ToggleLight(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("ToggleLight() error = %v, want nil", err)
+	}
+	if !state.On || state.TargetType != "light" || state.Target != "3" || state.Brightness == nil || *state.Brightness != 100 {
+		t.Fatalf("ToggleLight() state = %+v, want light 3 on at brightness 100", state)
+	}
+	state, err = service.ToggleLight(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("ToggleLight() error = %v, want nil", err)
+	}
+	if state.On || state.Brightness != nil {
+		t.Fatalf("ToggleLight() state = %+v, want off without brightness", state)
+	}
+
+	if len(fake.lightUpdates) != 2 {
+		t.Fatalf("light updates = %d, want 2", len(fake.lightUpdates))
+	}
+	turnOn := fake.lightUpdates[0].body
+	if !*turnOn.On.On {
+		t.Fatalf("first toggle on = false, want true")
+	}
+	if turnOn.Dimming == nil || *turnOn.Dimming.Brightness != 100 {
+		t.Fatalf("first toggle dimming = %#v, want brightness 100", turnOn.Dimming)
+	}
+	turnOff := fake.lightUpdates[1].body
+	if *turnOff.On.On {
+		t.Fatalf("second toggle on = true, want false")
+	}
+}
+
+func TestToggleLightRestoresPreviousState(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-uuid", 3, "Desk", false)
+	service := newTestService(fake)
+	service.restorePreviousLightState = true
+
+	if _, err := service.ToggleLight(context.Background(), 3); err != nil {
+		t.Fatalf("ToggleLight() error = %v, want nil", err)
+	}
+	if fake.lightUpdates[0].body.Dimming != nil {
+		t.Fatalf("dimming = %#v, want nil when restoring previous state", fake.lightUpdates[0].body.Dimming)
+	}
+}
+
+func TestToggleLightNotFound(t *testing.T) {
+	t.Parallel()
+
+	service := newTestService(newFakeBridge())
+	if _, err := service.ToggleLight(context.Background(), 42); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("ToggleLight() error = %v, want ErrNotFound", err)
+	}
+	if _, err := service.ToggleLight(context.Background(), 0); !errors.Is(err, ErrInvalidParameter) {
+		t.Fatalf("ToggleLight(0) error = %v, want ErrInvalidParameter", err)
+	}
+}
+
+func TestToggleLightsInRoomErrors(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addRoom("room-1", "Kitchen", "grouped-1", true)
+	fake.addRoom("room-2", "Office", "grouped-2", true)
+	fake.addRoom("room-3", "Office", "grouped-3", false)
+	service := newTestService(fake)
+
+	tests := []struct {
+		room string
+		want error
+	}{
+		{room: "Garage", want: ErrNotFound},
+		{room: "Office", want: ErrAmbiguous},
+		{room: " ", want: ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		if _, err := service.ToggleLightsInRoom(context.Background(), tt.room); !errors.Is(err, tt.want) {
+			t.Fatalf("ToggleLightsInRoom(%q) error = %v, want %v", tt.room, err, tt.want)
+		}
+	}
+	if len(fake.groupedLightUpdates) != 0 {
+		t.Fatalf("grouped light updates = %d, want 0", len(fake.groupedLightUpdates))
+	}
+}
+
+func TestToggleLightsInRoom(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addRoom("room-uuid", "Kitchen", "grouped-uuid", true)
+	service := newTestService(fake)
+
+	state, err := service.ToggleLightsInRoom(context.Background(), "Kitchen")
+	if err != nil {
+		t.Fatalf("ToggleLightsInRoom() error = %v, want nil", err)
+	}
+	if want := (State{TargetType: "room", Target: "Kitchen"}); !reflect.DeepEqual(state, want) {
+		t.Fatalf("ToggleLightsInRoom() state = %+v, want %+v", state, want)
+	}
+	if len(fake.groupedLightUpdates) != 1 || *fake.groupedLightUpdates[0].body.On.On {
+		t.Fatalf("grouped light updates = %#v, want one update switching off", fake.groupedLightUpdates)
+	}
+
+	if _, err := service.ToggleLightsInRoom(context.Background(), "Hallway"); err == nil {
+		t.Fatalf("ToggleLightsInRoom() error = nil, want non-nil for unknown room")
+	}
+}
+
+func TestAvailableGroups(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-b", 2, "Counter", false)
+	fake.addLight("light-a", 1, "Ceiling", false)
+	fake.addRoom("room-uuid", "Kitchen", "grouped-uuid", false, "light-b", "light-a")
+	service := newTestService(fake)
+
+	got, err := service.AvailableGroups(context.Background())
+	if err != nil {
+		t.Fatalf("AvailableGroups() error = %v, want nil", err)
+	}
+	want := []Group{{
+		Name:         "Kitchen",
+		TogglePolicy: "any-on",
+		Lights:       []Light{{Name: "Ceiling", ID: 1}, {Name: "Counter", ID: 2}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("AvailableGroups() = %#v, want %#v", got, want)
+	}
+}
+
+func TestBridgeCallsHonourContext(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.blockUntilDone = true
+	service := newTestService(fake)
+	service.bridgeTimeout = 10 * time.Millisecond
+
+	_, err := service.ToggleLight(context.Background(), 1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("ToggleLight() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	service.bridgeTimeout = time.Minute
+	_, err = service.ToggleLightsInRoom(ctx, "Kitchen")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ToggleLightsInRoom() error = %v, want %v", err, context.Canceled)
+	}
+}
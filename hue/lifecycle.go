@@ -0,0 +1,71 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+var errServiceClosed = errorf(ErrBridgeUnavailable, "hue service is shutting down")
+
+// lifecycle tracks in-flight bridge calls and owns the context of background goroutines.
+type lifecycle struct {
+	mu       sync.RWMutex
+	closed   bool
+	inFlight sync.WaitGroup
+
+	background     context.Context
+	stopBackground context.CancelFunc
+}
+
+func newLifecycle() *lifecycle {
+	background, stopBackground := context.WithCancel(context.Background())
+	return &lifecycle{
+		background:     background,
+		stopBackground: stopBackground,
+	}
+}
+
+// begin registers an in-flight bridge call. The returned function must be called when the call is done.
+func (lc *lifecycle) begin() (func(), error) {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+	if lc.closed {
+		return nil, errServiceClosed
+	}
+	lc.inFlight.Add(1)
+	return lc.inFlight.Done, nil
+}
+
+// Close cancels background goroutines, rejects new bridge calls and waits for
+// in-flight calls to drain until ctx expires.
+func (service *Service) Close(ctx context.Context) error {
+	if service == nil || service.lifecycle == nil {
+		return nil
+	}
+	lc := service.lifecycle
+
+	lc.mu.Lock()
+	if lc.closed {
+		lc.mu.Unlock()
+		return nil
+	}
+	lc.closed = true
+	lc.mu.Unlock()
+	lc.stopBackground()
+	service.timers.stop()
+	service.dimmer.stop()
+
+	drained := make(chan struct{})
+	go func() {
+		lc.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("wait for in-flight bridge calls: %w", ctx.Err())
+	}
+}
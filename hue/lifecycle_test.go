@@ -0,0 +1,55 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCloseWaitsForInFlightCalls(t *testing.T) {
+	t.Parallel()
+
+	service := &Service{lifecycle: newLifecycle()}
+	done, err := service.lifecycle.begin()
+	if err != nil {
+		t.Fatalf("begin() error = %v, want nil", err)
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- service.Close(context.Background())
+	}()
+
+	select {
+	case err := <-closed:
+		t.Fatalf("Close() returned %v before in-flight call finished", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	done()
+	if err := <-closed; err != nil {
+		t.Fatalf("Close() error = %v, want nil", err)
+	}
+	if service.lifecycle.background.Err() == nil {
+		t.Fatalf("background context not cancelled after Close()")
+	}
+	if _, err := service.lifecycle.begin(); !errors.Is(err, errServiceClosed) {
+		t.Fatalf("begin() after Close() error = %v, want %v", err, errServiceClosed)
+	}
+}
+
+func TestCloseTimesOut(t *testing.T) {
+	t.Parallel()
+
+	service := &Service{lifecycle: newLifecycle()}
+	if _, err := service.lifecycle.begin(); err != nil {
+		t.Fatalf("begin() error = %v, want nil", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := service.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Close() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
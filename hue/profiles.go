@@ -0,0 +1,120 @@
+package hue
+
+import (
+	"math"
+	"time"
+
+	"hueshelly/config"
+
+	"github.com/openhue/openhue-go"
+)
+
+// Colour temperatures Hue lights accept, in mirek.
+const (
+	minMirek = 153
+	maxMirek = 500
+)
+
+// onProfiles pick the brightness and colour temperature that toggles switch a
+// room or light on with, by time of day. A nil onProfiles configures nothing.
+type onProfiles struct {
+	profiles    config.OnProfiles
+	coordinates *config.Coordinates
+	location    *time.Location
+	now         func() time.Time
+}
+
+func newOnProfiles(cfg config.Config) *onProfiles {
+	if len(cfg.OnProfiles.Profiles) == 0 {
+		return nil
+	}
+	location, err := cfg.Location()
+	if err != nil {
+		location = time.Local
+	}
+	return &onProfiles{profiles: cfg.OnProfiles, coordinates: cfg.Coordinates, location: location, now: time.Now}
+}
+
+// period returns the period of the target's profile that applies now.
+func (profiles *onProfiles) period(targetType, target string) (config.ProfilePeriod, bool) {
+	if profiles == nil {
+		return config.ProfilePeriod{}, false
+	}
+
+	var name string
+	switch targetType {
+	case "light":
+		name = profiles.profiles.Lights[target]
+	case "room":
+		name = profiles.profiles.Rooms[target]
+	}
+	if name == "" {
+		name = profiles.profiles.Default
+	}
+	periods := profiles.profiles.Profiles[name]
+	if len(periods) == 0 {
+		return config.ProfilePeriod{}, false
+	}
+
+	now := profiles.now().In(profiles.location)
+	// Before the first period of today starts, the last one of yesterday still applies.
+	for _, date := range []time.Time{now, now.AddDate(0, 0, -1)} {
+		var current config.ProfilePeriod
+		var currentStart time.Time
+		found := false
+		for _, period := range periods {
+			start, ok, err := period.Start(date, profiles.coordinates)
+			if err != nil || !ok || start.After(now) {
+				continue
+			}
+			if !found || start.After(currentStart) {
+				current, currentStart, found = period, start, true
+			}
+		}
+		if found {
+			return current, true
+		}
+	}
+	return config.ProfilePeriod{}, false
+}
+
+// onSettings is what a toggle sends when it switches a target on.
+type onSettings struct {
+	// brightness is nil when the previous brightness is restored.
+	brightness *openhue.Brightness
+	// colorTemperature in Kelvin, or nil to leave the colour unchanged.
+	colorTemperature *int
+}
+
+// onSettings returns what switching a target on sends: the daylight level or
+// the brightness of the active profile period, full brightness, or nil when
+// the previous brightness is restored, plus the period's colour temperature.
+func (service *Service) onSettings(targetType, target string) onSettings {
+	var settings onSettings
+	period, hasPeriod := service.onProfiles.period(targetType, target)
+	if hasPeriod && period.ColorTemperature != 0 {
+		kelvin := period.ColorTemperature
+		settings.colorTemperature = &kelvin
+	}
+
+	if level, ok := service.daylight.level(targetType, target); ok {
+		brightness := openhue.Brightness(level)
+		settings.brightness = &brightness
+	} else if hasPeriod && period.Brightness != nil {
+		brightness := openhue.Brightness(*period.Brightness)
+		settings.brightness = &brightness
+	} else if service.restoreMode(targetType, target) == config.RestoreFull {
+		brightness := openhue.Brightness(100)
+		settings.brightness = &brightness
+	}
+	return settings
+}
+
+// colorTemperature converts Kelvin to the mirek the bridge expects.
+func colorTemperature(kelvin *int) *openhue.ColorTemperature {
+	if kelvin == nil || *kelvin <= 0 {
+		return nil
+	}
+	mirek := openhue.Mirek(min(max(int(math.Round(1e6/float64(*kelvin))), minMirek), maxMirek))
+	return &openhue.ColorTemperature{Mirek: &mirek}
+}
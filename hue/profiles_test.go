@@ -0,0 +1,111 @@
+package hue
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"hueshelly/config"
+)
+
+func TestOnProfilePeriod(t *testing.T) {
+	t.Parallel()
+
+	day, evening, night := 100.0, 60.0, 10.0
+	profiles := &onProfiles{
+		profiles: config.OnProfiles{
+			Profiles: map[string][]config.ProfilePeriod{"home": {
+				{From: "06:00", Brightness: &day, ColorTemperature: 4000},
+				{From: "20:00", Brightness: &evening, ColorTemperature: 2700},
+				{From: "23:00", Brightness: &night, ColorTemperature: 2200},
+			}},
+			Rooms: map[string]string{"Kitchen": "home"},
+		},
+		location: time.UTC,
+	}
+
+	tests := []struct {
+		name   string
+		now    time.Time
+		target string
+		want   int
+		wantOK bool
+	}{
+		{name: "day", now: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), target: "Kitchen", want: 4000, wantOK: true},
+		{name: "evening starts on the minute", now: time.Date(2026, 3, 1, 20, 0, 0, 0, time.UTC), target: "Kitchen", want: 2700, wantOK: true},
+		{name: "night before midnight", now: time.Date(2026, 3, 1, 23, 30, 0, 0, time.UTC), target: "Kitchen", want: 2200, wantOK: true},
+		{name: "night after midnight", now: time.Date(2026, 3, 2, 3, 0, 0, 0, time.UTC), target: "Kitchen", want: 2200, wantOK: true},
+		{name: "room without profile", now: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), target: "Hallway"},
+	}
+	for _, tt := range tests {
+		profiles := *profiles
+		profiles.now = func() time.Time { return tt.now }
+		period, ok := profiles.period("room", tt.target)
+		if ok != tt.wantOK || period.ColorTemperature != tt.want {
+			t.Fatalf("%s: period() = %+v, %v, want colour temperature %d, %v", tt.name, period, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestToggleUsesOnProfile(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-1", 3, "Desk", false)
+	fake.addLight("light-2", 4, "Plug", false)
+	fake.addRoom("room-1", "Kitchen", "grouped-1", false, "light-1")
+	fake.addRoom("room-2", "Hall", "grouped-2", false, "light-2")
+	desk := fake.lights["light-1"]
+	if err := json.Unmarshal([]byte(`{"mirek": 250}`), &desk.ColorTemperature); err != nil {
+		t.Fatalf("decode colour temperature: %v", err)
+	}
+	fake.lights["light-1"] = desk
+
+	evening := 60.0
+	service := newTestService(fake)
+	service.restorePreviousLightState = true
+	service.onProfiles = &onProfiles{
+		profiles: config.OnProfiles{
+			Profiles: map[string][]config.ProfilePeriod{"evening": {{From: "00:00", Brightness: &evening, ColorTemperature: 2700}}},
+			Default:  "evening",
+		},
+		location: time.UTC,
+		now:      time.Now,
+	}
+
+	for _, toggle := range []func() (State, error){
+		func() (State, error) { return service.ToggleLight(context.Background(), 3) },
+		func() (State, error) { return service.ToggleLightsInRoom(context.Background(), "Kitchen") },
+	} {
+		state, err := toggle()
+		if err != nil {
+			t.Fatalf("toggle error = %v, want nil", err)
+		}
+		if !equalBrightness(state.Brightness, &evening) || state.ColorTemperature == nil || *state.ColorTemperature != 2700 {
+			t.Fatalf("%s state = %+v, want on at 60%% and 2700K", state.TargetType, state)
+		}
+	}
+	if mirek := fake.lightUpdates[0].body.ColorTemperature.Mirek; *mirek != 370 {
+		t.Fatalf("light mirek = %d, want 370", *mirek)
+	}
+	if mirek := fake.groupedLightUpdates[0].body.ColorTemperature.Mirek; *mirek != 370 {
+		t.Fatalf("grouped light mirek = %d, want 370", *mirek)
+	}
+
+	state, err := service.SetLightState(context.Background(), 4, StateChange{Toggle: true})
+	if err != nil {
+		t.Fatalf("SetLightState() error = %v, want nil", err)
+	}
+	if state.ColorTemperature != nil || fake.lightUpdates[1].body.ColorTemperature != nil {
+		t.Fatalf("SetLightState() = %+v, want no colour temperature for a light without support", state)
+	}
+
+	state, err = service.ToggleLightsInRoom(context.Background(), "Hall")
+	if err != nil {
+		t.Fatalf("ToggleLightsInRoom() error = %v, want nil", err)
+	}
+	if state.ColorTemperature != nil || fake.groupedLightUpdates[1].body.ColorTemperature != nil {
+		t.Fatalf("ToggleLightsInRoom() = %+v, want no colour temperature for a room without support", state)
+	}
+}
@@ -0,0 +1,385 @@
+package hue
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"hueshelly/metrics"
+)
+
+// ErrQueueFull is returned when the bridge command queue cannot accept more commands. It matches ErrRateLimited.
+var ErrQueueFull = errorf(ErrRateLimited, "bridge command queue is full")
+
+type commandKind string
+
+const (
+	lightCommand commandKind = "light"
+	groupCommand commandKind = "group"
+)
+
+// commandQueue paces state changes to the bridge. The bridge recommends roughly
+// 10 light commands and 1 group command per second, so each kind has its own
+// lane with its own token bucket. Commands for a target that is still waiting
+// in a lane are replaced by the newer command instead of being queued twice.
+// Transient failures go back into their lane after a backoff, so a retry takes
+// a token like any other command and does not hold up other targets.
+type commandQueue struct {
+	mu       sync.Mutex
+	capacity int
+	size     int
+	lanes    map[commandKind]*commandLane
+	retry    retryPolicy
+	now      func() time.Time
+}
+
+type commandLane struct {
+	kind     commandKind
+	bucket   *tokenBucket
+	pending  []*queuedCommand
+	byTarget map[string]*queuedCommand
+	ready    chan struct{}
+}
+
+type queuedCommand struct {
+	target    string
+	operation string
+	// send makes a single attempt; the queue retries it unless mode is sendOnce.
+	send func(ctx context.Context) error
+	mode retryMode
+	// ctx is cancelled once every waiter gave up, so a caller that leaves early
+	// does not cancel the command for the callers coalesced into it.
+	ctx       context.Context
+	cancel    context.CancelFunc
+	waiters   []*commandWaiter
+	attempts  int
+	notBefore time.Time
+	enqueued  time.Time
+}
+
+// commandWaiter is a caller of submit waiting for the result of a command.
+type commandWaiter struct {
+	result  chan error
+	command *queuedCommand
+}
+
+func newCommandQueue(capacity int, lightsPerSecond, groupsPerSecond float64, retry retryPolicy) *commandQueue {
+	return &commandQueue{
+		capacity: capacity,
+		lanes: map[commandKind]*commandLane{
+			lightCommand: newCommandLane(lightCommand, lightsPerSecond),
+			groupCommand: newCommandLane(groupCommand, groupsPerSecond),
+		},
+		retry: retry,
+		now:   time.Now,
+	}
+}
+
+func newCommandLane(kind commandKind, perSecond float64) *commandLane {
+	return &commandLane{
+		kind:     kind,
+		bucket:   newTokenBucket(perSecond, math.Max(1, math.Ceil(perSecond))),
+		byTarget: map[string]*queuedCommand{},
+		ready:    make(chan struct{}, 1),
+	}
+}
+
+// start runs one worker per lane until ctx is cancelled.
+func (queue *commandQueue) start(ctx context.Context) {
+	for _, lane := range queue.lanes {
+		go queue.run(ctx, lane)
+	}
+}
+
+// submit queues send for target and waits until it was executed or ctx is done.
+// send makes one attempt of operation; transient failures are retried by the
+// queue as mode allows.
+func (queue *commandQueue) submit(ctx context.Context, kind commandKind, target, operation string, mode retryMode, send func(ctx context.Context) error) error {
+	lane := queue.lanes[kind]
+	waiter := &commandWaiter{result: make(chan error, 1)}
+
+	queue.mu.Lock()
+	if command, exists := lane.byTarget[target]; exists {
+		command.operation = operation
+		command.send = send
+		command.mode = mode
+		command.attempts = 0
+		waiter.command = command
+		command.waiters = append(command.waiters, waiter)
+		queue.mu.Unlock()
+		metrics.BridgeCommandsCoalesced.Inc(string(kind))
+	} else {
+		if queue.size >= queue.capacity {
+			queue.mu.Unlock()
+			metrics.BridgeCommandsRejected.Inc(string(kind))
+			return ErrQueueFull
+		}
+		commandCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		command := &queuedCommand{
+			target:    target,
+			operation: operation,
+			send:      send,
+			mode:      mode,
+			ctx:       commandCtx,
+			cancel:    cancel,
+			waiters:   []*commandWaiter{waiter},
+			enqueued:  queue.now(),
+		}
+		waiter.command = command
+		queue.pushLocked(lane, command)
+		queue.mu.Unlock()
+	}
+	lane.wake()
+
+	select {
+	case err := <-waiter.result:
+		return err
+	case <-ctx.Done():
+		queue.leave(lane, waiter)
+		return ctx.Err()
+	}
+}
+
+// leave removes a waiter that gave up. A command nobody waits for anymore is
+// dropped from its lane, or cancelled if it is being sent.
+func (queue *commandQueue) leave(lane *commandLane, waiter *commandWaiter) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+
+	command := waiter.command
+	command.waiters = slices.DeleteFunc(command.waiters, func(other *commandWaiter) bool { return other == waiter })
+	if len(command.waiters) > 0 {
+		return
+	}
+	command.cancel()
+	if lane.byTarget[command.target] == command {
+		queue.removeLocked(lane, command)
+	}
+}
+
+func (queue *commandQueue) run(ctx context.Context, lane *commandLane) {
+	for {
+		if !queue.waitReady(ctx, lane) {
+			queue.failPending(lane, errServiceClosed)
+			return
+		}
+		if err := sleepContext(ctx, lane.bucket.reserve()); err != nil {
+			queue.failPending(lane, errServiceClosed)
+			return
+		}
+		command := queue.popReady(lane)
+		if command == nil {
+			continue
+		}
+		if command.attempts == 0 {
+			metrics.BridgeQueueWait.Observe(queue.now().Sub(command.enqueued).Seconds(), string(lane.kind))
+		}
+		queue.send(ctx, lane, command)
+	}
+}
+
+// waitReady blocks until a pending command is due. It returns false once ctx is done.
+func (queue *commandQueue) waitReady(ctx context.Context, lane *commandLane) bool {
+	for {
+		delay, pending := queue.untilReady(lane)
+		if pending && delay <= 0 {
+			return true
+		}
+		var timer *time.Timer
+		var due <-chan time.Time
+		if pending {
+			timer = time.NewTimer(delay)
+			due = timer.C
+		}
+		select {
+		case <-lane.ready:
+		case <-due:
+		case <-ctx.Done():
+			return false
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// untilReady returns how long until the next pending command is due, and false
+// if nothing is pending.
+func (queue *commandQueue) untilReady(lane *commandLane) (time.Duration, bool) {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	if len(lane.pending) == 0 {
+		return 0, false
+	}
+	now := queue.now()
+	delay := time.Duration(math.MaxInt64)
+	for _, command := range lane.pending {
+		delay = min(delay, command.notBefore.Sub(now))
+	}
+	return delay, true
+}
+
+// send runs one attempt of command and either answers its waiters or puts it
+// back into the lane for a retry.
+func (queue *commandQueue) send(ctx context.Context, lane *commandLane, command *queuedCommand) {
+	stop := context.AfterFunc(ctx, command.cancel)
+	err := command.send(command.ctx)
+	stop()
+	command.attempts++
+
+	if err != nil && ctx.Err() != nil {
+		err = errServiceClosed
+	}
+	if err != nil && queue.retryLater(lane, command, err) {
+		return
+	}
+	if err != nil {
+		err = bridgeFailure(command.ctx, command.operation, command.attempts, err)
+	}
+
+	queue.mu.Lock()
+	waiters := command.waiters
+	command.waiters = nil
+	queue.mu.Unlock()
+	command.cancel()
+	for _, waiter := range waiters {
+		waiter.result <- err
+	}
+}
+
+// retryLater puts a command that failed transiently back into its lane once its
+// backoff has passed. A newer command queued for the same target meanwhile
+// replaces the retry, and its result answers the waiters of both.
+func (queue *commandQueue) retryLater(lane *commandLane, command *queuedCommand, err error) bool {
+	if command.mode == sendOnce || command.attempts >= max(queue.retry.maxAttempts, 1) || !isTransient(err) || command.ctx.Err() != nil {
+		return false
+	}
+	delay := queue.retry.backoff(command.attempts)
+
+	queue.mu.Lock()
+	if newer, exists := lane.byTarget[command.target]; exists {
+		for _, waiter := range command.waiters {
+			waiter.command = newer
+		}
+		newer.waiters = append(newer.waiters, command.waiters...)
+		command.waiters = nil
+		queue.mu.Unlock()
+		command.cancel()
+		return true
+	}
+	command.notBefore = queue.now().Add(delay)
+	queue.pushLocked(lane, command)
+	queue.mu.Unlock()
+
+	logRetry(command.operation, err, delay)
+	lane.wake()
+	return true
+}
+
+func (queue *commandQueue) pushLocked(lane *commandLane, command *queuedCommand) {
+	lane.pending = append(lane.pending, command)
+	lane.byTarget[command.target] = command
+	queue.size++
+}
+
+func (queue *commandQueue) removeLocked(lane *commandLane, command *queuedCommand) {
+	lane.pending = slices.DeleteFunc(lane.pending, func(other *queuedCommand) bool { return other == command })
+	delete(lane.byTarget, command.target)
+	queue.size--
+}
+
+// popReady takes the first command that is due, or returns nil.
+func (queue *commandQueue) popReady(lane *commandLane) *queuedCommand {
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	now := queue.now()
+	for _, command := range lane.pending {
+		if !command.notBefore.After(now) {
+			queue.removeLocked(lane, command)
+			return command
+		}
+	}
+	return nil
+}
+
+func (queue *commandQueue) failPending(lane *commandLane, err error) {
+	queue.mu.Lock()
+	pending := slices.Clone(lane.pending)
+	var waiters []*commandWaiter
+	for _, command := range pending {
+		waiters = append(waiters, command.waiters...)
+		command.waiters = nil
+		queue.removeLocked(lane, command)
+	}
+	queue.mu.Unlock()
+
+	for _, command := range pending {
+		command.cancel()
+	}
+	for _, waiter := range waiters {
+		waiter.result <- err
+	}
+}
+
+func (lane *commandLane) wake() {
+	select {
+	case lane.ready <- struct{}{}:
+	default:
+	}
+}
+
+// tokenBucket hands out reservations at a fixed rate with a limited burst.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newTokenBucket(perSecond, burst float64) *tokenBucket {
+	return &tokenBucket{
+		rate:   perSecond,
+		burst:  burst,
+		tokens: burst,
+		now:    time.Now,
+	}
+}
+
+// reserve takes one token and returns how long the caller must wait before using it.
+func (bucket *tokenBucket) reserve() time.Duration {
+	if bucket.rate <= 0 {
+		return 0
+	}
+
+	bucket.mu.Lock()
+	defer bucket.mu.Unlock()
+
+	now := bucket.now()
+	if !bucket.last.IsZero() {
+		bucket.tokens = math.Min(bucket.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.rate)
+	}
+	bucket.last = now
+	bucket.tokens--
+	if bucket.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-bucket.tokens / bucket.rate * float64(time.Second))
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
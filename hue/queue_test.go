@@ -0,0 +1,270 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketReserve(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	bucket := newTokenBucket(2, 2)
+	bucket.now = func() time.Time { return now }
+
+	if delay := bucket.reserve(); delay != 0 {
+		t.Fatalf("first reserve() = %v, want 0", delay)
+	}
+	if delay := bucket.reserve(); delay != 0 {
+		t.Fatalf("second reserve() = %v, want 0 within burst", delay)
+	}
+	if delay := bucket.reserve(); delay != 500*time.Millisecond {
+		t.Fatalf("third reserve() = %v, want %v", delay, 500*time.Millisecond)
+	}
+
+	now = now.Add(2 * time.Second)
+	if delay := bucket.reserve(); delay != 0 {
+		t.Fatalf("reserve() after refill = %v, want 0", delay)
+	}
+}
+
+func TestCommandQueueCoalescesPendingCommands(t *testing.T) {
+	t.Parallel()
+
+	queue := newCommandQueue(10, 0, 0, retryPolicy{})
+	lane := queue.lanes[groupCommand]
+
+	var mu sync.Mutex
+	var sent []string
+	send := func(value string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			sent = append(sent, value)
+			return nil
+		}
+	}
+
+	results := make(chan error, 2)
+	go func() {
+		results <- queue.submit(context.Background(), groupCommand, "room", "test", retryTransient, send("first"))
+	}()
+	waitForPending(t, queue, lane, 1)
+	go func() {
+		results <- queue.submit(context.Background(), groupCommand, "room", "test", retryTransient, send("second"))
+	}()
+	waitForWaiters(t, queue, lane, "room", 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queue.start(ctx)
+
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Fatalf("submit() error = %v, want nil", err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sent) != 1 || sent[0] != "second" {
+		t.Fatalf("sent = %v, want only the latest command", sent)
+	}
+}
+
+func TestCommandQueueRejectsWhenFull(t *testing.T) {
+	t.Parallel()
+
+	queue := newCommandQueue(1, 0, 0, retryPolicy{})
+	noop := func(ctx context.Context) error { return nil }
+
+	go func() { _ = queue.submit(context.Background(), lightCommand, "a", "test", retryTransient, noop) }()
+	waitForPending(t, queue, queue.lanes[lightCommand], 1)
+
+	if err := queue.submit(context.Background(), lightCommand, "b", "test", retryTransient, noop); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("submit() error = %v, want %v", err, ErrQueueFull)
+	}
+}
+
+func TestCommandQueueFailsPendingOnShutdown(t *testing.T) {
+	t.Parallel()
+
+	queue := newCommandQueue(10, 0, 0, retryPolicy{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- queue.submit(context.Background(), lightCommand, "a", "test", retryTransient, func(ctx context.Context) error { return nil })
+	}()
+	waitForPending(t, queue, queue.lanes[lightCommand], 1)
+	queue.start(ctx)
+
+	if err := <-result; !errors.Is(err, errServiceClosed) {
+		t.Fatalf("submit() error = %v, want %v", err, errServiceClosed)
+	}
+}
+
+func TestCommandQueueKeepsCommandForRemainingWaiters(t *testing.T) {
+	t.Parallel()
+
+	queue := newCommandQueue(10, 0, 0, retryPolicy{})
+	lane := queue.lanes[groupCommand]
+	sendErr := make(chan error, 1)
+	send := func(ctx context.Context) error {
+		sendErr <- ctx.Err()
+		return nil
+	}
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() { first <- queue.submit(firstCtx, groupCommand, "room", "test", retryTransient, send) }()
+	waitForPending(t, queue, lane, 1)
+	second := make(chan error, 1)
+	go func() {
+		second <- queue.submit(context.Background(), groupCommand, "room", "test", retryTransient, send)
+	}()
+	waitForWaiters(t, queue, lane, "room", 2)
+
+	cancelFirst()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("first submit() error = %v, want %v", err, context.Canceled)
+	}
+	waitForWaiters(t, queue, lane, "room", 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queue.start(ctx)
+
+	if err := <-second; err != nil {
+		t.Fatalf("second submit() error = %v, want nil", err)
+	}
+	if err := <-sendErr; err != nil {
+		t.Fatalf("command context error = %v, want a live context for the remaining waiter", err)
+	}
+}
+
+func TestCommandQueueDropsCommandWithoutWaiters(t *testing.T) {
+	t.Parallel()
+
+	queue := newCommandQueue(10, 0, 0, retryPolicy{})
+	lane := queue.lanes[lightCommand]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error, 1)
+	go func() {
+		result <- queue.submit(ctx, lightCommand, "a", "test", retryTransient, func(ctx context.Context) error {
+			t.Error("command without waiters was sent")
+			return nil
+		})
+	}()
+	waitForPending(t, queue, lane, 1)
+	cancel()
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Fatalf("submit() error = %v, want %v", err, context.Canceled)
+	}
+	waitForPending(t, queue, lane, 0)
+}
+
+func TestCommandQueueRetriesThroughLane(t *testing.T) {
+	t.Parallel()
+
+	queue := newCommandQueue(10, 0, 0, retryPolicy{maxAttempts: 2, initialBackoff: time.Hour, maxBackoff: time.Hour})
+	lane := queue.lanes[lightCommand]
+	var mu sync.Mutex
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	queue.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	var attempts int
+	flaky := func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			return fmt.Errorf("update: %w", syscall.ECONNRESET)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queue.start(ctx)
+
+	flakyResult := make(chan error, 1)
+	go func() {
+		flakyResult <- queue.submit(context.Background(), lightCommand, "a", "test", retryTransient, flaky)
+	}()
+	waitForAttempts := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			mu.Lock()
+			got := attempts
+			mu.Unlock()
+			if got == want {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatalf("attempts did not reach %d", want)
+	}
+	waitForAttempts(1)
+	waitForPending(t, queue, lane, 1)
+
+	// The retry waits for its backoff in the lane, not in the worker.
+	if err := queue.submit(context.Background(), lightCommand, "b", "test", retryTransient, func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("submit() of another target error = %v, want nil", err)
+	}
+
+	mu.Lock()
+	now = now.Add(time.Hour)
+	mu.Unlock()
+	lane.wake()
+
+	if err := <-flakyResult; err != nil {
+		t.Fatalf("submit() error = %v, want nil after retry", err)
+	}
+	waitForAttempts(2)
+}
+
+func waitForPending(t *testing.T, queue *commandQueue, lane *commandLane, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		queue.mu.Lock()
+		got := len(lane.pending)
+		queue.mu.Unlock()
+		if got == want {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("pending commands did not reach %d", want)
+}
+
+func waitForWaiters(t *testing.T, queue *commandQueue, lane *commandLane, target string, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		queue.mu.Lock()
+		command := lane.byTarget[target]
+		got := 0
+		if command != nil {
+			got = len(command.waiters)
+		}
+		queue.mu.Unlock()
+		if got == want {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("waiters for %q did not reach %d", target, want)
+}
@@ -0,0 +1,747 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"hueshelly/config"
+
+	"github.com/openhue/openhue-go"
+)
+
+// Room is a room or zone together with the state of its grouped light.
+type Room struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	On         bool     `json:"on"`
+	Brightness *float64 `json:"brightness,omitempty"`
+	Lights     []Light  `json:"lights"`
+}
+
+// LightDetails is a light together with its current state.
+type LightDetails struct {
+	ID         int      `json:"id"`
+	Name       string   `json:"name"`
+	On         bool     `json:"on"`
+	Brightness *float64 `json:"brightness,omitempty"`
+	// ColorTemperature in Kelvin, for lights with a white spectrum.
+	ColorTemperature *int `json:"colorTemperature,omitempty"`
+	// Color for colour lights.
+	Color *XY `json:"color,omitempty"`
+	// Effects lists the effects the light can play, such as candle.
+	Effects []string `json:"effects,omitempty"`
+}
+
+// XY is a colour as a CIE 1931 xy chromaticity.
+type XY struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// Scene is a scene and the room or zone it belongs to.
+type Scene struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	GroupType string `json:"groupType"`
+	GroupID   string `json:"groupId"`
+	GroupName string `json:"groupName"`
+	Active    bool   `json:"active"`
+}
+
+// StateChange is a requested state. Nil fields are left unchanged.
+type StateChange struct {
+	On *bool `json:"on,omitempty"`
+	// Toggle switches off when on and on otherwise. It cannot be combined with On.
+	Toggle bool `json:"toggle,omitempty"`
+	// Brightness in percent.
+	Brightness *float64 `json:"brightness,omitempty"`
+	// ColorTemperature in Kelvin.
+	ColorTemperature *int `json:"colorTemperature,omitempty"`
+	// Color cannot be combined with ColorTemperature.
+	Color *XY `json:"color,omitempty"`
+	// Transition overrides the configured transition time, e.g. "2s".
+	Transition *config.Duration `json:"transition,omitempty"`
+
+	// switchOn marks a toggle resolved to on without a brightness or colour
+	// from the caller; the on settings it carries yield to a snapshot.
+	switchOn bool
+}
+
+func (change StateChange) validate() error {
+	if change.On == nil && change.Brightness == nil && change.ColorTemperature == nil && change.Color == nil && !change.Toggle {
+		return errorf(ErrInvalidParameter, "state must set on, toggle, brightness, colorTemperature or color")
+	}
+	if change.On != nil && change.Toggle {
+		return errorf(ErrInvalidParameter, "state must not set both on and toggle")
+	}
+	if change.Brightness != nil && (*change.Brightness < 0 || *change.Brightness > 100) {
+		return errorf(ErrInvalidParameter, "brightness must be between 0 and 100, got %v", *change.Brightness)
+	}
+	if change.ColorTemperature != nil && (*change.ColorTemperature < config.MinColorTemperature || *change.ColorTemperature > config.MaxColorTemperature) {
+		return errorf(ErrInvalidParameter, "colorTemperature must be between %d and %d, got %d", config.MinColorTemperature, config.MaxColorTemperature, *change.ColorTemperature)
+	}
+	if change.Color != nil {
+		if change.ColorTemperature != nil {
+			return errorf(ErrInvalidParameter, "state must not set both colorTemperature and color")
+		}
+		if change.Color.X < 0 || change.Color.X > 1 || change.Color.Y < 0 || change.Color.Y > 1 {
+			return errorf(ErrInvalidParameter, "color x and y must be between 0 and 1, got %v, %v", change.Color.X, change.Color.Y)
+		}
+	}
+	if change.Transition != nil {
+		if err := config.ValidateTransition(change.Transition.Duration()); err != nil {
+			return errorf(ErrInvalidParameter, "%v", err)
+		}
+	}
+	return nil
+}
+
+// switches reports whether the change switches the target on or off.
+func (change StateChange) switches() bool {
+	return change.On != nil || change.Toggle
+}
+
+// restoresSnapshot reports whether change switches on without asking for a
+// brightness or colour, so the snapshot restore mode applies.
+func (change StateChange) restoresSnapshot() bool {
+	if change.On == nil || !*change.On {
+		return false
+	}
+	return change.switchOn || !change.explicit()
+}
+
+// explicit reports whether change asks for a brightness or colour.
+func (change StateChange) explicit() bool {
+	return change.Brightness != nil || change.ColorTemperature != nil || change.Color != nil
+}
+
+// switchesOff reports whether change switches the target off.
+func (change StateChange) switchesOff() bool {
+	return change.On != nil && !*change.On
+}
+
+func (change StateChange) transition() *time.Duration {
+	if change.Transition == nil {
+		return nil
+	}
+	transition := change.Transition.Duration()
+	return &transition
+}
+
+// resolveToggle turns a toggle into an explicit on or off based on the current
+// state. Like the toggle routes, switching on uses the target's onSettings
+// unless a brightness or colour temperature is given.
+func (service *Service) resolveToggle(change StateChange, on bool, targetType, target string) StateChange {
+	if !change.Toggle {
+		return change
+	}
+	switchOn := !on
+	change.On = &switchOn
+	change.Toggle = false
+	if !switchOn {
+		return change
+	}
+	change.switchOn = !change.explicit()
+	settings := service.onSettings(targetType, target)
+	if change.Brightness == nil && settings.brightness != nil {
+		level := float64(*settings.brightness)
+		change.Brightness = &level
+	}
+	if change.ColorTemperature == nil && change.Color == nil {
+		change.ColorTemperature = settings.colorTemperature
+	}
+	return change
+}
+
+func (change StateChange) dimming() *openhue.Dimming {
+	if change.Brightness == nil {
+		return nil
+	}
+	brightness := openhue.Brightness(*change.Brightness)
+	return &openhue.Dimming{Brightness: &brightness}
+}
+
+func (change StateChange) color() *openhue.Color {
+	if change.Color == nil {
+		return nil
+	}
+	x, y := float32(change.Color.X), float32(change.Color.Y)
+	return &openhue.Color{Xy: &openhue.GamutPosition{X: &x, Y: &y}}
+}
+
+// Rooms returns all rooms sorted by name.
+func (service *Service) Rooms(ctx context.Context) ([]Room, error) {
+	return service.listGroups(ctx, "room", service.getRooms)
+}
+
+// Room returns the room with the given bridge resource id.
+func (service *Service) Room(ctx context.Context, id string) (Room, error) {
+	return service.groupByID(ctx, "room", id, service.getRooms)
+}
+
+// RoomState returns the current state of the only room named name.
+func (service *Service) RoomState(ctx context.Context, name string) (State, error) {
+	id, err := service.RoomID(ctx, name)
+	if err != nil {
+		return State{}, err
+	}
+	room, err := service.Room(ctx, id)
+	if err != nil {
+		return State{}, err
+	}
+	return State{TargetType: "room", Target: name, On: room.On, Brightness: room.Brightness}, nil
+}
+
+// SetRoomState applies change to the grouped light of a room. Switching the
+// room on or off drops its auto-off timer.
+func (service *Service) SetRoomState(ctx context.Context, id string, change StateChange) (State, error) {
+	state, name, err := service.setGroupState(ctx, "room", id, change, service.getRooms)
+	if err != nil {
+		return State{}, err
+	}
+	if change.switches() {
+		service.timers.cancel("room", name)
+	}
+	return state, nil
+}
+
+// setRoomState is SetRoomState for the timers themselves, which keeps the timer.
+func (service *Service) setRoomState(ctx context.Context, id string, change StateChange) (State, error) {
+	state, _, err := service.setGroupState(ctx, "room", id, change, service.getRooms)
+	return state, err
+}
+
+// RoomID returns the bridge resource id of the only room named name.
+func (service *Service) RoomID(ctx context.Context, name string) (string, error) {
+	return service.groupIDByName(ctx, "room", name, service.getRooms)
+}
+
+// Zones returns all zones sorted by name.
+func (service *Service) Zones(ctx context.Context) ([]Room, error) {
+	return service.listGroups(ctx, "zone", service.getZones)
+}
+
+// Zone returns the zone with the given bridge resource id.
+func (service *Service) Zone(ctx context.Context, id string) (Room, error) {
+	return service.groupByID(ctx, "zone", id, service.getZones)
+}
+
+// SetZoneState applies change to the grouped light of a zone.
+func (service *Service) SetZoneState(ctx context.Context, id string, change StateChange) (State, error) {
+	state, _, err := service.setGroupState(ctx, "zone", id, change, service.getZones)
+	return state, err
+}
+
+// ZoneID returns the bridge resource id of the only zone named name.
+func (service *Service) ZoneID(ctx context.Context, name string) (string, error) {
+	return service.groupIDByName(ctx, "zone", name, service.getZones)
+}
+
+// Lights returns all lights sorted by name.
+func (service *Service) Lights(ctx context.Context) ([]LightDetails, error) {
+	if err := service.ensureInitialized(); err != nil {
+		return nil, err
+	}
+
+	lights, err := service.getLights(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get lights: %w", err)
+	}
+
+	lightList := make([]LightDetails, 0, len(lights))
+	for _, light := range lights {
+		details, err := lightDetails(light)
+		if err != nil {
+			continue
+		}
+		lightList = append(lightList, details)
+	}
+	sort.Slice(lightList, func(i, j int) bool {
+		if lightList[i].Name == lightList[j].Name {
+			return lightList[i].ID < lightList[j].ID
+		}
+		return lightList[i].Name < lightList[j].Name
+	})
+	return lightList, nil
+}
+
+// Light returns the light with the given id.
+func (service *Service) Light(ctx context.Context, lightID int) (LightDetails, error) {
+	if err := service.ensureInitialized(); err != nil {
+		return LightDetails{}, err
+	}
+
+	light, err := service.findLightByID(ctx, lightID)
+	if err != nil {
+		return LightDetails{}, err
+	}
+	return lightDetails(*light)
+}
+
+// LightState returns the current state of the light with the given id.
+func (service *Service) LightState(ctx context.Context, lightID int) (State, error) {
+	light, err := service.Light(ctx, lightID)
+	if err != nil {
+		return State{}, err
+	}
+	return State{TargetType: "light", Target: strconv.Itoa(lightID), On: light.On, Brightness: light.Brightness}, nil
+}
+
+// SetLightState applies change to a light. Switching it on or off drops its
+// auto-off timer.
+func (service *Service) SetLightState(ctx context.Context, lightID int, change StateChange) (State, error) {
+	state, err := service.setLightState(ctx, lightID, change)
+	if err != nil {
+		return State{}, err
+	}
+	if change.switches() {
+		service.timers.cancel("light", strconv.Itoa(lightID))
+	}
+	return state, nil
+}
+
+// setLightState is SetLightState for the timers themselves, which keeps the timer.
+func (service *Service) setLightState(ctx context.Context, lightID int, change StateChange) (State, error) {
+	if err := service.ensureInitialized(); err != nil {
+		return State{}, err
+	}
+	if err := change.validate(); err != nil {
+		return State{}, err
+	}
+
+	light, err := service.findLightByID(ctx, lightID)
+	if err != nil {
+		return State{}, err
+	}
+	if light.Id == nil {
+		return State{}, errors.New("light has no id")
+	}
+
+	if change.ColorTemperature != nil && light.ColorTemperature == nil {
+		return State{}, errorf(ErrInvalidParameter, "light %d does not support colour temperature", lightID)
+	}
+	if change.Color != nil && light.Color == nil {
+		return State{}, errorf(ErrInvalidParameter, "light %d does not support colour", lightID)
+	}
+
+	target := strconv.Itoa(lightID)
+	change = service.resolveToggle(change, light.IsOn(), "light", target)
+	if light.ColorTemperature == nil {
+		change.ColorTemperature = nil
+	}
+	dynamics := service.lightDynamics(target, change.transition())
+	if service.restoreMode("light", target) == config.RestoreSnapshot {
+		if change.switchesOff() && light.IsOn() {
+			service.snapshots.save("light", target, map[string]lightSnapshot{*light.Id: snapshotOf(*light)})
+		}
+		if change.restoresSnapshot() {
+			snapshot, err := service.restoreLight(ctx, target, *light.Id, dynamics)
+			if err != nil {
+				return State{}, err
+			}
+			if snapshot != nil {
+				return State{TargetType: "light", Target: target, On: true, Brightness: brightnessValue(snapshot.brightness)}, nil
+			}
+		} else if change.On != nil && *change.On {
+			// An explicit brightness or colour temperature makes the snapshot stale.
+			service.snapshots.drop("light", target)
+		}
+	}
+	body := openhue.LightPut{
+		Dimming:          change.dimming(),
+		ColorTemperature: colorTemperature(change.ColorTemperature),
+		Color:            change.color(),
+		Dynamics:         dynamics,
+	}
+	if change.On != nil {
+		body.On = &openhue.On{On: change.On}
+	}
+	if err := service.updateLight(ctx, *light.Id, body); err != nil {
+		return State{}, err
+	}
+
+	current, err := lightDetails(*light)
+	if err != nil {
+		return State{}, err
+	}
+	return resultingState("light", strconv.Itoa(current.ID), current.On, current.Brightness, change), nil
+}
+
+// Scenes returns all scenes sorted by group and name.
+func (service *Service) Scenes(ctx context.Context) ([]Scene, error) {
+	if err := service.ensureInitialized(); err != nil {
+		return nil, err
+	}
+
+	scenes, err := service.getScenes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get scenes: %w", err)
+	}
+	groupNames, err := service.groupNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sceneList := make([]Scene, 0, len(scenes))
+	for _, scene := range scenes {
+		sceneList = append(sceneList, newScene(scene, groupNames))
+	}
+	sort.Slice(sceneList, func(i, j int) bool {
+		if sceneList[i].GroupName == sceneList[j].GroupName {
+			return sceneList[i].Name < sceneList[j].Name
+		}
+		return sceneList[i].GroupName < sceneList[j].GroupName
+	})
+	return sceneList, nil
+}
+
+// Scene returns the scene with the given bridge resource id.
+func (service *Service) Scene(ctx context.Context, id string) (Scene, error) {
+	if err := service.ensureInitialized(); err != nil {
+		return Scene{}, err
+	}
+
+	scenes, err := service.getScenes(ctx)
+	if err != nil {
+		return Scene{}, fmt.Errorf("get scenes: %w", err)
+	}
+	scene, exists := scenes[id]
+	if !exists {
+		return Scene{}, errorf(ErrNotFound, "no scene with id %q found", id)
+	}
+	groupNames, err := service.groupNames(ctx)
+	if err != nil {
+		return Scene{}, err
+	}
+	return newScene(scene, groupNames), nil
+}
+
+// SceneID returns the id of the scene of a room or zone whose id or name is scene.
+func (service *Service) SceneID(ctx context.Context, groupID, scene string) (string, error) {
+	if err := service.ensureInitialized(); err != nil {
+		return "", err
+	}
+
+	scenes, err := service.getScenes(ctx)
+	if err != nil {
+		return "", fmt.Errorf("get scenes: %w", err)
+	}
+	if candidate, exists := scenes[scene]; exists && candidate.Group != nil && candidate.Group.Rid != nil && *candidate.Group.Rid == groupID {
+		return scene, nil
+	}
+
+	var found []string
+	for id, candidate := range scenes {
+		if candidate.Group == nil || candidate.Group.Rid == nil || *candidate.Group.Rid != groupID {
+			continue
+		}
+		if candidate.Metadata != nil && candidate.Metadata.Name != nil && *candidate.Metadata.Name == scene {
+			found = append(found, id)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", errorf(ErrNotFound, "no scene %q found for group %q", scene, groupID)
+	case 1:
+		return found[0], nil
+	default:
+		return "", errorf(ErrAmbiguous, "%d scenes of group %q are named %q", len(found), groupID, scene)
+	}
+}
+
+// RecallScene activates a scene. action is "active" (the default), "static" or "dynamic_palette".
+func (service *Service) RecallScene(ctx context.Context, id string, action string) (State, error) {
+	if err := service.ensureInitialized(); err != nil {
+		return State{}, err
+	}
+
+	recallAction := openhue.SceneRecallAction(action)
+	switch recallAction {
+	case "":
+		recallAction = openhue.SceneRecallActionActive
+	case openhue.SceneRecallActionActive, openhue.SceneRecallActionStatic, openhue.SceneRecallActionDynamicPalette:
+	default:
+		return State{}, errorf(ErrInvalidParameter, "unknown scene action %q", action)
+	}
+
+	scenes, err := service.getScenes(ctx)
+	if err != nil {
+		return State{}, fmt.Errorf("get scenes: %w", err)
+	}
+	if _, exists := scenes[id]; !exists {
+		return State{}, errorf(ErrNotFound, "no scene with id %q found", id)
+	}
+
+	if err := service.updateScene(ctx, id, openhue.ScenePut{Recall: &openhue.SceneRecall{Action: &recallAction}}); err != nil {
+		return State{}, err
+	}
+	return State{TargetType: "scene", Target: id, On: true}, nil
+}
+
+type groupLister func(ctx context.Context) (map[string]openhue.RoomGet, error)
+
+func (service *Service) listGroups(ctx context.Context, kind string, list groupLister) ([]Room, error) {
+	if err := service.ensureInitialized(); err != nil {
+		return nil, err
+	}
+
+	groups, err := list(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get %ss: %w", kind, err)
+	}
+	lights, groupedLights, err := service.lightState(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roomList := make([]Room, 0, len(groups))
+	for _, group := range groups {
+		roomList = append(roomList, service.newRoom(ctx, group, lights, groupedLights))
+	}
+	sort.Slice(roomList, func(i, j int) bool {
+		if roomList[i].Name == roomList[j].Name {
+			return roomList[i].ID < roomList[j].ID
+		}
+		return roomList[i].Name < roomList[j].Name
+	})
+	return roomList, nil
+}
+
+func (service *Service) groupByID(ctx context.Context, kind, id string, list groupLister) (Room, error) {
+	if err := service.ensureInitialized(); err != nil {
+		return Room{}, err
+	}
+
+	groups, err := list(ctx)
+	if err != nil {
+		return Room{}, fmt.Errorf("get %ss: %w", kind, err)
+	}
+	group, exists := groups[id]
+	if !exists {
+		return Room{}, errorf(ErrNotFound, "no %s with id %q found", kind, id)
+	}
+	lights, groupedLights, err := service.lightState(ctx)
+	if err != nil {
+		return Room{}, err
+	}
+	return service.newRoom(ctx, group, lights, groupedLights), nil
+}
+
+func (service *Service) groupIDByName(ctx context.Context, kind, name string, list groupLister) (string, error) {
+	if err := service.ensureInitialized(); err != nil {
+		return "", err
+	}
+
+	group, err := service.findGroupByName(ctx, kind, name, list)
+	if err != nil {
+		return "", err
+	}
+	if group.Id == nil {
+		return "", fmt.Errorf("%s %q has no id", kind, name)
+	}
+	return *group.Id, nil
+}
+
+// setGroupState applies change to a room or zone and returns its name along with the state.
+func (service *Service) setGroupState(ctx context.Context, kind, id string, change StateChange, list groupLister) (State, string, error) {
+	if err := service.ensureInitialized(); err != nil {
+		return State{}, "", err
+	}
+	if err := change.validate(); err != nil {
+		return State{}, "", err
+	}
+
+	groups, err := list(ctx)
+	if err != nil {
+		return State{}, "", fmt.Errorf("get %ss: %w", kind, err)
+	}
+	group, exists := groups[id]
+	if !exists {
+		return State{}, "", errorf(ErrNotFound, "no %s with id %q found", kind, id)
+	}
+	groupedLightID, ok := groupedLightIDFromRoom(group)
+	if !ok {
+		return State{}, "", fmt.Errorf("%s has no grouped_light service", kind)
+	}
+	groupedLight, err := service.getGroupedLightByID(ctx, groupedLightID)
+	if err != nil {
+		return State{}, "", err
+	}
+
+	on := groupedLight.IsOn()
+	if change.Toggle {
+		if on, err = service.countsAsOn(ctx, kind, group, groupedLight); err != nil {
+			return State{}, "", err
+		}
+	}
+	name := nameFromRoom(group)
+	change = service.resolveToggle(change, on, kind, name)
+	dynamics := service.groupDynamics(kind, name, change.transition())
+	if service.restoreMode(kind, name) == config.RestoreSnapshot {
+		if change.switchesOff() && groupedLight.IsOn() {
+			if err := service.snapshotGroup(ctx, kind, group); err != nil {
+				return State{}, "", err
+			}
+		}
+		if change.restoresSnapshot() {
+			restored, err := service.restoreGroup(ctx, kind, name, lightDynamicsOf(dynamics))
+			if err != nil {
+				return State{}, "", err
+			}
+			if restored {
+				return State{TargetType: kind, Target: id, On: true}, name, nil
+			}
+		} else if change.On != nil && *change.On {
+			// An explicit brightness or colour temperature makes the snapshot stale.
+			service.snapshots.drop(kind, name)
+		}
+	}
+	body := openhue.GroupedLightPut{
+		Dimming:          change.dimming(),
+		ColorTemperature: colorTemperature(change.ColorTemperature),
+		Color:            change.color(),
+		Dynamics:         dynamics,
+	}
+	if change.On != nil {
+		body.On = &openhue.On{On: change.On}
+	}
+	if err := service.updateGroupedLight(ctx, groupedLightID, body); err != nil {
+		return State{}, "", err
+	}
+
+	var brightness *float64
+	if groupedLight.Dimming != nil {
+		brightness = brightnessValue(groupedLight.Dimming.Brightness)
+	}
+	return resultingState(kind, id, groupedLight.IsOn(), brightness, change), name, nil
+}
+
+// lightState returns all lights and grouped lights, used to describe rooms and zones.
+func (service *Service) lightState(ctx context.Context) (map[string]openhue.LightGet, map[string]openhue.GroupedLightGet, error) {
+	lights, err := service.getLights(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get lights: %w", err)
+	}
+	groupedLights, err := service.getGroupedLights(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get grouped lights: %w", err)
+	}
+	return lights, groupedLights, nil
+}
+
+func (service *Service) newRoom(ctx context.Context, group openhue.RoomGet, lights map[string]openhue.LightGet, groupedLights map[string]openhue.GroupedLightGet) Room {
+	room := Room{Name: nameFromRoom(group), Lights: []Light{}}
+	if group.Id != nil {
+		room.ID = *group.Id
+	}
+	if groupedLightID, ok := groupedLightIDFromRoom(group); ok {
+		if groupedLight, exists := groupedLights[groupedLightID]; exists {
+			room.On = groupedLight.IsOn()
+			if groupedLight.Dimming != nil {
+				room.Brightness = brightnessValue(groupedLight.Dimming.Brightness)
+			}
+		}
+	}
+
+	for _, lightID := range service.lightIDsFromRoom(ctx, group) {
+		light, exists := lights[lightID]
+		if !exists {
+			continue
+		}
+		lightIDInt, err := lightIDV1ToInt(light.IdV1)
+		if err != nil {
+			continue
+		}
+		room.Lights = append(room.Lights, Light{Name: nameFromLight(light), ID: lightIDInt})
+	}
+	sortLights(room.Lights)
+	return room
+}
+
+// groupNames maps the resource ids of all rooms and zones to their names.
+func (service *Service) groupNames(ctx context.Context) (map[string]string, error) {
+	rooms, err := service.getRooms(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get rooms: %w", err)
+	}
+	zones, err := service.getZones(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get zones: %w", err)
+	}
+
+	names := make(map[string]string, len(rooms)+len(zones))
+	for id, room := range rooms {
+		names[id] = nameFromRoom(room)
+	}
+	for id, zone := range zones {
+		names[id] = nameFromRoom(zone)
+	}
+	return names, nil
+}
+
+func newScene(scene openhue.SceneGet, groupNames map[string]string) Scene {
+	result := Scene{}
+	if scene.Id != nil {
+		result.ID = *scene.Id
+	}
+	if scene.Metadata != nil && scene.Metadata.Name != nil {
+		result.Name = *scene.Metadata.Name
+	}
+	if scene.Group != nil {
+		if scene.Group.Rtype != nil {
+			result.GroupType = string(*scene.Group.Rtype)
+		}
+		if scene.Group.Rid != nil {
+			result.GroupID = *scene.Group.Rid
+			result.GroupName = groupNames[*scene.Group.Rid]
+		}
+	}
+	if scene.Status != nil && scene.Status.Active != nil {
+		result.Active = *scene.Status.Active != openhue.SceneGetStatusActiveInactive
+	}
+	return result
+}
+
+func lightDetails(light openhue.LightGet) (LightDetails, error) {
+	lightID, err := lightIDV1ToInt(light.IdV1)
+	if err != nil {
+		return LightDetails{}, err
+	}
+	details := LightDetails{ID: lightID, Name: nameFromLight(light), On: light.IsOn(), Effects: supportedEffects(light)}
+	if light.Dimming != nil {
+		details.Brightness = brightnessValue(light.Dimming.Brightness)
+	}
+	if light.ColorTemperature != nil && light.ColorTemperature.Mirek != nil && *light.ColorTemperature.Mirek > 0 {
+		kelvin := int(math.Round(1e6 / float64(*light.ColorTemperature.Mirek)))
+		details.ColorTemperature = &kelvin
+	}
+	if light.Color != nil && light.Color.Xy != nil && light.Color.Xy.X != nil && light.Color.Xy.Y != nil {
+		// The bridge reports four decimals; rounding drops the float32 noise.
+		details.Color = &XY{X: math.Round(float64(*light.Color.Xy.X)*1e4) / 1e4, Y: math.Round(float64(*light.Color.Xy.Y)*1e4) / 1e4}
+	}
+	return details, nil
+}
+
+// resultingState combines the state before a change with the change that was sent.
+func resultingState(targetType, target string, on bool, brightness *float64, change StateChange) State {
+	state := State{TargetType: targetType, Target: target, On: on, Brightness: brightness}
+	if change.On != nil {
+		state.On = *change.On
+	}
+	if change.Brightness != nil {
+		state.Brightness = change.Brightness
+	}
+	state.ColorTemperature = change.ColorTemperature
+	state.Color = change.Color
+	if !state.On {
+		state.Brightness = nil
+		state.ColorTemperature = nil
+		state.Color = nil
+	}
+	return state
+}
@@ -0,0 +1,182 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/openhue/openhue-go"
+)
+
+func TestRoomsAndZones(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-1", 1, "Ceiling", true)
+	fake.addLight("light-2", 2, "Counter", false)
+	fake.addRoom("room-1", "Kitchen", "grouped-1", true, "light-1", "light-2")
+	fake.addZone("zone-1", "Downstairs", "grouped-2", false, "light-2")
+	service := newTestService(fake)
+
+	rooms, err := service.Rooms(context.Background())
+	if err != nil {
+		t.Fatalf("Rooms() error = %v, want nil", err)
+	}
+	wantRooms := []Room{{
+		ID:     "room-1",
+		Name:   "Kitchen",
+		On:     true,
+		Lights: []Light{{Name: "Ceiling", ID: 1}, {Name: "Counter", ID: 2}},
+	}}
+	if !reflect.DeepEqual(rooms, wantRooms) {
+		t.Fatalf("Rooms() = %#v, want %#v", rooms, wantRooms)
+	}
+
+	zone, err := service.Zone(context.Background(), "zone-1")
+	if err != nil {
+		t.Fatalf("Zone() error = %v, want nil", err)
+	}
+	wantZone := Room{ID: "zone-1", Name: "Downstairs", Lights: []Light{{Name: "Counter", ID: 2}}}
+	if !reflect.DeepEqual(zone, wantZone) {
+		t.Fatalf("Zone() = %#v, want %#v", zone, wantZone)
+	}
+
+	if _, err := service.Room(context.Background(), "zone-1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Room() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSetRoomState(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addRoom("room-1", "Kitchen", "grouped-1", false)
+	service := newTestService(fake)
+
+	on := true
+	brightness := 40.0
+	tooBright := 101.0
+	state, err := service.SetRoomState(context.Background(), "room-1", StateChange{On: &on, Brightness: &brightness})
+	if err != nil {
+		t.Fatalf("SetRoomState() error = %v, want nil", err)
+	}
+	want := State{TargetType: "room", Target: "room-1", On: true, Brightness: &brightness}
+	if !reflect.DeepEqual(state, want) {
+		t.Fatalf("SetRoomState() = %+v, want %+v", state, want)
+	}
+	if len(fake.groupedLightUpdates) != 1 {
+		t.Fatalf("grouped light updates = %d, want 1", len(fake.groupedLightUpdates))
+	}
+	body := fake.groupedLightUpdates[0].body
+	if !*body.On.On || body.Dimming == nil || *body.Dimming.Brightness != 40 {
+		t.Fatalf("grouped light update = %#v, want on at brightness 40", body)
+	}
+
+	tests := []struct {
+		name   string
+		id     string
+		change StateChange
+		want   error
+	}{
+		{name: "empty change", id: "room-1", change: StateChange{}, want: ErrInvalidParameter},
+		{name: "brightness out of range", id: "room-1", change: StateChange{Brightness: &tooBright}, want: ErrInvalidParameter},
+		{name: "unknown room", id: "room-2", change: StateChange{On: &on}, want: ErrNotFound},
+	}
+	for _, tt := range tests {
+		if _, err := service.SetRoomState(context.Background(), tt.id, tt.change); !errors.Is(err, tt.want) {
+			t.Fatalf("%s: SetRoomState() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSetLightState(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-1", 1, "Desk", true)
+	service := newTestService(fake)
+
+	brightness := 25.0
+	state, err := service.SetLightState(context.Background(), 1, StateChange{Brightness: &brightness})
+	if err != nil {
+		t.Fatalf("SetLightState() error = %v, want nil", err)
+	}
+	want := State{TargetType: "light", Target: "1", On: true, Brightness: &brightness}
+	if !reflect.DeepEqual(state, want) {
+		t.Fatalf("SetLightState() = %+v, want %+v", state, want)
+	}
+	if body := fake.lightUpdates[0].body; body.On != nil {
+		t.Fatalf("light update on = %#v, want nil when only brightness changes", body.On)
+	}
+}
+
+func TestScenes(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addRoom("room-1", "Kitchen", "grouped-1", false)
+	fake.addScene("scene-1", "Relax", "room-1", openhue.ResourceIdentifierRtypeRoom)
+	service := newTestService(fake)
+
+	scenes, err := service.Scenes(context.Background())
+	if err != nil {
+		t.Fatalf("Scenes() error = %v, want nil", err)
+	}
+	wantScenes := []Scene{{ID: "scene-1", Name: "Relax", GroupType: "room", GroupID: "room-1", GroupName: "Kitchen"}}
+	if !reflect.DeepEqual(scenes, wantScenes) {
+		t.Fatalf("Scenes() = %#v, want %#v", scenes, wantScenes)
+	}
+
+	if _, err := service.RecallScene(context.Background(), "scene-1", ""); err != nil {
+		t.Fatalf("RecallScene() error = %v, want nil", err)
+	}
+	if len(fake.sceneUpdates) != 1 || *fake.sceneUpdates[0].body.Recall.Action != openhue.SceneRecallActionActive {
+		t.Fatalf("scene updates = %#v, want one active recall", fake.sceneUpdates)
+	}
+	if _, err := service.RecallScene(context.Background(), "scene-1", "sparkle"); !errors.Is(err, ErrInvalidParameter) {
+		t.Fatalf("RecallScene() error = %v, want ErrInvalidParameter", err)
+	}
+	if _, err := service.RecallScene(context.Background(), "scene-2", ""); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("RecallScene() error = %v, want ErrNotFound", err)
+	}
+
+	for _, scene := range []string{"scene-1", "Relax"} {
+		if id, err := service.SceneID(context.Background(), "room-1", scene); err != nil || id != "scene-1" {
+			t.Fatalf("SceneID(%q) = %q, %v, want %q, nil", scene, id, err, "scene-1")
+		}
+	}
+	if _, err := service.SceneID(context.Background(), "room-2", "Relax"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("SceneID() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSetStateToggle(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-1", 1, "Desk", false)
+	fake.addZone("zone-1", "Downstairs", "grouped-1", true)
+	service := newTestService(fake)
+
+	state, err := service.SetLightState(context.Background(), 1, StateChange{Toggle: true})
+	if err != nil {
+		t.Fatalf("SetLightState() error = %v, want nil", err)
+	}
+	if !state.On || state.Brightness == nil || *state.Brightness != 100 {
+		t.Fatalf("SetLightState() = %+v, want on at brightness 100", state)
+	}
+
+	state, err = service.SetZoneState(context.Background(), "zone-1", StateChange{Toggle: true})
+	if err != nil {
+		t.Fatalf("SetZoneState() error = %v, want nil", err)
+	}
+	if state.On || *fake.groupedLightUpdates[0].body.On.On {
+		t.Fatalf("SetZoneState() = %+v, want zone switched off", state)
+	}
+
+	on := true
+	if _, err := service.SetLightState(context.Background(), 1, StateChange{On: &on, Toggle: true}); !errors.Is(err, ErrInvalidParameter) {
+		t.Fatalf("SetLightState() error = %v, want ErrInvalidParameter", err)
+	}
+}
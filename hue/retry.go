@@ -0,0 +1,202 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"hueshelly/logging"
+	"hueshelly/metrics"
+
+	"github.com/openhue/openhue-go"
+)
+
+// BridgeError describes the final failure of a bridge call after retries.
+type BridgeError struct {
+	Operation string
+	Attempts  int
+	// Transient is true when the last failure was a timeout, reset or 5xx response.
+	Transient bool
+	// StatusCode is the HTTP status returned by the bridge, or 0 when there was no response.
+	StatusCode int
+	Err        error
+}
+
+func (bridgeErr *BridgeError) Error() string {
+	return fmt.Sprintf("bridge %s failed after %d attempt(s): %v", bridgeErr.Operation, bridgeErr.Attempts, bridgeErr.Err)
+}
+
+func (bridgeErr *BridgeError) Unwrap() error {
+	return bridgeErr.Err
+}
+
+func (bridgeErr *BridgeError) Is(target error) bool {
+	switch target {
+	case ErrBridgeUnavailable:
+		return bridgeErr.Transient
+	case ErrBridgeUnreachable:
+		return bridgeErr.StatusCode == 0 && isNetworkError(bridgeErr.Err) && !errors.Is(bridgeErr.Err, context.Canceled)
+	case ErrUnauthorized:
+		return bridgeErr.StatusCode == http.StatusUnauthorized || bridgeErr.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return bridgeErr.StatusCode == http.StatusNotFound
+	case ErrRateLimited:
+		return bridgeErr.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// retryMode says whether a bridge command may be repeated after a transient failure.
+type retryMode bool
+
+const (
+	// retryTransient is for idempotent commands: writes of absolute states
+	// (toggles are resolved to on or off before they are sent).
+	retryTransient retryMode = true
+	// sendOnce is for relative commands such as dimming deltas, which would be
+	// applied twice when the bridge ran a command whose response got lost.
+	sendOnce retryMode = false
+)
+
+// retryPolicy controls retries of reads and of commands sent with retryTransient.
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	// sleep waits between attempts; nil uses sleepContext.
+	sleep func(ctx context.Context, delay time.Duration) error
+}
+
+func (policy retryPolicy) wait(ctx context.Context, delay time.Duration) error {
+	if policy.sleep != nil {
+		return policy.sleep(ctx, delay)
+	}
+	return sleepContext(ctx, delay)
+}
+
+// backoff returns the exponential delay with jitter before the given retry (1-based).
+func (policy retryPolicy) backoff(retry int) time.Duration {
+	delay := policy.initialBackoff
+	for i := 1; i < retry && delay < policy.maxBackoff; i++ {
+		delay *= 2
+	}
+	if policy.maxBackoff > 0 && delay > policy.maxBackoff {
+		delay = policy.maxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// callBridge runs an idempotent bridge call and retries transient failures with
+// exponential backoff as long as ctx leaves time for another attempt.
+func (service *Service) callBridge(ctx context.Context, operation string, call func(ctx context.Context) error) error {
+	maxAttempts := max(service.retry.maxAttempts, 1)
+
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		err = service.observeBridgeCall(ctx, operation, call)
+		if err == nil {
+			return nil
+		}
+		if attempt >= maxAttempts || !isTransient(err) || ctx.Err() != nil {
+			break
+		}
+
+		delay := service.retry.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+			break
+		}
+		logRetry(operation, err, delay)
+		if service.retry.wait(ctx, delay) != nil {
+			break
+		}
+	}
+	return bridgeFailure(ctx, operation, attempt, err)
+}
+
+// callBridgeOnce runs a bridge call that must not be repeated.
+func (service *Service) callBridgeOnce(ctx context.Context, operation string, call func(ctx context.Context) error) error {
+	if err := service.observeBridgeCall(ctx, operation, call); err != nil {
+		return bridgeFailure(ctx, operation, 1, err)
+	}
+	return nil
+}
+
+func logRetry(operation string, err error, delay time.Duration) {
+	logging.Logger.Printf("Bridge %s failed (%v), retrying in %v", operation, err, delay)
+	metrics.BridgeRetries.Inc(operation)
+}
+
+// bridgeFailure wraps the last error of a bridge call that gave up. Errors of a
+// closing service or a cancelled caller are returned as they are.
+func bridgeFailure(ctx context.Context, operation string, attempts int, err error) error {
+	if errors.Is(err, errServiceClosed) || ctx.Err() != nil {
+		return err
+	}
+	return &BridgeError{
+		Operation:  operation,
+		Attempts:   attempts,
+		Transient:  isTransient(err),
+		StatusCode: bridgeStatusCode(err),
+		Err:        err,
+	}
+}
+
+// isTransient reports whether a failed call may succeed when repeated.
+func isTransient(err error) bool {
+	if err == nil || errors.Is(err, errServiceClosed) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	switch bridgeStatusCode(err) {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case 0:
+	default:
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// isNetworkError reports whether err comes from the connection to the bridge
+// rather than from a response, e.g. a refused connection or a timeout.
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	var errno syscall.Errno
+	return errors.As(err, &netErr) ||
+		errors.As(err, &errno) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func bridgeStatusCode(err error) int {
+	var apiErr *openhue.ApiError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
@@ -0,0 +1,189 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/openhue/openhue-go"
+)
+
+func TestIsTransient(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "service unavailable", err: &openhue.ApiError{StatusCode: http.StatusServiceUnavailable}, want: true},
+		{name: "rate limited by bridge", err: &openhue.ApiError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "wrong key", err: &openhue.ApiError{StatusCode: http.StatusForbidden}, want: false},
+		{name: "not found", err: &openhue.ApiError{StatusCode: http.StatusNotFound}, want: false},
+		{name: "connection reset", err: fmt.Errorf("read: %w", syscall.ECONNRESET), want: true},
+		{name: "attempt timeout", err: fmt.Errorf("get: %w", context.DeadlineExceeded), want: true},
+		{name: "cancelled", err: context.Canceled, want: false},
+		{name: "shutting down", err: errServiceClosed, want: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := isTransient(tt.err); got != tt.want {
+				t.Fatalf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	t.Parallel()
+
+	policy := retryPolicy{maxAttempts: 5, initialBackoff: 100 * time.Millisecond, maxBackoff: 300 * time.Millisecond}
+	for retry, ceiling := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 300 * time.Millisecond, 4: 300 * time.Millisecond} {
+		delay := policy.backoff(retry)
+		if delay < ceiling/2 || delay > ceiling {
+			t.Fatalf("backoff(%d) = %v, want between %v and %v", retry, delay, ceiling/2, ceiling)
+		}
+	}
+}
+
+func TestCallBridgeRetriesTransientErrors(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-uuid", 3, "Desk", true)
+	fake.failures = []error{
+		&openhue.ApiError{StatusCode: http.StatusServiceUnavailable},
+		fmt.Errorf("read: %w", syscall.ECONNRESET),
+	}
+	service := newTestService(fake)
+	service.retry = retryPolicy{maxAttempts: 3, initialBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+
+	if _, err := service.ToggleLight(context.Background(), 3); err != nil {
+		t.Fatalf("ToggleLight() error = %v, want nil", err)
+	}
+	if len(fake.lightUpdates) != 1 {
+		t.Fatalf("light updates = %d, want 1", len(fake.lightUpdates))
+	}
+}
+
+func TestCallBridgeGivesUpWithBridgeError(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.err = &openhue.ApiError{StatusCode: http.StatusServiceUnavailable}
+	service := newTestService(fake)
+	backoffs := 0
+	service.retry = retryPolicy{maxAttempts: 3, initialBackoff: time.Second, maxBackoff: time.Second, sleep: func(ctx context.Context, delay time.Duration) error {
+		backoffs++
+		return nil
+	}}
+
+	_, err := service.ToggleLight(context.Background(), 3)
+	if backoffs != 2 {
+		t.Fatalf("backoffs = %d, want 2 between 3 attempts", backoffs)
+	}
+	var bridgeErr *BridgeError
+	if !errors.As(err, &bridgeErr) {
+		t.Fatalf("ToggleLight() error = %v, want *BridgeError", err)
+	}
+	if bridgeErr.Attempts != 3 || !bridgeErr.Transient || bridgeErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("BridgeError = %+v, want 3 transient attempts with status 503", bridgeErr)
+	}
+	if !errors.Is(err, ErrBridgeUnavailable) {
+		t.Fatalf("errors.Is(%v, ErrBridgeUnavailable) = false, want true", err)
+	}
+}
+
+func TestCallBridgeDoesNotRetryPermanentErrors(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.err = &openhue.ApiError{StatusCode: http.StatusForbidden}
+	service := newTestService(fake)
+	service.retry = retryPolicy{maxAttempts: 3, initialBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+
+	_, err := service.ToggleLight(context.Background(), 3)
+	if errors.Is(err, ErrBridgeUnavailable) {
+		t.Fatalf("errors.Is(%v, ErrBridgeUnavailable) = true, want false", err)
+	}
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("errors.Is(%v, ErrUnauthorized) = false, want true", err)
+	}
+	if fake.calls != 1 {
+		t.Fatalf("bridge calls = %d, want 1", fake.calls)
+	}
+}
+
+func TestCallBridgeStopsAtDeadline(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.err = &openhue.ApiError{StatusCode: http.StatusServiceUnavailable}
+	service := newTestService(fake)
+	var sleeps []time.Duration
+	service.retry = retryPolicy{
+		maxAttempts:    10,
+		initialBackoff: time.Hour,
+		maxBackoff:     time.Hour,
+		sleep: func(ctx context.Context, delay time.Duration) error {
+			sleeps = append(sleeps, delay)
+			return nil
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, err := service.ToggleLight(ctx, 3)
+
+	var bridgeErr *BridgeError
+	if !errors.As(err, &bridgeErr) || bridgeErr.Attempts != 1 {
+		t.Fatalf("ToggleLight() error = %v, want a bridge error after 1 attempt", err)
+	}
+	if len(sleeps) != 0 || fake.calls != 1 {
+		t.Fatalf("sleeps = %v, bridge calls = %d, want no backoff past the deadline and 1 call", sleeps, fake.calls)
+	}
+}
+
+func TestBridgeErrorKinds(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  *BridgeError
+		want error
+	}{
+		{name: "unauthorized", err: &BridgeError{StatusCode: http.StatusUnauthorized}, want: ErrUnauthorized},
+		{name: "not found", err: &BridgeError{StatusCode: http.StatusNotFound}, want: ErrNotFound},
+		{name: "rate limited", err: &BridgeError{StatusCode: http.StatusTooManyRequests, Transient: true}, want: ErrRateLimited},
+		{name: "unreachable", err: &BridgeError{Err: syscall.ECONNREFUSED, Transient: true}, want: ErrBridgeUnreachable},
+		{name: "unavailable", err: &BridgeError{StatusCode: http.StatusBadGateway, Transient: true}, want: ErrBridgeUnavailable},
+		{name: "timeout", err: &BridgeError{Err: fmt.Errorf("get: %w", context.DeadlineExceeded), Transient: true}, want: ErrBridgeUnreachable},
+		{name: "missing resource", err: &BridgeError{Err: errorf(ErrNotFound, "device %q not returned by bridge", "d")}, want: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if !errors.Is(tt.err, tt.want) {
+				t.Fatalf("errors.Is(%v, %v) = false, want true", tt.err, tt.want)
+			}
+		})
+	}
+
+	for _, err := range []*BridgeError{
+		{StatusCode: http.StatusBadGateway},
+		{Err: errorf(ErrNotFound, "grouped light %q not returned by bridge", "g")},
+		{Err: errors.New("unexpected response")},
+	} {
+		if errors.Is(err, ErrBridgeUnreachable) {
+			t.Fatalf("errors.Is(%v, ErrBridgeUnreachable) = true, want only network errors to match", err)
+		}
+	}
+}
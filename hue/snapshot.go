@@ -0,0 +1,174 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/openhue/openhue-go"
+)
+
+// lightSnapshot is the state of one light as hueshelly saw it before a toggle switched it off.
+type lightSnapshot struct {
+	on         bool
+	brightness *openhue.Brightness
+	mirek      *openhue.Mirek
+	xy         *openhue.GamutPosition
+	effect     *openhue.SupportedEffects
+}
+
+// snapshotStore keeps the snapshots of rooms and lights in the snapshot
+// restore mode, keyed by target and then by bridge light id. A nil store keeps nothing.
+type snapshotStore struct {
+	mu      sync.Mutex
+	targets map[string]map[string]lightSnapshot
+}
+
+func newSnapshotStore() *snapshotStore {
+	return &snapshotStore{targets: map[string]map[string]lightSnapshot{}}
+}
+
+func (store *snapshotStore) save(targetType, target string, lights map[string]lightSnapshot) {
+	if store == nil {
+		return
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.targets[targetType+"/"+target] = lights
+}
+
+func (store *snapshotStore) get(targetType, target string) (map[string]lightSnapshot, bool) {
+	if store == nil {
+		return nil, false
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	lights, exists := store.targets[targetType+"/"+target]
+	return lights, exists
+}
+
+// drop forgets the snapshot of a target once it was applied or is stale.
+func (store *snapshotStore) drop(targetType, target string) {
+	if store == nil {
+		return
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.targets, targetType+"/"+target)
+}
+
+// restoreMode returns how a toggle switches a target on.
+func (service *Service) restoreMode(targetType, target string) string {
+	return service.restore.Mode(targetType, target, service.restorePreviousLightState)
+}
+
+func snapshotOf(light openhue.LightGet) lightSnapshot {
+	snapshot := lightSnapshot{on: light.IsOn()}
+	if light.Dimming != nil {
+		snapshot.brightness = light.Dimming.Brightness
+	}
+	switch {
+	case light.ColorTemperature != nil && light.ColorTemperature.MirekValid != nil && *light.ColorTemperature.MirekValid:
+		snapshot.mirek = light.ColorTemperature.Mirek
+	case light.Color != nil && light.Color.Xy != nil:
+		snapshot.xy = light.Color.Xy
+	}
+	if light.Effects != nil && light.Effects.Status != nil && *light.Effects.Status != openhue.SupportedEffectsNoEffect {
+		snapshot.effect = light.Effects.Status
+	}
+	return snapshot
+}
+
+// body switches a light on into its snapshot.
+func (snapshot lightSnapshot) body(dynamics *openhue.LightDynamics) openhue.LightPut {
+	on := true
+	body := openhue.LightPut{On: &openhue.On{On: &on}, Dynamics: dynamics}
+	if snapshot.brightness != nil {
+		body.Dimming = &openhue.Dimming{Brightness: snapshot.brightness}
+	}
+	if snapshot.mirek != nil {
+		body.ColorTemperature = &openhue.ColorTemperature{Mirek: snapshot.mirek}
+	}
+	if snapshot.xy != nil {
+		body.Color = &openhue.Color{Xy: snapshot.xy}
+	}
+	if snapshot.effect != nil {
+		body.Effects = &openhue.Effects{Effect: snapshot.effect}
+	}
+	return body
+}
+
+// snapshotGroup saves the member lights of a room or zone before it is
+// switched off.
+func (service *Service) snapshotGroup(ctx context.Context, kind string, group openhue.RoomGet) error {
+	lights, err := service.getLights(ctx)
+	if err != nil {
+		return fmt.Errorf("get lights: %w", err)
+	}
+	snapshots := map[string]lightSnapshot{}
+	for _, lightID := range service.lightIDsFromRoom(ctx, group) {
+		if light, exists := lights[lightID]; exists {
+			snapshots[lightID] = snapshotOf(light)
+		}
+	}
+	service.snapshots.save(kind, nameFromRoom(group), snapshots)
+	return nil
+}
+
+// restoreGroup puts the member lights of a room or zone back into its
+// snapshot: lights that were on are switched on into their state, lights that
+// were off are switched off. The snapshot is dropped once it was applied. ok is
+// false when there is no snapshot with a light that was on.
+func (service *Service) restoreGroup(ctx context.Context, kind, name string, dynamics *openhue.LightDynamics) (bool, error) {
+	snapshots, exists := service.snapshots.get(kind, name)
+	if !exists {
+		return false, nil
+	}
+	anyOn := false
+	for _, snapshot := range snapshots {
+		anyOn = anyOn || snapshot.on
+	}
+	if !anyOn {
+		service.snapshots.drop(kind, name)
+		return false, nil
+	}
+	lights, err := service.getLights(ctx)
+	if err != nil {
+		return false, fmt.Errorf("get lights: %w", err)
+	}
+
+	for lightID, snapshot := range snapshots {
+		body := snapshot.body(dynamics)
+		if !snapshot.on {
+			if light, exists := lights[lightID]; !exists || !light.IsOn() {
+				continue
+			}
+			off := false
+			body = openhue.LightPut{On: &openhue.On{On: &off}, Dynamics: dynamics}
+		}
+		if err := service.updateLight(ctx, lightID, body); err != nil {
+			return false, err
+		}
+	}
+	service.snapshots.drop(kind, name)
+	return true, nil
+}
+
+// restoreLight switches a light on into its snapshot and drops the snapshot.
+// It returns nil when the light has no snapshot of it being on.
+func (service *Service) restoreLight(ctx context.Context, target, bridgeID string, dynamics *openhue.LightDynamics) (*lightSnapshot, error) {
+	snapshots, exists := service.snapshots.get("light", target)
+	if !exists {
+		return nil, nil
+	}
+	snapshot, exists := snapshots[bridgeID]
+	if !exists || !snapshot.on {
+		service.snapshots.drop("light", target)
+		return nil, nil
+	}
+	if err := service.updateLight(ctx, bridgeID, snapshot.body(dynamics)); err != nil {
+		return nil, err
+	}
+	service.snapshots.drop("light", target)
+	return &snapshot, nil
+}
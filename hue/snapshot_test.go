@@ -0,0 +1,144 @@
+package hue
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"hueshelly/config"
+
+	"github.com/openhue/openhue-go"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-1", 1, "Ceiling", true)
+	fake.addLight("light-2", 2, "Counter", false)
+	fake.addLight("light-3", 3, "Desk", true)
+	fake.addRoom("room-1", "Kitchen", "grouped-1", true, "light-1", "light-2")
+	for _, id := range []string{"light-1", "light-3"} {
+		light := fake.lights[id]
+		if err := json.Unmarshal([]byte(`{"dimming":{"brightness":30},"color_temperature":{"mirek":400,"mirek_valid":true}}`), &light); err != nil {
+			t.Fatalf("decode light state: %v", err)
+		}
+		fake.lights[id] = light
+	}
+	service := newTestService(fake)
+	service.restore = config.Restore{Default: config.RestoreSnapshot}
+	service.snapshots = newSnapshotStore()
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := service.ToggleLightsInRoom(ctx, "Kitchen"); err != nil {
+			t.Fatalf("ToggleLightsInRoom() error = %v, want nil", err)
+		}
+	}
+	if len(fake.groupedLightUpdates) != 1 || *fake.groupedLightUpdates[0].body.On.On {
+		t.Fatalf("grouped light updates = %#v, want only the switch off", fake.groupedLightUpdates)
+	}
+	if _, exists := service.snapshots.get("room", "Kitchen"); exists {
+		t.Fatalf("room snapshot kept after it was restored, want it dropped")
+	}
+	if len(fake.lightUpdates) != 1 || fake.lightUpdates[0].id != "light-1" {
+		t.Fatalf("light updates = %#v, want light-1 restored alone", fake.lightUpdates)
+	}
+	body := fake.lightUpdates[0].body
+	if !*body.On.On || *body.Dimming.Brightness != 30 || *body.ColorTemperature.Mirek != 400 {
+		t.Fatalf("restored light = %#v, want on at 30%% and 400 mirek", body)
+	}
+
+	for range 2 {
+		if _, err := service.ToggleLight(ctx, 3); err != nil {
+			t.Fatalf("ToggleLight() error = %v, want nil", err)
+		}
+	}
+	body = fake.lightUpdates[2].body
+	if !*body.On.On || *body.Dimming.Brightness != 30 || *body.ColorTemperature.Mirek != 400 {
+		t.Fatalf("restored light = %#v, want on at 30%% and 400 mirek", body)
+	}
+}
+
+func TestSnapshotOnEveryRoute(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-1", 1, "Ceiling", true)
+	fake.addLight("light-2", 2, "Counter", false)
+	fake.addLight("light-3", 3, "Desk", true)
+	fake.addRoom("room-1", "Kitchen", "grouped-1", true, "light-1", "light-2")
+	for _, id := range []string{"light-1", "light-3"} {
+		light := fake.lights[id]
+		if err := json.Unmarshal([]byte(`{"dimming":{"brightness":30}}`), &light); err != nil {
+			t.Fatalf("decode light state: %v", err)
+		}
+		fake.lights[id] = light
+	}
+	service := newTestService(fake)
+	service.restore = config.Restore{Default: config.RestoreSnapshot}
+	service.snapshots = newSnapshotStore()
+	ctx := context.Background()
+
+	if _, err := service.FadeOffRoom(ctx, "Kitchen", time.Second); err != nil {
+		t.Fatalf("FadeOffRoom() error = %v, want nil", err)
+	}
+	// Someone switches the counter on in the app while the room is off.
+	fake.mu.Lock()
+	counter := fake.lights["light-2"]
+	on := true
+	counter.On = &openhue.On{On: &on}
+	fake.lights["light-2"] = counter
+	fake.mu.Unlock()
+
+	if _, err := service.TurnOnRoomFor(ctx, "Kitchen", time.Minute); err != nil {
+		t.Fatalf("TurnOnRoomFor() error = %v, want nil", err)
+	}
+	restored := map[string]openhue.LightPut{}
+	for _, update := range fake.lightUpdates {
+		restored[update.id] = update.body
+	}
+	if len(fake.lightUpdates) != 2 || !*restored["light-1"].On.On || *restored["light-1"].Dimming.Brightness != 30 || *restored["light-2"].On.On {
+		t.Fatalf("light updates = %#v, want light-1 on at 30%% and light-2 off", fake.lightUpdates)
+	}
+	if _, exists := service.snapshots.get("room", "Kitchen"); exists {
+		t.Fatalf("room snapshot kept after it was restored, want it dropped")
+	}
+
+	off, switchOn := false, true
+	for _, change := range []StateChange{{On: &off}, {On: &switchOn}} {
+		if _, err := service.SetLightState(ctx, 3, change); err != nil {
+			t.Fatalf("SetLightState() error = %v, want nil", err)
+		}
+	}
+	body := fake.lightUpdates[len(fake.lightUpdates)-1].body
+	if !*body.On.On || body.Dimming == nil || *body.Dimming.Brightness != 30 {
+		t.Fatalf("restored light = %#v, want on at 30%%", body)
+	}
+	if _, exists := service.snapshots.get("light", "3"); exists {
+		t.Fatalf("light snapshot kept after it was restored, want it dropped")
+	}
+}
+
+func TestRestoreModePerTarget(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-1", 1, "Ceiling", false)
+	fake.addLight("light-2", 2, "Counter", false)
+	service := newTestService(fake)
+	service.restore = config.Restore{Lights: map[string]string{"2": config.RestorePrevious}}
+
+	for _, id := range []int{1, 2} {
+		if _, err := service.ToggleLight(context.Background(), id); err != nil {
+			t.Fatalf("ToggleLight(%d) error = %v, want nil", id, err)
+		}
+	}
+	if dimming := fake.lightUpdates[0].body.Dimming; dimming == nil || *dimming.Brightness != 100 {
+		t.Fatalf("light 1 dimming = %#v, want full brightness", dimming)
+	}
+	if dimming := fake.lightUpdates[1].body.Dimming; dimming != nil {
+		t.Fatalf("light 2 dimming = %#v, want the previous brightness restored", dimming)
+	}
+}
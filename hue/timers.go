@@ -0,0 +1,327 @@
+package hue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hueshelly/config"
+	"hueshelly/logging"
+)
+
+const maxTimerDuration = 24 * time.Hour
+
+// Timer switches a light or room off at OffAt.
+type Timer struct {
+	// TargetType is "light" or "room".
+	TargetType string `json:"targetType"`
+	// Target is the light id or room name, as in State.
+	Target string    `json:"target"`
+	OffAt  time.Time `json:"offAt"`
+}
+
+func (timer Timer) key() string {
+	return timer.TargetType + "/" + timer.Target
+}
+
+// timerSet holds the pending auto-off timers and mirrors them to a state file,
+// so a restart does not leave the staircase lit forever. A nil timerSet
+// schedules nothing.
+type timerSet struct {
+	path string
+	now  func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*timerEntry
+}
+
+type timerEntry struct {
+	timer Timer
+	stop  *time.Timer
+}
+
+func newTimerSet(path string) *timerSet {
+	return &timerSet{path: path, now: time.Now, entries: map[string]*timerEntry{}}
+}
+
+// TurnOnLightFor switches a light on and off again after duration. Calling it
+// again before the light was switched off extends the timer.
+func (service *Service) TurnOnLightFor(ctx context.Context, lightID int, duration time.Duration) (State, error) {
+	if err := validateTimerDuration(duration); err != nil {
+		return State{}, err
+	}
+	return service.ToggleLightWith(ctx, lightID, ToggleOptions{For: duration})
+}
+
+func (service *Service) turnOnLightFor(ctx context.Context, lightID int, options ToggleOptions) (State, error) {
+	duration := options.For
+	if err := validateTimerDuration(duration); err != nil {
+		return State{}, err
+	}
+	state, err := service.setLightState(ctx, lightID, service.switchOnChange("light", strconv.Itoa(lightID), options.Transition))
+	if err != nil {
+		return State{}, err
+	}
+	service.timers.schedule(service, Timer{TargetType: "light", Target: state.Target}, duration)
+	return state, nil
+}
+
+// TurnOnRoomFor switches the lights of a room on and off again after duration.
+// Calling it again before the room was switched off extends the timer.
+func (service *Service) TurnOnRoomFor(ctx context.Context, roomName string, duration time.Duration) (State, error) {
+	if err := validateTimerDuration(duration); err != nil {
+		return State{}, err
+	}
+	return service.ToggleLightsInRoomWith(ctx, roomName, ToggleOptions{For: duration})
+}
+
+func (service *Service) turnOnRoomFor(ctx context.Context, roomName string, options ToggleOptions) (State, error) {
+	duration := options.For
+	if err := validateTimerDuration(duration); err != nil {
+		return State{}, err
+	}
+	id, err := service.RoomID(ctx, roomName)
+	if err != nil {
+		return State{}, err
+	}
+	state, err := service.setRoomState(ctx, id, service.switchOnChange("room", roomName, options.Transition))
+	if err != nil {
+		return State{}, err
+	}
+	state.Target = roomName
+	service.timers.schedule(service, Timer{TargetType: "room", Target: roomName}, duration)
+	return state, nil
+}
+
+// Timers returns the pending auto-off timers, the next one first.
+func (service *Service) Timers() []Timer {
+	if service == nil {
+		return []Timer{}
+	}
+	return service.timers.list()
+}
+
+// switchOnChange switches a target on the way the toggle routes do.
+func (service *Service) switchOnChange(targetType, target string, transition *time.Duration) StateChange {
+	change := StateChange{Toggle: true}
+	if transition != nil {
+		duration := config.Duration(*transition)
+		change.Transition = &duration
+	}
+	return service.resolveToggle(change, false, targetType, target)
+}
+
+func validateTimerDuration(duration time.Duration) error {
+	if duration <= 0 || duration > maxTimerDuration {
+		return errorf(ErrInvalidParameter, "timer duration must be between 0 and %s, got %s", maxTimerDuration, duration)
+	}
+	return nil
+}
+
+// restoreTimers schedules the timers saved by a previous run. Timers that
+// expired while hueshelly was down fire right away.
+func (service *Service) restoreTimers() {
+	saved, err := service.timers.load()
+	if err != nil {
+		logging.Logger.Println(fmt.Errorf("restore timers: %w", err))
+		return
+	}
+	for _, timer := range saved {
+		service.timers.scheduleAt(service, timer)
+	}
+}
+
+// switchOff turns the target of an expired timer off.
+func (service *Service) switchOff(timer Timer) error {
+	ctx := service.lifecycle.background
+	off := false
+	change := StateChange{On: &off}
+	switch timer.TargetType {
+	case "light":
+		lightID, err := strconv.Atoi(timer.Target)
+		if err != nil {
+			return fmt.Errorf("invalid light id %q", timer.Target)
+		}
+		_, err = service.setLightState(ctx, lightID, change)
+		return err
+	case "room":
+		id, err := service.RoomID(ctx, timer.Target)
+		if err != nil {
+			return err
+		}
+		_, err = service.setRoomState(ctx, id, change)
+		return err
+	default:
+		return fmt.Errorf("unknown timer target type %q", timer.TargetType)
+	}
+}
+
+// schedule starts or extends the timer of a target.
+func (timers *timerSet) schedule(service *Service, timer Timer, duration time.Duration) {
+	if timers == nil {
+		return
+	}
+	timer.OffAt = timers.now().Add(duration)
+	timers.scheduleAt(service, timer)
+}
+
+// scheduleAt arms a timer for timer.OffAt. An existing timer of the same target
+// is only ever moved later.
+func (timers *timerSet) scheduleAt(service *Service, timer Timer) {
+	timers.mu.Lock()
+	defer timers.mu.Unlock()
+
+	if existing, exists := timers.entries[timer.key()]; exists {
+		existing.stop.Stop()
+		if existing.timer.OffAt.After(timer.OffAt) {
+			timer.OffAt = existing.timer.OffAt
+		}
+	}
+	entry := &timerEntry{timer: timer}
+	entry.stop = time.AfterFunc(max(timer.OffAt.Sub(timers.now()), 0), func() {
+		timers.fire(service, entry)
+	})
+	timers.entries[timer.key()] = entry
+	timers.saveLocked()
+}
+
+func (timers *timerSet) fire(service *Service, entry *timerEntry) {
+	// Stop returns false once the timer has fired, so a timer that was extended
+	// or cancelled meanwhile must not switch the target off.
+	if !timers.current(entry) {
+		return
+	}
+	err := service.switchOff(entry.timer)
+	if err != nil && service.lifecycle.background.Err() != nil {
+		// Shutting down: keep the timer in the state file for the next start.
+		return
+	}
+	if err != nil {
+		logging.Logger.Println(fmt.Errorf("switch off %s %s after timer: %w", entry.timer.TargetType, entry.timer.Target, err))
+	}
+
+	timers.mu.Lock()
+	defer timers.mu.Unlock()
+	if timers.entries[entry.timer.key()] == entry {
+		delete(timers.entries, entry.timer.key())
+		timers.saveLocked()
+	}
+}
+
+// current reports whether entry is still the timer of its target.
+func (timers *timerSet) current(entry *timerEntry) bool {
+	timers.mu.Lock()
+	defer timers.mu.Unlock()
+	return timers.entries[entry.timer.key()] == entry
+}
+
+// cancel drops the timer of a target, e.g. because it was toggled by hand. A
+// timer that already fired sees that it was dropped and does nothing.
+func (timers *timerSet) cancel(targetType, target string) {
+	if timers == nil {
+		return
+	}
+	key := Timer{TargetType: targetType, Target: target}.key()
+
+	timers.mu.Lock()
+	defer timers.mu.Unlock()
+	entry, exists := timers.entries[key]
+	if !exists {
+		return
+	}
+	entry.stop.Stop()
+	delete(timers.entries, key)
+	timers.saveLocked()
+}
+
+// stop halts all timers without removing them from the state file.
+func (timers *timerSet) stop() {
+	if timers == nil {
+		return
+	}
+	timers.mu.Lock()
+	defer timers.mu.Unlock()
+	for _, entry := range timers.entries {
+		entry.stop.Stop()
+	}
+}
+
+func (timers *timerSet) list() []Timer {
+	if timers == nil {
+		return []Timer{}
+	}
+	timers.mu.Lock()
+	defer timers.mu.Unlock()
+	return timers.listLocked()
+}
+
+func (timers *timerSet) listLocked() []Timer {
+	list := make([]Timer, 0, len(timers.entries))
+	for _, entry := range timers.entries {
+		list = append(list, entry.timer)
+	}
+	slices.SortFunc(list, func(a, b Timer) int {
+		if c := a.OffAt.Compare(b.OffAt); c != 0 {
+			return c
+		}
+		return strings.Compare(a.key(), b.key())
+	})
+	return list
+}
+
+func (timers *timerSet) load() ([]Timer, error) {
+	if timers == nil || timers.path == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(timers.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %q: %w", timers.path, err)
+	}
+
+	var saved []Timer
+	if err := json.Unmarshal(content, &saved); err != nil {
+		return nil, fmt.Errorf("decode %q: %w", timers.path, err)
+	}
+	return saved, nil
+}
+
+// saveLocked writes the timers to the state file. Failures are logged: a timer
+// that is not persisted still fires unless hueshelly restarts.
+func (timers *timerSet) saveLocked() {
+	if timers.path == "" {
+		return
+	}
+	content, err := json.MarshalIndent(timers.listLocked(), "", "  ")
+	if err != nil {
+		logging.Logger.Println(fmt.Errorf("encode timers: %w", err))
+		return
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(timers.path), ".timers-*.json")
+	if err != nil {
+		logging.Logger.Println(fmt.Errorf("save timers: %w", err))
+		return
+	}
+	_, writeErr := temp.Write(append(content, '\n'))
+	closeErr := temp.Close()
+	if err := errors.Join(writeErr, closeErr); err != nil {
+		_ = os.Remove(temp.Name())
+		logging.Logger.Println(fmt.Errorf("save timers: %w", err))
+		return
+	}
+	if err := os.Rename(temp.Name(), timers.path); err != nil {
+		_ = os.Remove(temp.Name())
+		logging.Logger.Println(fmt.Errorf("save timers: %w", err))
+	}
+}
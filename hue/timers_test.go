@@ -0,0 +1,210 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func (fake *fakeBridge) lightIsOn(id string) bool {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	light := fake.lights[id]
+	return light.IsOn()
+}
+
+// waitFor polls condition until it holds or a second passed.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met within a second")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTurnOnLightFor(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-1", 1, "Stairs", false)
+	service := newTestService(fake)
+	service.timers = newTimerSet("")
+
+	state, err := service.TurnOnLightFor(context.Background(), 1, 50*time.Millisecond)
+	if err != nil {
+		t.Fatalf("TurnOnLightFor() error = %v, want nil", err)
+	}
+	if !state.On || !fake.lightIsOn("light-1") {
+		t.Fatalf("TurnOnLightFor() state = %+v, want light switched on", state)
+	}
+	if timers := service.Timers(); len(timers) != 1 || timers[0].Target != "1" {
+		t.Fatalf("Timers() = %+v, want one timer for light 1", timers)
+	}
+
+	waitFor(t, func() bool { return !fake.lightIsOn("light-1") && len(service.Timers()) == 0 })
+}
+
+func TestTurnOnLightForInvalidDuration(t *testing.T) {
+	t.Parallel()
+
+	service := newTestService(newFakeBridge())
+	for _, duration := range []time.Duration{0, -time.Second, 25 * time.Hour} {
+		if _, err := service.TurnOnLightFor(context.Background(), 1, duration); !errors.Is(err, ErrInvalidParameter) {
+			t.Fatalf("TurnOnLightFor(%s) error = %v, want ErrInvalidParameter", duration, err)
+		}
+	}
+}
+
+func TestTimerExtendsAndToggleCancels(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addRoom("room-1", "Garage", "grouped-1", false)
+	service := newTestService(fake)
+	service.timers = newTimerSet("")
+	ctx := context.Background()
+
+	if _, err := service.TurnOnRoomFor(ctx, "Garage", time.Hour); err != nil {
+		t.Fatalf("TurnOnRoomFor() error = %v, want nil", err)
+	}
+	first := service.Timers()[0].OffAt
+	if _, err := service.TurnOnRoomFor(ctx, "Garage", time.Minute); err != nil {
+		t.Fatalf("TurnOnRoomFor() error = %v, want nil", err)
+	}
+	if got := service.Timers()[0].OffAt; !got.Equal(first) {
+		t.Fatalf("shorter retrigger moved timer to %v, want %v", got, first)
+	}
+	if _, err := service.TurnOnRoomFor(ctx, "Garage", 2*time.Hour); err != nil {
+		t.Fatalf("TurnOnRoomFor() error = %v, want nil", err)
+	}
+	if got := service.Timers()[0].OffAt; !got.After(first) {
+		t.Fatalf("longer retrigger kept timer at %v, want after %v", got, first)
+	}
+
+	if _, err := service.ToggleLightsInRoom(ctx, "Garage"); err != nil {
+		t.Fatalf("ToggleLightsInRoom() error = %v, want nil", err)
+	}
+	if timers := service.Timers(); len(timers) != 0 {
+		t.Fatalf("Timers() after manual toggle = %+v, want none", timers)
+	}
+}
+
+func TestStaleTimerDoesNotSwitchOff(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-1", 1, "Stairs", false)
+	service := newTestService(fake)
+	service.timers = newTimerSet("")
+	ctx := context.Background()
+
+	if _, err := service.TurnOnLightFor(ctx, 1, time.Hour); err != nil {
+		t.Fatalf("TurnOnLightFor() error = %v, want nil", err)
+	}
+	service.timers.mu.Lock()
+	stale := service.timers.entries["light/1"]
+	service.timers.mu.Unlock()
+
+	// A re-trigger replaces the entry after the stale one already fired.
+	if _, err := service.TurnOnLightFor(ctx, 1, 2*time.Hour); err != nil {
+		t.Fatalf("TurnOnLightFor() error = %v, want nil", err)
+	}
+	service.timers.fire(service, stale)
+	if !fake.lightIsOn("light-1") || len(service.Timers()) != 1 {
+		t.Fatalf("light on = %v, timers = %+v, want the extended timer to keep the light on", fake.lightIsOn("light-1"), service.Timers())
+	}
+
+	// So does a cancelled one.
+	service.timers.mu.Lock()
+	current := service.timers.entries["light/1"]
+	service.timers.mu.Unlock()
+	service.timers.cancel("light", "1")
+	service.timers.fire(service, current)
+	if !fake.lightIsOn("light-1") {
+		t.Fatalf("light switched off by a cancelled timer")
+	}
+}
+
+func TestSetStateCancelsTimer(t *testing.T) {
+	t.Parallel()
+
+	on, off := true, false
+	brightness := 40.0
+	tests := []struct {
+		name       string
+		change     StateChange
+		wantTimers int
+	}{
+		{name: "switch on", change: StateChange{On: &on}},
+		{name: "switch off", change: StateChange{On: &off}},
+		{name: "toggle", change: StateChange{Toggle: true}},
+		{name: "brightness only", change: StateChange{Brightness: &brightness}, wantTimers: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			fake := newFakeBridge()
+			fake.addLight("light-1", 1, "Stairs", false)
+			fake.addRoom("room-1", "Garage", "grouped-1", false)
+			service := newTestService(fake)
+			service.timers = newTimerSet("")
+			ctx := context.Background()
+
+			if _, err := service.TurnOnLightFor(ctx, 1, time.Hour); err != nil {
+				t.Fatalf("TurnOnLightFor() error = %v, want nil", err)
+			}
+			if _, err := service.TurnOnRoomFor(ctx, "Garage", time.Hour); err != nil {
+				t.Fatalf("TurnOnRoomFor() error = %v, want nil", err)
+			}
+			if _, err := service.SetLightState(ctx, 1, tt.change); err != nil {
+				t.Fatalf("SetLightState() error = %v, want nil", err)
+			}
+			if _, err := service.SetRoomState(ctx, "room-1", tt.change); err != nil {
+				t.Fatalf("SetRoomState() error = %v, want nil", err)
+			}
+			if got := service.Timers(); len(got) != tt.wantTimers {
+				t.Fatalf("Timers() = %+v, want %d", got, tt.wantTimers)
+			}
+		})
+	}
+}
+
+func TestTimersPersist(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "timers.json")
+	fake := newFakeBridge()
+	fake.addLight("light-1", 1, "Stairs", false)
+	service := newTestService(fake)
+	service.timers = newTimerSet(path)
+
+	if _, err := service.TurnOnLightFor(context.Background(), 1, time.Hour); err != nil {
+		t.Fatalf("TurnOnLightFor() error = %v, want nil", err)
+	}
+	if err := service.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v, want nil", err)
+	}
+
+	saved, err := newTimerSet(path).load()
+	if err != nil || len(saved) != 1 || saved[0].TargetType != "light" || saved[0].Target != "1" {
+		t.Fatalf("load() = %+v, %v, want the light timer", saved, err)
+	}
+
+	// A timer that expired while hueshelly was down fires right after the restart.
+	saved[0].OffAt = time.Now().Add(-time.Minute)
+	restarted := newTestService(fake)
+	restarted.timers = newTimerSet(path)
+	restarted.timers.scheduleAt(restarted, saved[0])
+
+	waitFor(t, func() bool { return !fake.lightIsOn("light-1") && len(restarted.Timers()) == 0 })
+	if saved, err := newTimerSet(path).load(); err != nil || len(saved) != 0 {
+		t.Fatalf("load() after timer fired = %+v, %v, want none", saved, err)
+	}
+}
@@ -0,0 +1,44 @@
+package hue
+
+import (
+	"context"
+	"fmt"
+
+	"hueshelly/config"
+
+	"github.com/openhue/openhue-go"
+)
+
+// countsAsOn reports whether a toggle switches a group off. Zones and rooms
+// with the any-on policy count as on when any light is on; other rooms weigh
+// the states of their member lights by the room's toggle policy.
+func (service *Service) countsAsOn(ctx context.Context, kind string, group openhue.RoomGet, groupedLight *openhue.GroupedLightGet) (bool, error) {
+	if !groupedLight.IsOn() || kind != "room" {
+		return groupedLight.IsOn(), nil
+	}
+	policy := service.togglePolicies.Policy(nameFromRoom(group))
+	if policy == config.TogglePolicyAnyOn {
+		return true, nil
+	}
+
+	lights, err := service.getLights(ctx)
+	if err != nil {
+		return false, fmt.Errorf("get lights: %w", err)
+	}
+	total, on := 0, 0
+	for _, lightID := range service.lightIDsFromRoom(ctx, group) {
+		light, exists := lights[lightID]
+		if !exists {
+			continue
+		}
+		total++
+		if light.IsOn() {
+			on++
+		}
+	}
+
+	if policy == config.TogglePolicyMajority {
+		return on*2 > total, nil
+	}
+	return on == total, nil
+}
@@ -0,0 +1,59 @@
+package hue
+
+import (
+	"context"
+	"testing"
+
+	"hueshelly/config"
+)
+
+func TestTogglePolicies(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		policy   string
+		lightsOn int
+		wantOn   bool
+	}{
+		{name: "any on switches off", policy: config.TogglePolicyAnyOn, lightsOn: 1, wantOn: false},
+		{name: "default is any on", lightsOn: 1, wantOn: false},
+		{name: "all on needs every light", policy: config.TogglePolicyAllOn, lightsOn: 2, wantOn: true},
+		{name: "all on switches off", policy: config.TogglePolicyAllOn, lightsOn: 3, wantOn: false},
+		{name: "minority switches on", policy: config.TogglePolicyMajority, lightsOn: 1, wantOn: true},
+		{name: "majority switches off", policy: config.TogglePolicyMajority, lightsOn: 2, wantOn: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			toggles := map[string]func(service *Service) (State, error){
+				"ToggleLightsInRoom": func(service *Service) (State, error) {
+					return service.ToggleLightsInRoom(context.Background(), "Kitchen")
+				},
+				"SetRoomState": func(service *Service) (State, error) {
+					return service.SetRoomState(context.Background(), "room-1", StateChange{Toggle: true})
+				},
+			}
+			for name, toggle := range toggles {
+				fake := newFakeBridge()
+				fake.addLight("light-1", 1, "Ceiling", tt.lightsOn >= 1)
+				fake.addLight("light-2", 2, "Counter", tt.lightsOn >= 2)
+				fake.addLight("light-3", 3, "Pendant", tt.lightsOn >= 3)
+				fake.addRoom("room-1", "Kitchen", "grouped-1", true, "light-1", "light-2", "light-3")
+				service := newTestService(fake)
+				if tt.policy != "" {
+					service.togglePolicies = config.TogglePolicies{Rooms: map[string]string{"Kitchen": tt.policy}}
+				}
+
+				state, err := toggle(service)
+				if err != nil {
+					t.Fatalf("%s() error = %v, want nil", name, err)
+				}
+				if state.On != tt.wantOn {
+					t.Fatalf("%s() on = %v, want %v", name, state.On, tt.wantOn)
+				}
+			}
+		})
+	}
+}
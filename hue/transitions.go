@@ -0,0 +1,108 @@
+package hue
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"hueshelly/config"
+
+	"github.com/openhue/openhue-go"
+)
+
+// transitionMs returns the transition in milliseconds sent with a state change
+// of a target: transition when given, otherwise the configured transition of
+// the target. It is nil when the bridge's default speed applies.
+func (service *Service) transitionMs(targetType, target string, transition *time.Duration) *int {
+	if transition == nil {
+		configured := service.transitions.Default
+		switch targetType {
+		case "light":
+			if light, exists := service.transitions.Lights[target]; exists {
+				configured = light
+			}
+		case "room":
+			if room, exists := service.transitions.Rooms[target]; exists {
+				configured = room
+			}
+		}
+		if configured <= 0 {
+			return nil
+		}
+		duration := configured.Duration()
+		transition = &duration
+	}
+	milliseconds := int(transition.Milliseconds())
+	return &milliseconds
+}
+
+func (service *Service) lightDynamics(lightID string, transition *time.Duration) *openhue.LightDynamics {
+	duration := service.transitionMs("light", lightID, transition)
+	if duration == nil {
+		return nil
+	}
+	return &openhue.LightDynamics{Duration: duration}
+}
+
+func (service *Service) groupDynamics(kind, name string, transition *time.Duration) *openhue.Dynamics {
+	duration := service.transitionMs(kind, name, transition)
+	if duration == nil {
+		return nil
+	}
+	return &openhue.Dynamics{Duration: duration}
+}
+
+// lightDynamicsOf applies the transition of a room or zone to its member lights.
+func lightDynamicsOf(dynamics *openhue.Dynamics) *openhue.LightDynamics {
+	if dynamics == nil {
+		return nil
+	}
+	return &openhue.LightDynamics{Duration: dynamics.Duration}
+}
+
+// FadeOffLight switches a light off slowly, over the given duration or the
+// configured fade-off time when over is 0. It cancels the light's auto-off timer.
+func (service *Service) FadeOffLight(ctx context.Context, lightID int, over time.Duration) (State, error) {
+	change, err := service.fadeOffChange(over)
+	if err != nil {
+		return State{}, err
+	}
+	service.timers.cancel("light", strconv.Itoa(lightID))
+	return service.SetLightState(ctx, lightID, change)
+}
+
+// FadeOffRoom switches the lights of a room off slowly, over the given duration
+// or the configured fade-off time when over is 0. It cancels the room's auto-off timer.
+func (service *Service) FadeOffRoom(ctx context.Context, roomName string, over time.Duration) (State, error) {
+	change, err := service.fadeOffChange(over)
+	if err != nil {
+		return State{}, err
+	}
+	if strings.TrimSpace(roomName) == "" {
+		return State{}, errorf(ErrInvalidParameter, "room name must not be empty")
+	}
+	id, err := service.RoomID(ctx, roomName)
+	if err != nil {
+		return State{}, err
+	}
+	service.timers.cancel("room", roomName)
+	state, err := service.SetRoomState(ctx, id, change)
+	if err != nil {
+		return State{}, err
+	}
+	state.Target = roomName
+	return state, nil
+}
+
+func (service *Service) fadeOffChange(over time.Duration) (StateChange, error) {
+	if over == 0 {
+		over = service.transitions.FadeOff.Duration()
+	}
+	if over <= 0 || over > config.MaxTransition {
+		return StateChange{}, errorf(ErrInvalidParameter, "fade-off duration must be between 0 and %s, got %s", config.MaxTransition, over)
+	}
+	off := false
+	transition := config.Duration(over)
+	return StateChange{On: &off, Transition: &transition}, nil
+}
@@ -0,0 +1,87 @@
+package hue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"hueshelly/config"
+)
+
+func TestToggleTransitions(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-1", 3, "Bedside", false)
+	fake.addLight("light-2", 4, "Desk", false)
+	fake.addRoom("room-1", "Bedroom", "grouped-1", true)
+	service := newTestService(fake)
+	service.transitions = config.Transitions{
+		Default: config.Duration(400 * time.Millisecond),
+		Rooms:   map[string]config.Duration{"Bedroom": config.Duration(2 * time.Second)},
+	}
+
+	if _, err := service.ToggleLight(context.Background(), 3); err != nil {
+		t.Fatalf("ToggleLight() error = %v, want nil", err)
+	}
+	instant := time.Duration(0)
+	if _, err := service.ToggleLightWith(context.Background(), 4, ToggleOptions{Transition: &instant}); err != nil {
+		t.Fatalf("ToggleLightWith() error = %v, want nil", err)
+	}
+	if _, err := service.ToggleLightsInRoom(context.Background(), "Bedroom"); err != nil {
+		t.Fatalf("ToggleLightsInRoom() error = %v, want nil", err)
+	}
+
+	tests := []struct {
+		name     string
+		duration *int
+		want     int
+	}{
+		{name: "default", duration: fake.lightUpdates[0].body.Dynamics.Duration, want: 400},
+		{name: "override", duration: fake.lightUpdates[1].body.Dynamics.Duration, want: 0},
+		{name: "room", duration: fake.groupedLightUpdates[0].body.Dynamics.Duration, want: 2000},
+	}
+	for _, tt := range tests {
+		if tt.duration == nil || *tt.duration != tt.want {
+			t.Fatalf("%s: transition = %v, want %d ms", tt.name, tt.duration, tt.want)
+		}
+	}
+
+	tooLong := 2 * time.Hour
+	if _, err := service.ToggleLightWith(context.Background(), 3, ToggleOptions{Transition: &tooLong}); !errors.Is(err, ErrInvalidParameter) {
+		t.Fatalf("ToggleLightWith() error = %v, want ErrInvalidParameter", err)
+	}
+}
+
+func TestFadeOff(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeBridge()
+	fake.addLight("light-1", 3, "Bedside", true)
+	fake.addRoom("room-1", "Bedroom", "grouped-1", true)
+	service := newTestService(fake)
+	service.transitions = config.Transitions{FadeOff: config.Duration(time.Minute)}
+
+	state, err := service.FadeOffRoom(context.Background(), "Bedroom", 0)
+	if err != nil {
+		t.Fatalf("FadeOffRoom() error = %v, want nil", err)
+	}
+	if state.On || state.Target != "Bedroom" {
+		t.Fatalf("FadeOffRoom() = %+v, want Bedroom off", state)
+	}
+	body := fake.groupedLightUpdates[0].body
+	if *body.On.On || body.Dynamics == nil || *body.Dynamics.Duration != 60000 {
+		t.Fatalf("grouped light update = %#v, want off over 60000 ms", body)
+	}
+
+	if _, err := service.FadeOffLight(context.Background(), 3, 10*time.Second); err != nil {
+		t.Fatalf("FadeOffLight() error = %v, want nil", err)
+	}
+	if duration := fake.lightUpdates[0].body.Dynamics.Duration; *duration != 10000 {
+		t.Fatalf("light transition = %d ms, want 10000", *duration)
+	}
+	if _, err := service.FadeOffLight(context.Background(), 3, 2*time.Hour); !errors.Is(err, ErrInvalidParameter) {
+		t.Fatalf("FadeOffLight() error = %v, want ErrInvalidParameter", err)
+	}
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	// Embedded zone data lets the configured timezone work on systems without zoneinfo.
+	_ "time/tzdata"
 
 	"hueshelly/config"
 	huehttp "hueshelly/http"
@@ -22,23 +28,55 @@ func main() {
 		}
 	}()
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	cfg, err := config.Load("config.json")
 	if err != nil {
 		logging.Logger.Fatal(err)
 	}
 
-	hueService, err := hue.New(cfg)
+	hueService, err := hue.New(ctx, cfg)
 	if err != nil {
 		logging.Logger.Fatal(err)
 	}
 
-	handler, err := huehttp.New(hueService)
+	handler, err := huehttp.New(hueService, cfg)
 	if err != nil {
 		logging.Logger.Fatal(err)
 	}
 
-	address := fmt.Sprintf(":%d", cfg.ServerPort)
-	if err := handler.Start(address); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		logging.Logger.Fatal(err)
+	serverErr := make(chan error, 2)
+	if !cfg.TLS.DisableHTTP {
+		address := fmt.Sprintf(":%d", cfg.ServerPort)
+		go func() {
+			serverErr <- handler.Start(address)
+		}()
+	}
+	if cfg.TLS.Port > 0 {
+		address := fmt.Sprintf(":%d", cfg.TLS.Port)
+		go func() {
+			serverErr <- handler.StartTLS(address)
+		}()
+	}
+
+	select {
+	case err := <-serverErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Logger.Fatal(err)
+		}
+	case <-ctx.Done():
+		logging.Logger.Println("Received shutdown signal")
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout.Duration())
+	defer cancel()
+	if err := handler.Shutdown(shutdownCtx); err != nil {
+		logging.Logger.Println(err)
+	}
+	if err := hueService.Close(shutdownCtx); err != nil {
+		logging.Logger.Println(err)
 	}
+	logging.Logger.Println("Shutdown complete")
 }
@@ -0,0 +1,64 @@
+package metrics
+
+// Metrics exported by hueshelly. They live in one place so the HTTP and hue
+// packages share the same names and label sets.
+var (
+	HTTPRequests = NewCounterVec(
+		"hueshelly_http_requests_total",
+		"HTTP requests handled, partitioned by route, method and status code.",
+		"route", "method", "status",
+	)
+	HTTPRequestDuration = NewHistogramVec(
+		"hueshelly_http_request_duration_seconds",
+		"Time spent handling HTTP requests, partitioned by route.",
+		DefaultBuckets,
+		"route",
+	)
+	BridgeCalls = NewCounterVec(
+		"hueshelly_bridge_calls_total",
+		"Calls made to the Hue bridge, partitioned by operation and outcome.",
+		"operation", "outcome",
+	)
+	BridgeCallDuration = NewHistogramVec(
+		"hueshelly_bridge_call_duration_seconds",
+		"Latency of calls made to the Hue bridge, partitioned by operation.",
+		DefaultBuckets,
+		"operation",
+	)
+	BridgeRetries = NewCounterVec(
+		"hueshelly_bridge_retries_total",
+		"Retries of bridge calls after transient failures, partitioned by operation.",
+		"operation",
+	)
+	BridgeCommandsCoalesced = NewCounterVec(
+		"hueshelly_bridge_commands_coalesced_total",
+		"Queued bridge commands replaced by a newer command for the same target, partitioned by kind.",
+		"kind",
+	)
+	BridgeCommandsRejected = NewCounterVec(
+		"hueshelly_bridge_commands_rejected_total",
+		"Bridge commands rejected because the command queue was full, partitioned by kind.",
+		"kind",
+	)
+	BridgeQueueWait = NewHistogramVec(
+		"hueshelly_bridge_queue_wait_seconds",
+		"Time bridge commands spent waiting for the rate limiter, partitioned by kind.",
+		DefaultBuckets,
+		"kind",
+	)
+	ToggleActions = NewCounterVec(
+		"hueshelly_toggle_actions_total",
+		"Toggle actions executed, partitioned by target type, target and resulting state.",
+		"target_type", "target", "state",
+	)
+	ToggleSuppressed = NewCounterVec(
+		"hueshelly_toggle_suppressed_total",
+		"Toggle requests dropped as duplicates, partitioned by target type and reason.",
+		"target_type", "reason",
+	)
+	RoutineRuns = NewCounterVec(
+		"hueshelly_routine_runs_total",
+		"Routine runs, partitioned by routine and outcome.",
+		"routine", "outcome",
+	)
+)
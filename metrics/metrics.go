@@ -0,0 +1,292 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"hueshelly/logging"
+)
+
+// DefaultBuckets are latency buckets in seconds suited for LAN requests to the bridge.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var defaultRegistry = NewRegistry()
+
+type collector interface {
+	write(writer *bufio.Writer)
+}
+
+// Registry holds collectors and renders them in the Prometheus text exposition format.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (registry *Registry) register(c collector) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.collectors = append(registry.collectors, c)
+}
+
+// WriteText writes all registered collectors in the Prometheus text format.
+func (registry *Registry) WriteText(writer io.Writer) error {
+	registry.mu.Lock()
+	collectors := append([]collector(nil), registry.collectors...)
+	registry.mu.Unlock()
+
+	buffered := bufio.NewWriter(writer)
+	for _, c := range collectors {
+		c.write(buffered)
+	}
+	return buffered.Flush()
+}
+
+// Handler serves the default registry.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.Method != http.MethodGet && request.Method != http.MethodHead {
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := defaultRegistry.WriteText(writer); err != nil {
+			logging.Logger.Println(fmt.Errorf("write metrics: %w", err))
+		}
+	})
+}
+
+// CounterVec is a monotonically increasing counter partitioned by labels.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+// NewCounterVec creates a counter and registers it in the default registry.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	counter := newCounterVec(name, help, labels...)
+	defaultRegistry.register(counter)
+	return counter
+}
+
+func newCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: map[string]*counterSeries{},
+	}
+}
+
+func (counter *CounterVec) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+func (counter *CounterVec) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+	key := seriesKey(counter.labels, labelValues)
+
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	series, exists := counter.values[key]
+	if !exists {
+		series = &counterSeries{labelValues: normalizeLabelValues(counter.labels, labelValues)}
+		counter.values[key] = series
+	}
+	series.value += value
+}
+
+// Value returns the current value of one series; it is mainly useful in tests.
+func (counter *CounterVec) Value(labelValues ...string) float64 {
+	key := seriesKey(counter.labels, labelValues)
+
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+	if series, exists := counter.values[key]; exists {
+		return series.value
+	}
+	return 0
+}
+
+func (counter *CounterVec) write(writer *bufio.Writer) {
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	writeHeader(writer, counter.name, counter.help, "counter")
+	for _, key := range sortedKeys(counter.values) {
+		series := counter.values[key]
+		fmt.Fprintf(writer, "%s%s %s\n", counter.name, formatLabels(counter.labels, series.labelValues, "", ""), formatValue(series.value))
+	}
+}
+
+// HistogramVec samples observations into cumulative buckets partitioned by labels.
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+// NewHistogramVec creates a histogram and registers it in the default registry.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	histogram := newHistogramVec(name, help, buckets, labels...)
+	defaultRegistry.register(histogram)
+	return histogram
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sortedBuckets := append([]float64(nil), buckets...)
+	sort.Float64s(sortedBuckets)
+	return &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: sortedBuckets,
+		values:  map[string]*histogramSeries{},
+	}
+}
+
+func (histogram *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := seriesKey(histogram.labels, labelValues)
+
+	histogram.mu.Lock()
+	defer histogram.mu.Unlock()
+	series, exists := histogram.values[key]
+	if !exists {
+		series = &histogramSeries{
+			labelValues: normalizeLabelValues(histogram.labels, labelValues),
+			counts:      make([]uint64, len(histogram.buckets)),
+		}
+		histogram.values[key] = series
+	}
+	for i, upperBound := range histogram.buckets {
+		if value <= upperBound {
+			series.counts[i]++
+		}
+	}
+	series.sum += value
+	series.count++
+}
+
+func (histogram *HistogramVec) write(writer *bufio.Writer) {
+	histogram.mu.Lock()
+	defer histogram.mu.Unlock()
+
+	writeHeader(writer, histogram.name, histogram.help, "histogram")
+	for _, key := range sortedKeys(histogram.values) {
+		series := histogram.values[key]
+		for i, upperBound := range histogram.buckets {
+			fmt.Fprintf(writer, "%s_bucket%s %d\n", histogram.name, formatLabels(histogram.labels, series.labelValues, "le", formatValue(upperBound)), series.counts[i])
+		}
+		fmt.Fprintf(writer, "%s_bucket%s %d\n", histogram.name, formatLabels(histogram.labels, series.labelValues, "le", "+Inf"), series.count)
+		fmt.Fprintf(writer, "%s_sum%s %s\n", histogram.name, formatLabels(histogram.labels, series.labelValues, "", ""), formatValue(series.sum))
+		fmt.Fprintf(writer, "%s_count%s %d\n", histogram.name, formatLabels(histogram.labels, series.labelValues, "", ""), series.count)
+	}
+}
+
+func writeHeader(writer *bufio.Writer, name, help, metricType string) {
+	fmt.Fprintf(writer, "# HELP %s %s\n", name, escapeHelp(help))
+	fmt.Fprintf(writer, "# TYPE %s %s\n", name, metricType)
+}
+
+func normalizeLabelValues(labels []string, labelValues []string) []string {
+	values := make([]string, len(labels))
+	copy(values, labelValues)
+	return values
+}
+
+func seriesKey(labels []string, labelValues []string) string {
+	return strings.Join(normalizeLabelValues(labels, labelValues), "\xff")
+}
+
+func sortedKeys[T any](values map[string]T) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatLabels(labels []string, labelValues []string, extraName, extraValue string) string {
+	if len(labels) == 0 && extraName == "" {
+		return ""
+	}
+
+	var builder strings.Builder
+	builder.WriteByte('{')
+	for i, label := range labels {
+		if i > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(label)
+		builder.WriteString(`="`)
+		builder.WriteString(escapeLabelValue(labelValues[i]))
+		builder.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(labels) > 0 {
+			builder.WriteByte(',')
+		}
+		builder.WriteString(extraName)
+		builder.WriteString(`="`)
+		builder.WriteString(extraValue)
+		builder.WriteByte('"')
+	}
+	builder.WriteByte('}')
+	return builder.String()
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpReplacer.Replace(help)
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCounterVecWriteText(t *testing.T) {
+	t.Parallel()
+
+	registry := NewRegistry()
+	counter := newCounterVec("test_requests_total", "Requests handled.", "route", "status")
+	registry.register(counter)
+
+	counter.Inc("/toggle/light/", "204")
+	counter.Inc("/toggle/light/", "204")
+	counter.Inc("/groups", "500")
+
+	var output bytes.Buffer
+	if err := registry.WriteText(&output); err != nil {
+		t.Fatalf("WriteText() error = %v, want nil", err)
+	}
+
+	want := `# HELP test_requests_total Requests handled.
+# TYPE test_requests_total counter
+test_requests_total{route="/groups",status="500"} 1
+test_requests_total{route="/toggle/light/",status="204"} 2
+`
+	if output.String() != want {
+		t.Fatalf("WriteText() = %q, want %q", output.String(), want)
+	}
+	if got := counter.Value("/toggle/light/", "204"); got != 2 {
+		t.Fatalf("Value() = %v, want %v", got, 2)
+	}
+}
+
+func TestHistogramVecWriteText(t *testing.T) {
+	t.Parallel()
+
+	registry := NewRegistry()
+	histogram := newHistogramVec("test_duration_seconds", "Durations.", []float64{1, 0.1}, "operation")
+	registry.register(histogram)
+
+	histogram.Observe(0.05, "get_lights")
+	histogram.Observe(0.5, "get_lights")
+	histogram.Observe(3, "get_lights")
+
+	var output bytes.Buffer
+	if err := registry.WriteText(&output); err != nil {
+		t.Fatalf("WriteText() error = %v, want nil", err)
+	}
+
+	want := `# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{operation="get_lights",le="0.1"} 1
+test_duration_seconds_bucket{operation="get_lights",le="1"} 2
+test_duration_seconds_bucket{operation="get_lights",le="+Inf"} 3
+test_duration_seconds_sum{operation="get_lights"} 3.55
+test_duration_seconds_count{operation="get_lights"} 3
+`
+	if output.String() != want {
+		t.Fatalf("WriteText() = %q, want %q", output.String(), want)
+	}
+}
+
+func TestLabelValuesAreEscaped(t *testing.T) {
+	t.Parallel()
+
+	registry := NewRegistry()
+	counter := newCounterVec("test_total", "Escaping.", "target")
+	registry.register(counter)
+	counter.Inc("Living \"Room\"\\\n")
+
+	var output bytes.Buffer
+	if err := registry.WriteText(&output); err != nil {
+		t.Fatalf("WriteText() error = %v, want nil", err)
+	}
+
+	want := `test_total{target="Living \"Room\"\\\n"} 1`
+	if !strings.Contains(output.String(), want) {
+		t.Fatalf("WriteText() = %q, want it to contain %q", output.String(), want)
+	}
+}
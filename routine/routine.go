@@ -0,0 +1,279 @@
+// Package routine runs the named step lists configured under "routines".
+package routine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"hueshelly/config"
+	"hueshelly/hue"
+	"hueshelly/logging"
+	"hueshelly/metrics"
+)
+
+const urlStepTimeout = 10 * time.Second
+
+// ErrUnknownRoutine is returned for names that are not configured.
+var ErrUnknownRoutine = errors.New("unknown routine")
+
+var errRunnerClosed = errors.New("routine runner is shut down")
+
+// service is the part of hue.Service used by routines.
+type service interface {
+	RoomID(ctx context.Context, name string) (string, error)
+	ZoneID(ctx context.Context, name string) (string, error)
+	SetRoomState(ctx context.Context, id string, change hue.StateChange) (hue.State, error)
+	SetZoneState(ctx context.Context, id string, change hue.StateChange) (hue.State, error)
+	SetLightState(ctx context.Context, lightID int, change hue.StateChange) (hue.State, error)
+	SceneID(ctx context.Context, groupID, scene string) (string, error)
+	RecallScene(ctx context.Context, sceneID, action string) (hue.State, error)
+}
+
+// Runner runs routines independently of the request that triggered them, so a
+// client hanging up does not leave a routine half done.
+type Runner struct {
+	service  service
+	client   *http.Client
+	routines []config.Routine
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// Result reports a finished routine run.
+type Result struct {
+	Routine    string       `json:"routine"`
+	OK         bool         `json:"ok"`
+	Steps      []StepResult `json:"steps"`
+	DurationMs int64        `json:"durationMs"`
+}
+
+// StepResult reports one step. Steps after a failed step are skipped unless the
+// routine continues on errors.
+type StepResult struct {
+	Index   int        `json:"index"`
+	Action  string     `json:"action"`
+	Target  string     `json:"target,omitempty"`
+	OK      bool       `json:"ok"`
+	Skipped bool       `json:"skipped,omitempty"`
+	State   *hue.State `json:"state,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+// New creates a runner for the configured routines.
+func New(hueService *hue.Service, routines []config.Routine) *Runner {
+	return newRunner(hueService, routines)
+}
+
+func newRunner(hueService service, routines []config.Routine) *Runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{
+		service:  hueService,
+		client:   &http.Client{Timeout: urlStepTimeout},
+		routines: routines,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Routines returns the configured routines in config order.
+func (runner *Runner) Routines() []config.Routine {
+	return runner.routines
+}
+
+// Routine returns the routine with the given name.
+func (runner *Runner) Routine(name string) (config.Routine, bool) {
+	for _, routine := range runner.routines {
+		if routine.Name == name {
+			return routine, true
+		}
+	}
+	return config.Routine{}, false
+}
+
+// Start runs the routine in the background. The returned channel receives the
+// result once the routine finished.
+func (runner *Runner) Start(name string) (<-chan Result, error) {
+	routine, ok := runner.Routine(name)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownRoutine, name)
+	}
+	return runner.StartRoutine(routine)
+}
+
+// StartRoutine runs a routine that need not be configured, such as the single
+// action of a schedule, in the background.
+func (runner *Runner) StartRoutine(routine config.Routine) (<-chan Result, error) {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	if runner.closed {
+		return nil, errRunnerClosed
+	}
+
+	done := make(chan Result, 1)
+	runner.wg.Go(func() {
+		done <- runner.run(runner.ctx, routine)
+	})
+	return done, nil
+}
+
+// Close cancels running routines and waits for them until ctx expires.
+func (runner *Runner) Close(ctx context.Context) error {
+	runner.mu.Lock()
+	runner.closed = true
+	runner.mu.Unlock()
+	runner.cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		runner.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("wait for routines: %w", ctx.Err())
+	}
+}
+
+func (runner *Runner) run(ctx context.Context, routine config.Routine) Result {
+	started := time.Now()
+	result := Result{Routine: routine.Name, OK: true, Steps: make([]StepResult, len(routine.Steps))}
+	for i, step := range routine.Steps {
+		stepResult := StepResult{Index: i, Action: step.Action, Target: step.Target()}
+		if !result.OK && !routine.ContinueOnError {
+			stepResult.Skipped = true
+			result.Steps[i] = stepResult
+			continue
+		}
+
+		state, err := runner.runStep(ctx, step)
+		switch {
+		case err != nil:
+			result.OK = false
+			stepResult.Error = err.Error()
+			logging.Logger.Printf("routine %q step %d (%s): %v", routine.Name, i, step.Action, err)
+		default:
+			stepResult.OK = true
+			stepResult.State = state
+		}
+		result.Steps[i] = stepResult
+	}
+	result.DurationMs = time.Since(started).Milliseconds()
+
+	outcome := "ok"
+	if !result.OK {
+		outcome = "failed"
+	}
+	metrics.RoutineRuns.Inc(routine.Name, outcome)
+	return result
+}
+
+// runStep executes a single step. It returns the resulting state for steps that change lights.
+func (runner *Runner) runStep(ctx context.Context, step config.RoutineStep) (*hue.State, error) {
+	switch step.Action {
+	case config.RoutineActionDelay:
+		return nil, sleep(ctx, step.Delay.Duration())
+	case config.RoutineActionURL:
+		return nil, runner.callURL(ctx, step)
+	}
+
+	var state hue.State
+	var err error
+	if step.Light != 0 {
+		state, err = runner.service.SetLightState(ctx, step.Light, stateChange(step))
+		return stateOrNil(state, err)
+	}
+
+	groupID, err := runner.groupID(ctx, step)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case step.Action == config.RoutineActionScene:
+		sceneID, err := runner.service.SceneID(ctx, groupID, step.Scene)
+		if err != nil {
+			return nil, err
+		}
+		state, err = runner.service.RecallScene(ctx, sceneID, "")
+	case step.Zone != "":
+		state, err = runner.service.SetZoneState(ctx, groupID, stateChange(step))
+	default:
+		state, err = runner.service.SetRoomState(ctx, groupID, stateChange(step))
+	}
+	return stateOrNil(state, err)
+}
+
+func (runner *Runner) groupID(ctx context.Context, step config.RoutineStep) (string, error) {
+	if step.Zone != "" {
+		return runner.service.ZoneID(ctx, step.Zone)
+	}
+	return runner.service.RoomID(ctx, step.Room)
+}
+
+func (runner *Runner) callURL(ctx context.Context, step config.RoutineStep) error {
+	method := step.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	request, err := http.NewRequestWithContext(ctx, method, step.URL, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+
+	response, err := runner.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("call %s: %w", step.URL, err)
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("call %s: unexpected status %s", step.URL, response.Status)
+	}
+	return nil
+}
+
+func stateChange(step config.RoutineStep) hue.StateChange {
+	var transition *config.Duration
+	if step.Transition > 0 {
+		transition = &step.Transition
+	}
+	switch step.Action {
+	case config.RoutineActionOff:
+		on := false
+		return hue.StateChange{On: &on, Transition: transition}
+	case config.RoutineActionToggle:
+		return hue.StateChange{Toggle: true, Transition: transition}
+	default:
+		on := true
+		return hue.StateChange{On: &on, Brightness: step.Brightness, Transition: transition}
+	}
+}
+
+func stateOrNil(state hue.State, err error) (*hue.State, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,169 @@
+package routine
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"hueshelly/config"
+	"hueshelly/hue"
+)
+
+type fakeService struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (service *fakeService) record(call string) {
+	service.mu.Lock()
+	defer service.mu.Unlock()
+	service.calls = append(service.calls, call)
+}
+
+func (service *fakeService) RoomID(ctx context.Context, name string) (string, error) {
+	if name == "Missing" {
+		return "", errors.New("room not found")
+	}
+	return "room-" + name, nil
+}
+
+func (service *fakeService) ZoneID(ctx context.Context, name string) (string, error) {
+	return "zone-" + name, nil
+}
+
+func (service *fakeService) SetRoomState(ctx context.Context, id string, change hue.StateChange) (hue.State, error) {
+	service.record("room " + id)
+	return hue.State{TargetType: "room", Target: id, On: change.On != nil && *change.On}, nil
+}
+
+func (service *fakeService) SetZoneState(ctx context.Context, id string, change hue.StateChange) (hue.State, error) {
+	service.record("zone " + id)
+	return hue.State{TargetType: "zone", Target: id}, nil
+}
+
+func (service *fakeService) SetLightState(ctx context.Context, lightID int, change hue.StateChange) (hue.State, error) {
+	service.record("light")
+	return hue.State{TargetType: "light"}, nil
+}
+
+func (service *fakeService) SceneID(ctx context.Context, groupID, scene string) (string, error) {
+	return groupID + "/" + scene, nil
+}
+
+func (service *fakeService) RecallScene(ctx context.Context, sceneID, action string) (hue.State, error) {
+	service.record("scene " + sceneID)
+	return hue.State{TargetType: "scene", Target: sceneID, On: true}, nil
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	var called bool
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		called = request.Method == http.MethodPost
+	}))
+	defer server.Close()
+
+	service := &fakeService{}
+	runner := newRunner(service, []config.Routine{{Name: "movie", Steps: []config.RoutineStep{
+		{Action: config.RoutineActionScene, Room: "Living", Scene: "Relax"},
+		{Action: config.RoutineActionDelay, Delay: config.Duration(time.Millisecond)},
+		{Action: config.RoutineActionOff, Zone: "Upstairs"},
+		{Action: config.RoutineActionURL, URL: server.URL, Method: http.MethodPost},
+	}}})
+
+	done, err := runner.Start("movie")
+	if err != nil {
+		t.Fatalf("Start() error = %v, want nil", err)
+	}
+	result := <-done
+
+	if !result.OK {
+		t.Fatalf("Run() result = %+v, want ok", result)
+	}
+	wantCalls := []string{"scene room-Living/Relax", "zone zone-Upstairs"}
+	if !slices.Equal(service.calls, wantCalls) {
+		t.Fatalf("service calls = %v, want %v", service.calls, wantCalls)
+	}
+	if !called {
+		t.Fatalf("url step did not POST to the test server")
+	}
+}
+
+func TestRunStopsAtFailedStep(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		continueOnError bool
+		wantCalls       []string
+		wantSkipped     bool
+	}{
+		{name: "stop", wantSkipped: true},
+		{name: "continue", continueOnError: true, wantCalls: []string{"room room-Hall"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			service := &fakeService{}
+			runner := newRunner(service, nil)
+			result := runner.run(context.Background(), config.Routine{
+				Name:            "leave",
+				ContinueOnError: tt.continueOnError,
+				Steps: []config.RoutineStep{
+					{Action: config.RoutineActionOff, Room: "Missing"},
+					{Action: config.RoutineActionOff, Room: "Hall"},
+				},
+			})
+
+			if result.OK || result.Steps[0].Error == "" {
+				t.Fatalf("run() result = %+v, want first step failed", result)
+			}
+			if result.Steps[1].Skipped != tt.wantSkipped {
+				t.Fatalf("run() second step skipped = %v, want %v", result.Steps[1].Skipped, tt.wantSkipped)
+			}
+			if !slices.Equal(service.calls, tt.wantCalls) {
+				t.Fatalf("service calls = %v, want %v", service.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestStartUnknownRoutine(t *testing.T) {
+	t.Parallel()
+
+	runner := newRunner(&fakeService{}, nil)
+	if _, err := runner.Start("missing"); !errors.Is(err, ErrUnknownRoutine) {
+		t.Fatalf("Start() error = %v, want %v", err, ErrUnknownRoutine)
+	}
+}
+
+func TestCloseCancelsRunningRoutines(t *testing.T) {
+	t.Parallel()
+
+	runner := newRunner(&fakeService{}, []config.Routine{{Name: "slow", Steps: []config.RoutineStep{
+		{Action: config.RoutineActionDelay, Delay: config.Duration(time.Hour)},
+	}}})
+	done, err := runner.Start("slow")
+	if err != nil {
+		t.Fatalf("Start() error = %v, want nil", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := runner.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v, want nil", err)
+	}
+	if result := <-done; result.OK {
+		t.Fatalf("canceled routine result = %+v, want failed", result)
+	}
+	if _, err := runner.Start("slow"); !errors.Is(err, errRunnerClosed) {
+		t.Fatalf("Start() after Close error = %v, want %v", err, errRunnerClosed)
+	}
+}
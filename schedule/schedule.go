@@ -0,0 +1,323 @@
+// Package schedule runs routines and single actions at the times of the cron
+// expressions and sun-relative times configured under "schedules".
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"hueshelly/config"
+	"hueshelly/cron"
+	"hueshelly/logging"
+	"hueshelly/routine"
+	"hueshelly/sun"
+)
+
+const (
+	upcomingRuns = 3
+	// maxSleep makes the scheduler look at the wall clock at least once a
+	// minute, so it notices when the system clock was changed or resumed from sleep.
+	maxSleep = time.Minute
+)
+
+// ErrUnknownSchedule is returned for names that are not configured.
+var ErrUnknownSchedule = errors.New("unknown schedule")
+
+// trigger computes the next run of a schedule: a cron.Schedule or a sun.Trigger.
+type trigger interface {
+	Next(after time.Time, location *time.Location) time.Time
+}
+
+// starter is the part of routine.Runner used by the scheduler.
+type starter interface {
+	Start(name string) (<-chan routine.Result, error)
+	StartRoutine(routine config.Routine) (<-chan routine.Result, error)
+}
+
+// Scheduler runs schedules in a time zone. Pausing and resuming only lasts
+// until the next restart.
+type Scheduler struct {
+	runner   starter
+	location *time.Location
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries []*entry
+
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	started  bool
+	stopOnce sync.Once
+}
+
+type entry struct {
+	config  config.Schedule
+	trigger trigger
+	paused  bool
+	next    time.Time
+	lastRun *Run
+}
+
+// Run is the outcome of a scheduled run.
+type Run struct {
+	At    time.Time `json:"at"`
+	OK    bool      `json:"ok"`
+	Error string    `json:"error,omitempty"`
+}
+
+// Status describes a schedule and its next runs.
+type Status struct {
+	Name     string              `json:"name"`
+	Cron     string              `json:"cron,omitempty"`
+	At       string              `json:"at,omitempty"`
+	Routine  string              `json:"routine,omitempty"`
+	Action   *config.RoutineStep `json:"action,omitempty"`
+	Paused   bool                `json:"paused"`
+	Upcoming []time.Time         `json:"upcoming"`
+	LastRun  *Run                `json:"lastRun,omitempty"`
+}
+
+// New creates a scheduler for the configured schedules. Call Start to run it.
+func New(runner *routine.Runner, cfg config.Config) (*Scheduler, error) {
+	location, err := cfg.Location()
+	if err != nil {
+		return nil, err
+	}
+	return newScheduler(runner, cfg.Schedules, cfg.Coordinates, location, time.Now)
+}
+
+func newScheduler(runner starter, schedules []config.Schedule, coordinates *config.Coordinates, location *time.Location, now func() time.Time) (*Scheduler, error) {
+	scheduler := &Scheduler{
+		runner:   runner,
+		location: location,
+		now:      now,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	started := now()
+	for _, schedule := range schedules {
+		trigger, err := newTrigger(schedule, coordinates)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", schedule.Name, err)
+		}
+		scheduler.entries = append(scheduler.entries, &entry{
+			config:  schedule,
+			trigger: trigger,
+			paused:  !schedule.IsEnabled(),
+			next:    trigger.Next(started, location),
+		})
+	}
+	return scheduler, nil
+}
+
+func newTrigger(schedule config.Schedule, coordinates *config.Coordinates) (trigger, error) {
+	if schedule.At == "" {
+		return cron.Parse(schedule.Cron)
+	}
+	if coordinates == nil {
+		return nil, errors.New("sun-relative schedules need coordinates")
+	}
+	return sun.ParseTrigger(schedule.At, coordinates.Latitude, coordinates.Longitude)
+}
+
+// Start runs due schedules in the background until Close is called. It does
+// nothing when no schedules are configured.
+func (scheduler *Scheduler) Start() {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+	if scheduler.started || len(scheduler.entries) == 0 {
+		return
+	}
+	scheduler.started = true
+	go scheduler.loop()
+}
+
+// Close stops the scheduler and waits for it until ctx expires. Routines that
+// already started are stopped by the routine runner.
+func (scheduler *Scheduler) Close(ctx context.Context) error {
+	scheduler.stopOnce.Do(func() { close(scheduler.stop) })
+
+	scheduler.mu.Lock()
+	started := scheduler.started
+	scheduler.mu.Unlock()
+	if !started {
+		return nil
+	}
+	select {
+	case <-scheduler.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("wait for scheduler: %w", ctx.Err())
+	}
+}
+
+func (scheduler *Scheduler) loop() {
+	defer close(scheduler.done)
+	for {
+		timer := time.NewTimer(scheduler.sleep())
+		select {
+		case <-timer.C:
+			scheduler.runDue(scheduler.now())
+		case <-scheduler.wake:
+		case <-scheduler.stop:
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+}
+
+// sleep returns how long to wait for the next run.
+func (scheduler *Scheduler) sleep() time.Duration {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	now := scheduler.now()
+	sleep := maxSleep
+	for _, entry := range scheduler.entries {
+		if !entry.paused && !entry.next.IsZero() {
+			sleep = min(sleep, entry.next.Sub(now))
+		}
+	}
+	return max(sleep, 0)
+}
+
+// runDue starts every active schedule whose next run is not after now. A run
+// missed while the system was asleep is made up once, not once per missed time.
+func (scheduler *Scheduler) runDue(now time.Time) {
+	scheduler.mu.Lock()
+	var due []*entry
+	for _, entry := range scheduler.entries {
+		if entry.paused || entry.next.IsZero() || entry.next.After(now) {
+			continue
+		}
+		entry.next = entry.trigger.Next(now, scheduler.location)
+		due = append(due, entry)
+	}
+	scheduler.mu.Unlock()
+
+	for _, entry := range due {
+		scheduler.run(entry, now)
+	}
+}
+
+func (scheduler *Scheduler) run(entry *entry, at time.Time) {
+	logging.Logger.Printf("Running schedule %q", entry.config.Name)
+
+	var done <-chan routine.Result
+	var err error
+	if entry.config.Action != nil {
+		done, err = scheduler.runner.StartRoutine(config.Routine{
+			Name:  "schedule:" + entry.config.Name,
+			Steps: []config.RoutineStep{*entry.config.Action},
+		})
+	} else {
+		done, err = scheduler.runner.Start(entry.config.Routine)
+	}
+	if err != nil {
+		scheduler.record(entry, Run{At: at, Error: err.Error()})
+		return
+	}
+
+	go func() {
+		result := <-done
+		run := Run{At: at, OK: result.OK}
+		for _, step := range result.Steps {
+			if step.Error != "" {
+				run.Error = fmt.Sprintf("step %d (%s): %s", step.Index, step.Action, step.Error)
+				break
+			}
+		}
+		scheduler.record(entry, run)
+	}()
+}
+
+func (scheduler *Scheduler) record(entry *entry, run Run) {
+	if !run.OK {
+		logging.Logger.Printf("Schedule %q failed: %s", entry.config.Name, run.Error)
+	}
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+	entry.lastRun = &run
+}
+
+// Statuses returns all schedules in config order.
+func (scheduler *Scheduler) Statuses() []Status {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	statuses := make([]Status, 0, len(scheduler.entries))
+	for _, entry := range scheduler.entries {
+		statuses = append(statuses, scheduler.statusLocked(entry))
+	}
+	return statuses
+}
+
+// Schedule returns the configuration of the named schedule.
+func (scheduler *Scheduler) Schedule(name string) (config.Schedule, bool) {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	for _, entry := range scheduler.entries {
+		if entry.config.Name == name {
+			return entry.config, true
+		}
+	}
+	return config.Schedule{}, false
+}
+
+// Pause stops a schedule from running until it is resumed.
+func (scheduler *Scheduler) Pause(name string) (Status, error) {
+	return scheduler.setPaused(name, true)
+}
+
+// Resume reactivates a paused schedule. Runs missed while it was paused are skipped.
+func (scheduler *Scheduler) Resume(name string) (Status, error) {
+	return scheduler.setPaused(name, false)
+}
+
+func (scheduler *Scheduler) setPaused(name string, paused bool) (Status, error) {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	for _, entry := range scheduler.entries {
+		if entry.config.Name != name {
+			continue
+		}
+		if entry.paused && !paused {
+			entry.next = entry.trigger.Next(scheduler.now(), scheduler.location)
+		}
+		entry.paused = paused
+		select {
+		case scheduler.wake <- struct{}{}:
+		default:
+		}
+		return scheduler.statusLocked(entry), nil
+	}
+	return Status{}, fmt.Errorf("%w %q", ErrUnknownSchedule, name)
+}
+
+func (scheduler *Scheduler) statusLocked(entry *entry) Status {
+	status := Status{
+		Name:     entry.config.Name,
+		Cron:     entry.config.Cron,
+		At:       entry.config.At,
+		Routine:  entry.config.Routine,
+		Action:   entry.config.Action,
+		Paused:   entry.paused,
+		Upcoming: []time.Time{},
+		LastRun:  entry.lastRun,
+	}
+	if entry.paused {
+		return status
+	}
+	for next := entry.next; !next.IsZero() && len(status.Upcoming) < upcomingRuns; next = entry.trigger.Next(next, scheduler.location) {
+		status.Upcoming = append(status.Upcoming, next.In(scheduler.location))
+	}
+	return status
+}
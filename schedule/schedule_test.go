@@ -0,0 +1,157 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"hueshelly/config"
+	"hueshelly/routine"
+)
+
+type fakeStarter struct {
+	mu      sync.Mutex
+	started []string
+	result  routine.Result
+}
+
+func (starter *fakeStarter) Start(name string) (<-chan routine.Result, error) {
+	return starter.StartRoutine(config.Routine{Name: name})
+}
+
+func (starter *fakeStarter) StartRoutine(configured config.Routine) (<-chan routine.Result, error) {
+	starter.mu.Lock()
+	defer starter.mu.Unlock()
+	starter.started = append(starter.started, configured.Name)
+
+	done := make(chan routine.Result, 1)
+	done <- starter.result
+	return done, nil
+}
+
+func (starter *fakeStarter) names() []string {
+	starter.mu.Lock()
+	defer starter.mu.Unlock()
+	return append([]string(nil), starter.started...)
+}
+
+func newTestScheduler(t *testing.T, starter *fakeStarter, now time.Time, schedules ...config.Schedule) *Scheduler {
+	t.Helper()
+
+	scheduler, err := newScheduler(starter, schedules, &config.Coordinates{Latitude: 52.52, Longitude: 13.405}, time.UTC, func() time.Time { return now })
+	if err != nil {
+		t.Fatalf("newScheduler() error = %v, want nil", err)
+	}
+	return scheduler
+}
+
+func TestRunDue(t *testing.T) {
+	t.Parallel()
+
+	disabled := false
+	starter := &fakeStarter{result: routine.Result{OK: true}}
+	start := time.Date(2026, 6, 1, 6, 59, 30, 0, time.UTC)
+	scheduler := newTestScheduler(t, starter, start,
+		config.Schedule{Name: "morning", Cron: "0 7 * * *", Routine: "wake up"},
+		config.Schedule{Name: "porch", Cron: "0 * * * *", Action: &config.RoutineStep{Action: config.RoutineActionOn, Room: "Porch"}},
+		config.Schedule{Name: "party", Cron: "* * * * *", Routine: "party", Enabled: &disabled},
+		config.Schedule{Name: "evening", Cron: "0 20 * * *", Routine: "evening"},
+	)
+
+	scheduler.runDue(time.Date(2026, 6, 1, 7, 0, 0, 0, time.UTC))
+
+	names := starter.names()
+	if len(names) != 2 || names[0] != "wake up" || names[1] != "schedule:porch" {
+		t.Fatalf("started routines = %v, want [wake up schedule:porch]", names)
+	}
+	statuses := scheduler.Statuses()
+	if got, want := statuses[0].Upcoming[0], time.Date(2026, 6, 2, 7, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("morning next run = %v, want %v", got, want)
+	}
+	if !statuses[2].Paused || len(statuses[2].Upcoming) != 0 {
+		t.Fatalf("disabled schedule status = %+v, want paused without upcoming runs", statuses[2])
+	}
+	if len(statuses[3].Upcoming) != upcomingRuns {
+		t.Fatalf("evening upcoming = %v, want %d runs", statuses[3].Upcoming, upcomingRuns)
+	}
+}
+
+func TestRecordsLastRun(t *testing.T) {
+	t.Parallel()
+
+	starter := &fakeStarter{result: routine.Result{Steps: []routine.StepResult{{Index: 0, Action: "off", Error: "room not found"}}}}
+	now := time.Date(2026, 6, 1, 7, 0, 0, 0, time.UTC)
+	scheduler := newTestScheduler(t, starter, now.Add(-time.Minute), config.Schedule{Name: "morning", Cron: "0 7 * * *", Routine: "wake up"})
+
+	scheduler.runDue(now)
+
+	deadline := time.Now().Add(time.Second)
+	for scheduler.Statuses()[0].LastRun == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("last run was not recorded")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	lastRun := scheduler.Statuses()[0].LastRun
+	if lastRun.OK || lastRun.Error != "step 0 (off): room not found" || !lastRun.At.Equal(now) {
+		t.Fatalf("last run = %+v, want the failed run at %v", lastRun, now)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	t.Parallel()
+
+	starter := &fakeStarter{result: routine.Result{OK: true}}
+	now := time.Date(2026, 6, 1, 6, 0, 0, 0, time.UTC)
+	scheduler := newTestScheduler(t, starter, now, config.Schedule{Name: "morning", Cron: "0 7 * * *", Routine: "wake up"})
+
+	if status, err := scheduler.Pause("morning"); err != nil || !status.Paused {
+		t.Fatalf("Pause() = %+v, %v, want paused", status, err)
+	}
+	scheduler.runDue(now.Add(2 * time.Hour))
+	if names := starter.names(); len(names) != 0 {
+		t.Fatalf("paused schedule started %v, want nothing", names)
+	}
+
+	status, err := scheduler.Resume("morning")
+	if err != nil || status.Paused {
+		t.Fatalf("Resume() = %+v, %v, want active", status, err)
+	}
+	if got, want := status.Upcoming[0], time.Date(2026, 6, 1, 7, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Fatalf("next run after resume = %v, want %v", got, want)
+	}
+	if _, err := scheduler.Pause("missing"); !errors.Is(err, ErrUnknownSchedule) {
+		t.Fatalf("Pause() error = %v, want %v", err, ErrUnknownSchedule)
+	}
+}
+
+func TestStartClose(t *testing.T) {
+	t.Parallel()
+
+	scheduler := newTestScheduler(t, &fakeStarter{}, time.Now(), config.Schedule{Name: "hourly", Cron: "@hourly", Routine: "check"})
+	scheduler.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := scheduler.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v, want nil", err)
+	}
+}
+
+func TestSunSchedule(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 6, 21, 6, 0, 0, 0, time.UTC)
+	scheduler := newTestScheduler(t, &fakeStarter{}, now, config.Schedule{Name: "porch", At: "sunset-30m", Routine: "porch on"})
+
+	upcoming := scheduler.Statuses()[0].Upcoming
+	// Sunset in Berlin on June 21 is at about 19:33 UTC.
+	if want := time.Date(2026, 6, 21, 19, 3, 0, 0, time.UTC); upcoming[0].Sub(want).Abs() > 3*time.Minute {
+		t.Fatalf("next run = %v, want about %v", upcoming[0], want)
+	}
+	if gap := upcoming[1].Sub(upcoming[0]); gap < 23*time.Hour || gap > 25*time.Hour {
+		t.Fatalf("runs %v and %v are not a day apart", upcoming[0], upcoming[1])
+	}
+}
@@ -0,0 +1,152 @@
+// Package sun computes sunrise and sunset offline with the NOAA sunrise
+// equation, which is accurate to about a minute outside the polar regions.
+package sun
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	julianUnixEpoch = 2440587.5
+	julian2000      = 2451545.0
+	// horizon is the solar elevation at sunrise and sunset, accounting for
+	// refraction and the radius of the sun.
+	horizon = -0.833
+	// obliquity of the ecliptic in degrees.
+	obliquity = 23.4397
+	// searchDays bounds the search for the next sunrise or sunset, which may be
+	// months away near the poles.
+	searchDays = 370
+)
+
+// Events that triggers are relative to.
+const (
+	Sunrise = "sunrise"
+	Sunset  = "sunset"
+)
+
+// Day holds the sunrise and sunset of a day. Both are zero during polar day
+// and polar night.
+type Day struct {
+	Sunrise    time.Time
+	Sunset     time.Time
+	PolarDay   bool
+	PolarNight bool
+}
+
+// On returns sunrise and sunset of the day of date, in date's location, at
+// the given coordinates in degrees (north and east are positive).
+func On(date time.Time, latitude, longitude float64) Day {
+	year, month, day := date.Date()
+	noon := time.Date(year, month, day, 12, 0, 0, 0, date.Location())
+	julianNoon := float64(noon.Unix())/86400 + julianUnixEpoch
+
+	// Mean solar noon closest to local noon.
+	cycle := math.Round(julianNoon - julian2000 - 0.0009 + longitude/360)
+	meanNoon := cycle + 0.0009 - longitude/360
+
+	anomaly := math.Mod(357.5291+0.98560028*meanNoon, 360)
+	center := 1.9148*sin(anomaly) + 0.0200*sin(2*anomaly) + 0.0003*sin(3*anomaly)
+	eclipticLongitude := math.Mod(anomaly+center+180+102.9372, 360)
+	transit := julian2000 + meanNoon + 0.0053*sin(anomaly) - 0.0069*sin(2*eclipticLongitude)
+
+	declination := asin(sin(eclipticLongitude) * sin(obliquity))
+	cosHourAngle := (sin(horizon) - sin(latitude)*sin(declination)) / (cos(latitude) * cos(declination))
+	switch {
+	case cosHourAngle > 1:
+		return Day{PolarNight: true}
+	case cosHourAngle < -1:
+		return Day{PolarDay: true}
+	}
+
+	hourAngle := acos(cosHourAngle)
+	location := date.Location()
+	return Day{
+		Sunrise: fromJulian(transit - hourAngle/360).In(location),
+		Sunset:  fromJulian(transit + hourAngle/360).In(location),
+	}
+}
+
+// IsUp reports whether the sun is above the horizon at t.
+func IsUp(t time.Time, latitude, longitude float64) bool {
+	day := On(t, latitude, longitude)
+	switch {
+	case day.PolarDay:
+		return true
+	case day.PolarNight:
+		return false
+	}
+	return !t.Before(day.Sunrise) && t.Before(day.Sunset)
+}
+
+// Trigger fires at an offset from sunrise or sunset, e.g. "sunset-30m".
+type Trigger struct {
+	Event     string
+	Offset    time.Duration
+	Latitude  float64
+	Longitude float64
+}
+
+// ParseTrigger parses "sunrise" or "sunset", optionally followed by a signed
+// duration such as "+15m" or "-1h30m".
+func ParseTrigger(expression string, latitude, longitude float64) (Trigger, error) {
+	expression = strings.ToLower(strings.TrimSpace(expression))
+	for _, event := range []string{Sunrise, Sunset} {
+		rest, ok := strings.CutPrefix(expression, event)
+		if !ok {
+			continue
+		}
+		trigger := Trigger{Event: event, Latitude: latitude, Longitude: longitude}
+		if rest == "" {
+			return trigger, nil
+		}
+		if rest[0] != '+' && rest[0] != '-' {
+			break
+		}
+		offset, err := time.ParseDuration(rest)
+		if err != nil {
+			return Trigger{}, fmt.Errorf("invalid offset in %q: %w", expression, err)
+		}
+		if offset < -12*time.Hour || offset > 12*time.Hour {
+			return Trigger{}, fmt.Errorf("offset in %q must be within 12h", expression)
+		}
+		trigger.Offset = offset
+		return trigger, nil
+	}
+	return Trigger{}, fmt.Errorf("sun trigger %q must look like sunrise, sunset+15m or sunset-30m", expression)
+}
+
+// Next returns the first time after after at which the trigger fires, or the
+// zero time if the sun neither rises nor sets within a year. Days of polar day
+// or night are skipped.
+func (trigger Trigger) Next(after time.Time, location *time.Location) time.Time {
+	after = after.In(location)
+	// Start a day early: a negative offset moves tomorrow's sunrise into today.
+	for date := after.AddDate(0, 0, -1); date.Before(after.AddDate(0, 0, searchDays)); date = date.AddDate(0, 0, 1) {
+		day := On(date, trigger.Latitude, trigger.Longitude)
+		event := day.Sunset
+		if trigger.Event == Sunrise {
+			event = day.Sunrise
+		}
+		if event.IsZero() {
+			continue
+		}
+		if at := event.Add(trigger.Offset); at.After(after) {
+			return at
+		}
+	}
+	return time.Time{}
+}
+
+func fromJulian(julian float64) time.Time {
+	seconds := (julian - julianUnixEpoch) * 86400
+	return time.Unix(0, int64(seconds*float64(time.Second))).Round(time.Second)
+}
+
+func sin(degrees float64) float64 { return math.Sin(degrees * math.Pi / 180) }
+func cos(degrees float64) float64 { return math.Cos(degrees * math.Pi / 180) }
+func asin(value float64) float64  { return math.Asin(value) * 180 / math.Pi }
+func acos(value float64) float64  { return math.Acos(value) * 180 / math.Pi }
@@ -0,0 +1,146 @@
+package sun
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%q) error = %v", name, err)
+	}
+	return location
+}
+
+func within(got, want time.Time, tolerance time.Duration) bool {
+	difference := got.Sub(want)
+	return difference <= tolerance && difference >= -tolerance
+}
+
+func TestOn(t *testing.T) {
+	t.Parallel()
+
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	sydney := mustLoadLocation(t, "Australia/Sydney")
+
+	tests := []struct {
+		name                string
+		date                time.Time
+		latitude, longitude float64
+		wantSunrise         time.Time
+		wantSunset          time.Time
+	}{
+		{
+			name:     "berlin midsummer",
+			date:     time.Date(2026, 6, 21, 0, 0, 0, 0, berlin),
+			latitude: 52.52, longitude: 13.405,
+			wantSunrise: time.Date(2026, 6, 21, 4, 43, 0, 0, berlin),
+			wantSunset:  time.Date(2026, 6, 21, 21, 33, 0, 0, berlin),
+		},
+		{
+			name:     "berlin midwinter",
+			date:     time.Date(2026, 12, 21, 0, 0, 0, 0, berlin),
+			latitude: 52.52, longitude: 13.405,
+			wantSunrise: time.Date(2026, 12, 21, 8, 15, 0, 0, berlin),
+			wantSunset:  time.Date(2026, 12, 21, 15, 54, 0, 0, berlin),
+		},
+		{
+			name:     "sydney",
+			date:     time.Date(2026, 1, 1, 0, 0, 0, 0, sydney),
+			latitude: -33.87, longitude: 151.21,
+			wantSunrise: time.Date(2026, 1, 1, 5, 48, 0, 0, sydney),
+			wantSunset:  time.Date(2026, 1, 1, 20, 10, 0, 0, sydney),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			day := On(tt.date, tt.latitude, tt.longitude)
+			if !within(day.Sunrise, tt.wantSunrise, 3*time.Minute) {
+				t.Fatalf("On() sunrise = %v, want %v", day.Sunrise, tt.wantSunrise)
+			}
+			if !within(day.Sunset, tt.wantSunset, 3*time.Minute) {
+				t.Fatalf("On() sunset = %v, want %v", day.Sunset, tt.wantSunset)
+			}
+		})
+	}
+}
+
+func TestOnPolar(t *testing.T) {
+	t.Parallel()
+
+	tromso := mustLoadLocation(t, "Europe/Oslo")
+	if day := On(time.Date(2026, 6, 21, 0, 0, 0, 0, tromso), 69.65, 18.96); !day.PolarDay {
+		t.Fatalf("On() midsummer in Tromsø = %+v, want polar day", day)
+	}
+	if day := On(time.Date(2026, 12, 21, 0, 0, 0, 0, tromso), 69.65, 18.96); !day.PolarNight {
+		t.Fatalf("On() midwinter in Tromsø = %+v, want polar night", day)
+	}
+	if IsUp(time.Date(2026, 12, 21, 12, 0, 0, 0, tromso), 69.65, 18.96) {
+		t.Fatalf("IsUp() during polar night = true, want false")
+	}
+}
+
+func TestParseTrigger(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expression string
+		wantEvent  string
+		wantOffset time.Duration
+		wantErr    bool
+	}{
+		{expression: "sunset", wantEvent: Sunset},
+		{expression: "sunset-30m", wantEvent: Sunset, wantOffset: -30 * time.Minute},
+		{expression: "Sunrise+1h15m", wantEvent: Sunrise, wantOffset: 75 * time.Minute},
+		{expression: "sunset 30m", wantErr: true},
+		{expression: "sunset+13h", wantErr: true},
+		{expression: "noon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			t.Parallel()
+
+			trigger, err := ParseTrigger(tt.expression, 52.52, 13.405)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTrigger(%q) error = %v, wantErr %v", tt.expression, err, tt.wantErr)
+			}
+			if err == nil && (trigger.Event != tt.wantEvent || trigger.Offset != tt.wantOffset) {
+				t.Fatalf("ParseTrigger(%q) = %+v, want %s %s", tt.expression, trigger, tt.wantEvent, tt.wantOffset)
+			}
+		})
+	}
+}
+
+func TestTriggerNext(t *testing.T) {
+	t.Parallel()
+
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	trigger, err := ParseTrigger("sunset-30m", 52.52, 13.405)
+	if err != nil {
+		t.Fatalf("ParseTrigger() error = %v", err)
+	}
+
+	morning := time.Date(2026, 6, 21, 8, 0, 0, 0, berlin)
+	first := trigger.Next(morning, berlin)
+	if !within(first, time.Date(2026, 6, 21, 21, 3, 0, 0, berlin), 3*time.Minute) {
+		t.Fatalf("Next(%v) = %v, want about 21:03 the same day", morning, first)
+	}
+	second := trigger.Next(first, berlin)
+	if second.Sub(first) < 23*time.Hour || second.Sub(first) > 25*time.Hour {
+		t.Fatalf("Next(%v) = %v, want about a day later", first, second)
+	}
+
+	tromso := mustLoadLocation(t, "Europe/Oslo")
+	polar, err := ParseTrigger("sunset", 69.65, 18.96)
+	if err != nil {
+		t.Fatalf("ParseTrigger() error = %v", err)
+	}
+	if next := polar.Next(time.Date(2026, 6, 1, 0, 0, 0, 0, tromso), tromso); next.Month() != time.July {
+		t.Fatalf("Next() during midnight sun = %v, want the first sunset in July", next)
+	}
+}